@@ -8,6 +8,7 @@ import (
 	"github.com/tychoish/fun/adt"
 	"github.com/tychoish/fun/erc"
 	"github.com/tychoish/grip"
+	"github.com/tychoish/sardis/daemon"
 	"github.com/tychoish/sardis/repo"
 	"github.com/tychoish/sardis/srv"
 	"github.com/tychoish/sardis/subexec"
@@ -20,6 +21,7 @@ type Configuration struct {
 	Repos      repo.Configuration    `bson:"repositories" json:"repositories" yaml:"repositories"`
 	Operations subexec.Configuration `bson:"operations" json:"operations" yaml:"operations"`
 	System     sysmgmt.Configuration `bson:"system" json:"system" yaml:"system"`
+	Daemon     daemon.Configuration  `bson:"daemon" json:"daemon" yaml:"daemon"`
 
 	NetworkCOMPAT  srv.Network              `bson:"network" json:"network" yaml:"network"`
 	HostsCOMPAT    []srv.HostDefinition     `bson:"hosts,omitempty" json:"hosts,omitempty" yaml:"hosts,omitempty"`
@@ -95,6 +97,10 @@ func readConfiguration(fn string) (*Configuration, error) {
 	return out, nil
 }
 
+// OriginalPath returns the path of the file the configuration was
+// read from.
+func (conf *Configuration) OriginalPath() string { return conf.originalPath }
+
 func (conf *Configuration) Validate() error { return conf.caches.validation.Do(conf.doValidate) }
 func (conf *Configuration) doValidate() error {
 	grip.Debug(grip.MPrintf("validating %q", conf.originalPath))
@@ -110,7 +116,17 @@ func (conf *Configuration) doValidate() error {
 	ec.Push(conf.Settings.Validate())
 	ec.Push(conf.System.Validate())
 	ec.Push(conf.Repos.Validate())
+	ec.Push(conf.resolveCommandDirectories())
+
+	conf.Operations.SetRepositoryResolver(func(name string) (string, error) {
+		rp, err := conf.Repos.FindOne(name)
+		if err != nil {
+			return "", err
+		}
+		return rp.Path, nil
+	})
 	ec.Push(conf.Operations.Validate())
+	ec.Push(conf.Daemon.Validate())
 
 	return ec.Resolve()
 }
@@ -131,6 +147,31 @@ func (conf *Configuration) expandOperations() error {
 	return nil
 }
 
+// resolveCommandDirectories replaces references to repositories and
+// their worktrees (e.g. "repo:<name>" and "repo:<name>@<branch>") in
+// command directories with their paths.
+func (conf *Configuration) resolveCommandDirectories() error {
+	ec := &erc.Collector{}
+
+	for gidx := range conf.Operations.Commands {
+		group := &conf.Operations.Commands[gidx]
+
+		dir, err := conf.Repos.ResolveDirectory(group.Directory)
+		ec.Wrapf(err, "command group %q", group.Name)
+		group.Directory = dir
+
+		for cidx := range group.Commands {
+			cmd := &group.Commands[cidx]
+
+			dir, err := conf.Repos.ResolveDirectory(cmd.Directory)
+			ec.Wrapf(err, "command %q in group %q", cmd.Name, group.Name)
+			cmd.Directory = dir
+		}
+	}
+
+	return ec.Resolve()
+}
+
 func (conf *Configuration) expandLinkedFiles() error {
 	if conf.linkedFilesRead {
 		return nil
@@ -211,5 +252,6 @@ func (conf *Configuration) Join(mcf *Configuration) *Configuration {
 	conf.System.Join(mcf.System)
 	conf.Repos.Join(&mcf.Repos)
 	conf.Operations.Join(&mcf.Operations)
+	conf.Daemon.Join(&mcf.Daemon)
 	return conf
 }
@@ -0,0 +1,411 @@
+// package daemon runs repository, command, and system routine jobs
+// on a schedule, as a long running service.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/fun/srv"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/sardis/global"
+	"github.com/tychoish/sardis/repo"
+	"github.com/tychoish/sardis/subexec"
+	"github.com/tychoish/sardis/sysmgmt"
+	"github.com/tychoish/sardis/util"
+)
+
+// Routines are the names of the system-wide jobs that the daemon can
+// run on a schedule.
+var Routines = []string{"links", "services", "nightly", "retry"}
+
+type Configuration struct {
+	Routines  map[string]string `bson:"routines" json:"routines" yaml:"routines"`
+	Jitter    float64           `bson:"jitter" json:"jitter" yaml:"jitter"`
+	StatePath string            `bson:"state_path" json:"state_path" yaml:"state_path"`
+}
+
+func (conf *Configuration) Join(mcf *Configuration) {
+	if mcf == nil {
+		return
+	}
+
+	for name, interval := range mcf.Routines {
+		if conf.Routines == nil {
+			conf.Routines = map[string]string{}
+		}
+		conf.Routines[name] = interval
+	}
+
+	conf.Jitter = util.Default(mcf.Jitter, conf.Jitter)
+	conf.StatePath = util.Default(mcf.StatePath, conf.StatePath)
+}
+
+func (conf *Configuration) Validate() error {
+	ec := &erc.Collector{}
+
+	conf.Jitter = util.Default(conf.Jitter, 0.1)
+	conf.StatePath = util.TryExpandHomeDir(util.Default(conf.StatePath, filepath.Join(util.GetStateDir(global.ApplicationName), "daemon.json")))
+
+	ec.Whenf(conf.Jitter < 0 || conf.Jitter > 1, "jitter %f must be between 0 and 1", conf.Jitter)
+	for name, interval := range conf.Routines {
+		ec.Whenf(!slices.Contains(Routines, name), "%q is not a known routine", name)
+		if _, err := util.ParseInterval(interval); err != nil {
+			ec.Wrapf(err, "schedule for routine %q", name)
+		}
+	}
+
+	return ec.Resolve()
+}
+
+// Job is a single scheduled unit of work. Jobs with the same Key never
+// run concurrently.
+type Job struct {
+	Kind     string
+	Target   string
+	Op       string
+	Key      string
+	Interval time.Duration
+	Worker   fnx.Worker
+}
+
+func (j *Job) ID() string { return util.DotJoin(j.Kind, j.Target, j.Op) }
+
+type entry struct {
+	job     Job
+	next    time.Time
+	last    time.Time
+	lastErr error
+	running bool
+}
+
+// Scheduler tracks the next run time for every job, and runs jobs as
+// they come due.
+type Scheduler struct {
+	jitter    float64
+	statePath string
+
+	mtx      sync.Mutex
+	entries  []*entry
+	inflight map[string]bool
+
+	// stateMtx serializes writes to the state file, so that
+	// concurrent writers cannot replace newer state with older.
+	stateMtx sync.Mutex
+}
+
+func NewScheduler(conf *Configuration, jobs []Job) *Scheduler {
+	s := &Scheduler{
+		jitter:    conf.Jitter,
+		statePath: conf.StatePath,
+		inflight:  map[string]bool{},
+	}
+
+	prev := s.previousRuns()
+
+	now := time.Now()
+	for _, job := range jobs {
+		// spread the first runs out over the jitter window
+		// so that the daemon doesn't start everything at once.
+		ent := &entry{job: job, next: now.Add(s.jitterFor(job.Interval))}
+
+		// jobs that ran before the daemon restarted keep their
+		// schedule, unless they are already overdue.
+		if js, ok := prev[job.ID()]; ok && !js.LastRun.IsZero() {
+			ent.last = js.LastRun
+			if js.LastError != "" {
+				ent.lastErr = errors.New(js.LastError)
+			}
+			if next := js.LastRun.Add(job.Interval); next.After(ent.next) {
+				ent.next = next
+			}
+		}
+
+		s.entries = append(s.entries, ent)
+	}
+
+	return s
+}
+
+// previousRuns reads the state file left by the last daemon on this
+// host, if any, and returns its jobs by id.
+func (s *Scheduler) previousRuns() map[string]JobStatus {
+	out := map[string]JobStatus{}
+	if s.statePath == "" {
+		return out
+	}
+
+	state, err := ReadState(s.statePath)
+	if err != nil {
+		grip.Warning(grip.When(!os.IsNotExist(err), message.WrapError(err, message.Fields{
+			"op":   "daemon",
+			"path": s.statePath,
+			"msg":  "not resuming schedule from previous state",
+		})))
+		return out
+	}
+
+	if state.Host != util.GetHostname() {
+		return out
+	}
+
+	for _, js := range state.Jobs {
+		out[js.ID] = js
+	}
+
+	return out
+}
+
+func (s *Scheduler) jitterFor(interval time.Duration) time.Duration {
+	window := int64(float64(interval) * s.jitter)
+	if window <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(window))
+}
+
+// Service returns a fun/srv service that runs the scheduler until
+// its context is canceled, and waits for running jobs to return
+// before exiting.
+func (s *Scheduler) Service() *srv.Service {
+	return &srv.Service{
+		Name: "sardis-daemon",
+		Run:  s.run,
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context) error {
+	wg := &fnx.WaitGroup{}
+	defer wg.Wait(context.Background())
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	grip.Notice(message.NewKV().
+		KV("op", "daemon").
+		KV("state", "STARTED").
+		KV("jobs", len(s.entries)).
+		KV("state_path", s.statePath))
+
+	for {
+		for _, ent := range s.due(time.Now()) {
+			wg.Launch(ctx, s.runEntry(ent))
+		}
+
+		s.writeState()
+
+		timer.Reset(max(time.Second, time.Until(s.nextWakeup())))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// due returns all entries whose next run has passed, and marks them
+// as running. Entries whose key is already in flight are deferred for
+// (about) a minute rather than run concurrently.
+func (s *Scheduler) due(now time.Time) []*entry {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var out []*entry
+	for _, ent := range s.entries {
+		if ent.running || ent.next.After(now) {
+			continue
+		}
+
+		if s.inflight[ent.job.Key] {
+			ent.next = now.Add(min(ent.job.Interval, time.Minute) + s.jitterFor(time.Minute))
+			continue
+		}
+
+		s.inflight[ent.job.Key] = true
+		ent.running = true
+		out = append(out, ent)
+	}
+
+	return out
+}
+
+func (s *Scheduler) nextWakeup() time.Time {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var next time.Time
+	for _, ent := range s.entries {
+		if ent.running {
+			continue
+		}
+		if next.IsZero() || ent.next.Before(next) {
+			next = ent.next
+		}
+	}
+
+	if next.IsZero() {
+		return time.Now().Add(time.Minute)
+	}
+	return next
+}
+
+func (s *Scheduler) runEntry(ent *entry) fnx.Operation {
+	return func(ctx context.Context) {
+		startAt := time.Now()
+		err := ent.job.Worker.WithRecover().Run(ctx)
+
+		msg := message.NewKV().
+			KV("op", "daemon").
+			KV("job", ent.job.ID()).
+			KV("dur", time.Since(startAt)).
+			KV("err", err != nil)
+
+		if err != nil {
+			grip.Error(message.WrapError(err, msg))
+		} else {
+			grip.Info(msg)
+		}
+
+		s.mtx.Lock()
+		ent.running = false
+		ent.last = startAt
+		ent.lastErr = err
+		ent.next = time.Now().Add(ent.job.Interval + s.jitterFor(ent.job.Interval))
+		delete(s.inflight, ent.job.Key)
+		s.mtx.Unlock()
+
+		s.writeState()
+	}
+}
+
+// Jobs collects every scheduled job from the repository, command, and
+// system configuration.
+func Jobs(conf *Configuration, repos []repo.GitRepository, cmds []subexec.Command, sys *sysmgmt.Configuration) []Job {
+	var out []Job
+
+	for idx := range repos {
+		rp := repos[idx]
+		if rp.Disabled {
+			continue
+		}
+
+		ops := make([]string, 0, len(rp.Schedule))
+		for op := range rp.Schedule {
+			ops = append(ops, op)
+		}
+		slices.Sort(ops)
+
+		for _, op := range ops {
+			interval, err := util.ParseInterval(rp.Schedule[op])
+			if err != nil {
+				continue
+			}
+
+			out = append(out, Job{
+				Kind:     "repo",
+				Target:   rp.Name,
+				Op:       op,
+				Key:      fmt.Sprint("repo:", rp.Path),
+				Interval: interval,
+				Worker:   rp.Job(op),
+			})
+		}
+	}
+
+	seen := map[string]bool{}
+	for idx := range cmds {
+		cmd := cmds[idx]
+		if cmd.Schedule == "" {
+			continue
+		}
+
+		interval, err := util.ParseInterval(cmd.Schedule)
+		if err != nil {
+			continue
+		}
+
+		// group aliases produce identical copies of the same
+		// command, which should only be scheduled once.
+		key := fmt.Sprint("cmd:", cmd.Directory, ":", cmd.Command, ":", strings.Join(cmd.Commands, ";"))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		out = append(out, Job{
+			Kind:     "command",
+			Target:   cmd.Name,
+			Op:       "run",
+			Key:      key,
+			Interval: interval,
+			Worker:   cmd.Worker(),
+		})
+	}
+
+	for _, name := range Routines {
+		spec, ok := conf.Routines[name]
+		if !ok {
+			continue
+		}
+
+		interval, err := util.ParseInterval(spec)
+		if err != nil {
+			continue
+		}
+
+		out = append(out, Job{
+			Kind:     "routine",
+			Target:   name,
+			Op:       "run",
+			Key:      fmt.Sprint("routine:", name),
+			Interval: interval,
+			Worker:   routine(name, repos, sys),
+		})
+	}
+
+	return out
+}
+
+func routine(name string, repos []repo.GitRepository, sys *sysmgmt.Configuration) fnx.Worker {
+	if name == "retry" {
+		return repo.RetryJob(repos)
+	}
+
+	return func(ctx context.Context) error {
+		workers := func(yield func(fnx.Worker) bool) {
+			if name == "links" || name == "nightly" {
+				for _, link := range sys.Links.Links {
+					if !yield(link.CreateLinkJob()) {
+						return
+					}
+				}
+			}
+			if name == "nightly" {
+				for _, rp := range repos {
+					if !yield(rp.CleanupJob()) {
+						return
+					}
+				}
+			}
+			if name == "services" || name == "nightly" {
+				for _, service := range sys.SystemD.Services {
+					if !yield(service.Worker()) {
+						return
+					}
+				}
+			}
+		}
+		return subexec.TOOLS.WorkerPool(workers).Run(ctx)
+	}
+}
@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/sardis/util"
+)
+
+// State is the daemon's next-run table, written to the state path
+// every time it changes so that other processes can query it.
+type State struct {
+	PID       int         `bson:"pid" json:"pid" yaml:"pid"`
+	Host      string      `bson:"host" json:"host" yaml:"host"`
+	UpdatedAt time.Time   `bson:"updated_at" json:"updated_at" yaml:"updated_at"`
+	Jobs      []JobStatus `bson:"jobs" json:"jobs" yaml:"jobs"`
+}
+
+type JobStatus struct {
+	ID        string        `bson:"id" json:"id" yaml:"id"`
+	Kind      string        `bson:"kind" json:"kind" yaml:"kind"`
+	Target    string        `bson:"target" json:"target" yaml:"target"`
+	Op        string        `bson:"op" json:"op" yaml:"op"`
+	Interval  time.Duration `bson:"interval" json:"interval" yaml:"interval"`
+	Running   bool          `bson:"running" json:"running" yaml:"running"`
+	LastRun   time.Time     `bson:"last_run,omitempty" json:"last_run,omitempty" yaml:"last_run,omitempty"`
+	LastError string        `bson:"last_error,omitempty" json:"last_error,omitempty" yaml:"last_error,omitempty"`
+	NextRun   time.Time     `bson:"next_run" json:"next_run" yaml:"next_run"`
+}
+
+func (s *Scheduler) State() *State {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	out := &State{
+		PID:       os.Getpid(),
+		Host:      util.GetHostname(),
+		UpdatedAt: time.Now(),
+		Jobs:      make([]JobStatus, 0, len(s.entries)),
+	}
+
+	for _, ent := range s.entries {
+		js := JobStatus{
+			ID:       ent.job.ID(),
+			Kind:     ent.job.Kind,
+			Target:   ent.job.Target,
+			Op:       ent.job.Op,
+			Interval: ent.job.Interval,
+			Running:  ent.running,
+			LastRun:  ent.last,
+			NextRun:  ent.next,
+		}
+		if ent.lastErr != nil {
+			js.LastError = ent.lastErr.Error()
+		}
+		out.Jobs = append(out.Jobs, js)
+	}
+
+	slices.SortStableFunc(out.Jobs, func(a, b JobStatus) int { return a.NextRun.Compare(b.NextRun) })
+
+	return out
+}
+
+func (s *Scheduler) writeState() {
+	s.stateMtx.Lock()
+	defer s.stateMtx.Unlock()
+
+	grip.Warning(message.WrapError(writeState(s.statePath, s.State()), message.Fields{
+		"op":   "daemon",
+		"path": s.statePath,
+		"msg":  "problem writing daemon state",
+	}))
+}
+
+func writeState(path string, state *State) error {
+	payload, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// write and rename so readers never see a partial file. Each
+	// write uses its own temporary file, so that writers (including
+	// other daemons) never rename each other's partial files.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// after the rename this is a noop.
+	defer util.DropErrorOnDefer(func() error { return os.Remove(tmp.Name()) })
+
+	if _, err := tmp.Write(payload); err != nil {
+		util.DropErrorOnDefer(tmp.Close)
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadState reads the state file written by a running daemon.
+func ReadState(path string) (*State, error) {
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &State{}
+	if err := json.Unmarshal(payload, out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
@@ -0,0 +1,348 @@
+package sardis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/sardis/repo"
+	"github.com/tychoish/sardis/util"
+)
+
+// AppendRepositories adds repository definitions to the
+// `repositories.git` list of a YAML configuration file, creating the
+// file and the list if needed. The rest of the document, including
+// comments and the indentation width, is preserved.
+func AppendRepositories(fn string, repos ...repo.GitRepository) error {
+	if len(repos) == 0 {
+		return nil
+	}
+
+	doc, indent, err := readConfigDocument(fn)
+	if err != nil {
+		return err
+	}
+
+	list := findOrCreateMapping(configRoot(doc), "repositories", "git")
+	if list.Kind != yaml.SequenceNode {
+		if list.Kind != 0 && !(list.Kind == yaml.ScalarNode && list.Tag == "!!null") {
+			return fmt.Errorf("repositories.git in %q is not a list", fn)
+		}
+		*list = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+
+	for _, rp := range repos {
+		node, err := EncodeRepository(rp)
+		if err != nil {
+			return err
+		}
+		list.Content = append(list.Content, node)
+	}
+
+	return writeConfigDocument(fn, doc, indent)
+}
+
+// EncodeRepository renders a repository definition as a YAML node,
+// omitting all fields that have zero values.
+func EncodeRepository(rp repo.GitRepository) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(rp); err != nil {
+		return nil, err
+	}
+	pruneZeroValues(node)
+	return node, nil
+}
+
+// MarshalRepositories renders repository definitions as a YAML
+// `git:` list that can be pasted into the repositories section of a
+// configuration file.
+func MarshalRepositories(repos ...repo.GitRepository) ([]byte, error) {
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, rp := range repos {
+		node, err := EncodeRepository(rp)
+		if err != nil {
+			return nil, err
+		}
+		list.Content = append(list.Content, node)
+	}
+
+	return encodeYAML(defaultIndent, &yaml.Node{
+		Kind: yaml.MappingNode,
+		Tag:  "!!map",
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "git"},
+			list,
+		},
+	})
+}
+
+const defaultIndent = 2
+
+func encodeYAML(indent int, node *yaml.Node) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(indent)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isYAMLFile(fn string) bool {
+	return strings.HasSuffix(fn, ".yaml") || strings.HasSuffix(fn, ".yml")
+}
+
+// readConfigDocument parses the file, and returns the indentation
+// width of the file so that edits can write it back in the same
+// style.
+func readConfigDocument(fn string) (*yaml.Node, int, error) {
+	if !isYAMLFile(fn) {
+		return nil, 0, fmt.Errorf("cannot edit %q, only yaml configuration files are supported", fn)
+	}
+
+	payload, err := os.ReadFile(util.TryExpandHomeDir(fn))
+	if errors.Is(err, os.ErrNotExist) {
+		payload = nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(payload, doc); err != nil {
+		return nil, 0, fmt.Errorf("file %s was not parsable: %w", fn, err)
+	}
+
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+	}
+
+	return doc, detectIndent(payload), nil
+}
+
+// detectIndent returns the narrowest indentation of the lines in the
+// document, which is the indentation width the file uses for nested
+// mappings.
+func detectIndent(payload []byte) int {
+	indent := 0
+	for line := range strings.Lines(string(payload)) {
+		trimmed := strings.TrimLeft(line, " ")
+		if width := len(line) - len(trimmed); width > 0 && strings.TrimSpace(trimmed) != "" && !strings.HasPrefix(trimmed, "#") {
+			indent = util.Default(min(indent, width), width)
+		}
+	}
+	return min(max(util.Default(indent, defaultIndent), 2), 8)
+}
+
+func writeConfigDocument(fn string, doc *yaml.Node, indent int) error {
+	payload, err := encodeYAML(indent, doc)
+	if err != nil {
+		return err
+	}
+
+	fn = util.TryExpandHomeDir(fn)
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0o644)
+	if stat, err := os.Stat(fn); err == nil {
+		mode = stat.Mode().Perm()
+	}
+
+	// write and rename so that a failure never leaves a partial
+	// configuration file behind.
+	tmp := fn + ".tmp"
+	if err := os.WriteFile(tmp, payload, mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, fn)
+}
+
+// configRoot returns the mapping that holds the configuration: the
+// `global` section of files with host-specific sections, and the top
+// level mapping otherwise.
+func configRoot(doc *yaml.Node) *yaml.Node {
+	root := doc.Content[0]
+	if global := mappingValue(root, "global"); global != nil && mappingValue(root, "repositories") == nil {
+		return global
+	}
+	return root
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			return node.Content[idx+1]
+		}
+	}
+	return nil
+}
+
+func findOrCreateMapping(node *yaml.Node, path ...string) *yaml.Node {
+	for idx, key := range path {
+		next := mappingValue(node, key)
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			if idx == len(path)-1 {
+				next = &yaml.Node{}
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, next)
+		}
+		node = next
+	}
+	return node
+}
+
+func pruneZeroValues(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	content := node.Content[:0]
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		key, value := node.Content[idx], node.Content[idx+1]
+		pruneZeroValues(value)
+		if isZeroNode(value) {
+			continue
+		}
+		content = append(content, key, value)
+	}
+	node.Content = content
+}
+
+func isZeroNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(node.Content) == 0
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!null":
+			return true
+		case "!!bool":
+			return node.Value == "false"
+		case "!!int", "!!float":
+			return node.Value == "0"
+		case "!!str":
+			return node.Value == ""
+		}
+	}
+	return false
+}
+
+// RemoveRepository removes the repository definition with the given
+// name from a YAML configuration file, including definitions in
+// host-specific and legacy (`repo`) sections, and returns the number
+// of definitions removed.
+func RemoveRepository(fn string, name string) (int, error) {
+	doc, indent, err := readConfigDocument(fn)
+	if err != nil {
+		return 0, err
+	}
+
+	root := doc.Content[0]
+	sections := []*yaml.Node{root}
+	if global := mappingValue(root, "global"); global != nil {
+		sections = append(sections, global)
+	}
+	if local := mappingValue(root, "local"); local != nil && local.Kind == yaml.MappingNode {
+		for idx := 1; idx < len(local.Content); idx += 2 {
+			sections = append(sections, local.Content[idx])
+		}
+	}
+
+	var count int
+	for _, section := range sections {
+		lists := []*yaml.Node{mappingValue(section, "repo")}
+		if repos := mappingValue(section, "repositories"); repos != nil {
+			lists = append(lists, mappingValue(repos, "git"))
+		}
+
+		for _, list := range lists {
+			if list == nil || list.Kind != yaml.SequenceNode {
+				continue
+			}
+
+			content := list.Content[:0]
+			for _, item := range list.Content {
+				if nv := mappingValue(item, "name"); nv != nil && nv.Value == name {
+					count++
+					continue
+				}
+				content = append(content, item)
+			}
+			list.Content = content
+		}
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	return count, writeConfigDocument(fn, doc, indent)
+}
+
+// RepositoryConfigFile returns the configuration file that defines the
+// named repository.
+func (conf *Configuration) RepositoryConfigFile(name string) (string, error) {
+	fn := conf.findRepositoryConfigFile(func(rp repo.GitRepository) bool { return rp.Name == name })
+	if fn == "" {
+		return "", fmt.Errorf("no configuration file defines repository %q", name)
+	}
+	return fn, nil
+}
+
+// RepositoryConfigFileForTag returns the file in the linked
+// configuration files (settings.config_files) that defines
+// repositories with the given tag, falling back to the main
+// configuration file when no linked file owns the tag.
+func (conf *Configuration) RepositoryConfigFileForTag(tag string) string {
+	fn := conf.findRepositoryConfigFile(func(rp repo.GitRepository) bool { return slices.Contains(rp.Tags, tag) })
+	return util.Default(fn, conf.originalPath)
+}
+
+func (conf *Configuration) findRepositoryConfigFile(pred func(repo.GitRepository) bool) string {
+	candidates := []string{}
+	if conf.Settings != nil {
+		candidates = append(candidates, conf.Settings.ConfigPaths...)
+	}
+	candidates = append(candidates, conf.originalPath)
+
+	for _, fn := range candidates {
+		if fn == "" || !isYAMLFile(fn) {
+			continue
+		}
+
+		iconf, err := readConfiguration(util.TryExpandHomeDir(fn))
+		if err != nil {
+			grip.Debug(message.WrapError(err, message.Fields{
+				"op":   "find-config-file",
+				"path": fn,
+			}))
+			continue
+		}
+
+		if slices.ContainsFunc(iconf.Migrate().Repos.GitRepos, pred) {
+			return fn
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,330 @@
+// package history is an append-only, on-disk log of the jobs that
+// sardis runs: repository fetches and syncs, commands, and service
+// setup. Each run is stored as one JSON document per line, and the
+// log rotates once it reaches MaxFileSize.
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/sardis/global"
+	"github.com/tychoish/sardis/util"
+)
+
+// MaxOutputSize bounds the amount of captured output stored with each
+// record. Longer output is truncated, keeping the end.
+const MaxOutputSize = 64 * 1024
+
+// MaxFileSize is the size at which the history file rotates. The
+// store keeps the current file and the one before it, so history
+// never uses much more than twice this much space.
+const MaxFileSize = 16 * 1024 * 1024
+
+const ErrRecordNotFound ers.Error = "history record not found"
+
+type Record struct {
+	ID        string        `bson:"id" json:"id" yaml:"id"`
+	Op        string        `bson:"op" json:"op" yaml:"op"`
+	Target    string        `bson:"target" json:"target" yaml:"target"`
+	Host      string        `bson:"host" json:"host" yaml:"host"`
+	StartedAt time.Time     `bson:"started_at" json:"started_at" yaml:"started_at"`
+	Duration  time.Duration `bson:"dur" json:"dur" yaml:"dur"`
+	Success   bool          `bson:"success" json:"success" yaml:"success"`
+	ExitCode  int           `bson:"exit_code" json:"exit_code" yaml:"exit_code"`
+	Error     string        `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+	Output    string        `bson:"output,omitempty" json:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// NewRecord constructs a record for a completed run, computing the
+// duration from the start time.
+func NewRecord(op, target, id string, startAt time.Time, err error, output string) Record {
+	rec := Record{
+		ID:        id,
+		Op:        op,
+		Target:    target,
+		Host:      util.GetHostname(),
+		StartedAt: startAt,
+		Duration:  time.Since(startAt),
+		Success:   err == nil,
+		Output:    output,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+		rec.ExitCode = exitCode(err)
+	}
+
+	if len(rec.Output) > MaxOutputSize {
+		rec.Output = rec.Output[len(rec.Output)-MaxOutputSize:]
+	}
+
+	return rec
+}
+
+var exitStatusRegex = regexp.MustCompile(`exit status (\d+)`)
+
+// exitCode returns the exit code of the process that caused the
+// error, or -1 when the failure did not come from a process.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	// jasper does not always wrap the underlying error.
+	if match := exitStatusRegex.FindStringSubmatch(err.Error()); match != nil {
+		if code, err := strconv.Atoi(match[1]); err == nil {
+			return code
+		}
+	}
+
+	return -1
+}
+
+// Filter selects records from the store. Zero values match all
+// records; Limit, when positive, keeps only the most recent matches.
+type Filter struct {
+	Op         string
+	Target     string
+	Host       string
+	FailedOnly bool
+	Since      time.Time
+	Limit      int
+}
+
+func (f Filter) Match(rec Record) bool {
+	switch {
+	case f.Op != "" && rec.Op != f.Op:
+		return false
+	case f.Target != "" && !strings.Contains(rec.Target, f.Target):
+		return false
+	case f.Host != "" && rec.Host != f.Host:
+		return false
+	case f.FailedOnly && rec.Success:
+		return false
+	case !f.Since.IsZero() && rec.StartedAt.Before(f.Since):
+		return false
+	default:
+		return true
+	}
+}
+
+type Store struct {
+	path string
+	mtx  sync.Mutex
+}
+
+func NewStore(path string) *Store { return &Store{path: path} }
+
+// DefaultPath returns the location of the history file inside of
+// the XDG state directory.
+func DefaultPath() string {
+	return filepath.Join(util.GetStateDir(global.ApplicationName), "history.jsonl")
+}
+
+func (s *Store) Path() string { return s.path }
+
+// RotatedPath is the location of the previous history file, which
+// holds the records from before the last rotation.
+func (s *Store) RotatedPath() string { return s.path + ".1" }
+
+func (s *Store) Append(rec Record) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	payload = append(payload, '\n')
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	release, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(payload); err != nil {
+		util.DropErrorOnDefer(file.Close)
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		util.DropErrorOnDefer(file.Close)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if stat.Size() < MaxFileSize {
+		return nil
+	}
+
+	return os.Rename(s.path, s.RotatedPath())
+}
+
+// lock holds an flock on a file next to the history, so that
+// processes that share the history (e.g. the daemon and commands)
+// do not append to a file that another process is rotating.
+func (s *Store) lock() (release func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		util.DropErrorOnDefer(file.Close)
+		return nil, err
+	}
+
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		util.DropErrorOnDefer(file.Close)
+	}, nil
+}
+
+// Find returns the record with the given id. Ids are run nonces, so
+// in the (unlikely) case of a collision, the most recent record wins.
+func (s *Store) Find(id string) (*Record, error) {
+	var out *Record
+	err := s.scan(func(rec Record) {
+		if rec.ID == id && (out == nil || !rec.StartedAt.Before(out.StartedAt)) {
+			out = &rec
+		}
+	})
+	switch {
+	case err != nil:
+		return nil, err
+	case out == nil:
+		return nil, fmt.Errorf("%q: %w", id, ErrRecordNotFound)
+	default:
+		return out, nil
+	}
+}
+
+// Read returns all matching records, oldest first. A missing history
+// file is not an error.
+func (s *Store) Read(filter Filter) ([]Record, error) {
+	out := []Record{}
+	if err := s.scan(func(rec Record) {
+		if filter.Match(rec) {
+			out = append(out, rec)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(out, func(a, b Record) int { return a.StartedAt.Compare(b.StartedAt) })
+
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[len(out)-filter.Limit:]
+	}
+
+	return out, nil
+}
+
+// scan calls fn for every record in the rotated and current history
+// files, in the order they were written.
+func (s *Store) scan(fn func(Record)) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	release, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	for _, path := range []string{s.RotatedPath(), s.path} {
+		if err := scanFile(path, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanFile(path string, fn func(Record)) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer util.DropErrorOnDefer(file.Close)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 8*MaxOutputSize)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			grip.Warning(message.WrapError(err, message.Fields{
+				"path": path,
+				"line": lineNum,
+				"msg":  "skipping malformed history record",
+			}))
+			continue
+		}
+
+		fn(rec)
+	}
+
+	return scanner.Err()
+}
+
+type ctxKey struct{}
+
+func WithStore(ctx context.Context, store *Store) context.Context {
+	return context.WithValue(ctx, ctxKey{}, store)
+}
+
+// Context returns the store attached to the context, or nil.
+func Context(ctx context.Context) *Store {
+	store, _ := ctx.Value(ctxKey{}).(*Store)
+	return store
+}
+
+// Add appends the record to the store in the context. Without a
+// store this is a noop, and errors are logged rather than returned,
+// so that history never causes a job to fail.
+func Add(ctx context.Context, rec Record) {
+	store := Context(ctx)
+	if store == nil {
+		return
+	}
+
+	grip.Warning(message.WrapError(store.Append(rec), message.Fields{
+		"op":     rec.Op,
+		"id":     rec.ID,
+		"target": rec.Target,
+		"path":   store.path,
+		"msg":    "problem recording history",
+	}))
+}
@@ -0,0 +1,63 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewRecordExitCode(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		code int
+	}{
+		{name: "Success", err: nil, code: 0},
+		{name: "ExitError", err: fmt.Errorf("running: %w", exitErr), code: 3},
+		{name: "ExitStatusMessage", err: errors.New("command failed: exit status 128"), code: 128},
+		{name: "NotAProcess", err: errors.New("path does not exist"), code: -1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := NewRecord("op", "target", "id", time.Now(), tc.err, "")
+			if rec.ExitCode != tc.code {
+				t.Errorf("exit code %d, expected %d", rec.ExitCode, tc.code)
+			}
+			if rec.Success != (tc.err == nil) {
+				t.Errorf("success %t for %v", rec.Success, tc.err)
+			}
+		})
+	}
+}
+
+func TestStoreAppendRead(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "history", "history.jsonl"))
+
+	started := time.Now()
+	for idx, err := range []error{nil, errors.New("exit status 1"), nil} {
+		rec := NewRecord("repo-sync", "notes", fmt.Sprint(idx), started.Add(time.Duration(idx)*time.Second), err, "")
+		if err := store.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := store.Read(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("read %d records, expected 3", len(records))
+	}
+
+	failed, err := store.Read(Filter{FailedOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].ID != "1" || failed[0].ExitCode != 1 {
+		t.Errorf("unexpected failed records: %+v", failed)
+	}
+}
@@ -86,12 +86,21 @@ func hacking() *cmdr.Commander {
 }
 
 func linkOp() *cmdr.Commander {
-	return cmdr.MakeCommander().
+	return withDryRunFlags(cmdr.MakeCommander()).
 		SetName("links").
 		Aliases("setup-links").
 		SetUsage("setup all configured links").
-		With(StandardSardisOperationSpec().
-			SetAction(func(ctx context.Context, conf *sardis.Configuration) error {
+		With(dryRunOperationSpec().
+			SetAction(func(ctx context.Context, op *dryRunOperation) error {
+				conf := op.conf
+				if op.dryRun.enabled {
+					exps := make([]subexec.Explanation, 0, len(conf.System.Links.Links))
+					for idx := range conf.System.Links.Links {
+						exps = append(exps, conf.System.Links.Links[idx].Explain())
+					}
+					return writeExplanations(op.dryRun.format, exps)
+				}
+
 				workers := func(yield func(fnx.Worker) bool) {
 					for _, link := range conf.System.Links.Links {
 						if !yield(link.CreateLinkJob()) {
@@ -231,12 +240,25 @@ func configCheck() *cmdr.Commander {
 }
 
 func nightly() *cmdr.Commander {
-	return cmdr.MakeCommander().
+	return withDryRunFlags(cmdr.MakeCommander()).
 		SetName("nightly").
 		SetUsage("run nightly config operation").
-		With(cmdr.SpecBuilder(
-			ResolveConfiguration,
-		).SetAction(func(ctx context.Context, conf *sardis.Configuration) error {
+		With(dryRunOperationSpec().SetAction(func(ctx context.Context, op *dryRunOperation) error {
+			conf := op.conf
+			if op.dryRun.enabled {
+				var exps []subexec.Explanation
+				for idx := range conf.System.Links.Links {
+					exps = append(exps, conf.System.Links.Links[idx].Explain())
+				}
+				for idx := range conf.Repos.GitRepos {
+					exps = append(exps, conf.Repos.GitRepos[idx].Explain("cleanup", nil))
+				}
+				for idx := range conf.System.SystemD.Services {
+					exps = append(exps, conf.System.SystemD.Services[idx].Explain())
+				}
+				return writeExplanations(op.dryRun.format, exps)
+			}
+
 			workers := func(yield func(fnx.Worker) bool) {
 				for _, link := range conf.System.Links.Links {
 					if !yield(link.CreateLinkJob()) {
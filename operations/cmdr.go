@@ -85,6 +85,8 @@ func StandardSardisOperationSpec() *cmdr.OperationSpec[*sardis.Configuration] {
 				ctx = subexec.WithJasper(ctx, &conf.Operations)
 				ctx = srsrv.WithAppLogger(ctx, conf.Settings.Logging)
 				ctx = srsrv.WithRemoteNotify(ctx, conf.Settings)
+				ctx = withHistory(ctx, conf)
+				ctx = withRetryQueue(ctx, conf)
 				return ctx
 			})
 }
@@ -135,10 +137,13 @@ func Commander() *cmdr.Commander {
 			Admin(),
 			ArchLinux(),
 			Blog(),
+			Daemon(),
 			DMenu(),
 			Gadget(),
+			History(),
 			Jira(),
 			Notify(),
+			Queue(),
 			Repo(),
 			ExecCommand(),
 			RunCommand(),
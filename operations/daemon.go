@@ -0,0 +1,92 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cheynewallace/tabby"
+
+	"github.com/tychoish/cmdr"
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/sardis"
+	"github.com/tychoish/sardis/daemon"
+)
+
+func Daemon() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("daemon").
+		SetUsage("run scheduled repository, command, and routine jobs in the foreground").
+		With(StandardSardisOperationSpec().
+			SetAction(func(ctx context.Context, conf *sardis.Configuration) error {
+				jobs := daemon.Jobs(&conf.Daemon, conf.Repos.GitRepos, conf.Operations.ExportAllCommands(), &conf.System)
+				if len(jobs) == 0 {
+					return errors.New("no scheduled jobs are configured")
+				}
+
+				ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+				defer cancel()
+
+				err := daemon.NewScheduler(&conf.Daemon, jobs).Service().Worker().Run(ctx)
+				if ers.IsExpiredContext(err) {
+					return nil
+				}
+				return err
+			}).Add).
+		Subcommanders(daemonStatus())
+}
+
+func daemonStatus() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("status").
+		SetUsage("report the next-run table of the running daemon").
+		With(cmdr.SpecBuilder(ResolveConfiguration).
+			SetAction(func(ctx context.Context, conf *sardis.Configuration) error {
+				state, err := daemon.ReadState(conf.Daemon.StatePath)
+				if os.IsNotExist(err) {
+					return fmt.Errorf("no daemon state at %q; is the daemon running?", conf.Daemon.StatePath)
+				} else if err != nil {
+					return err
+				}
+
+				fmt.Printf("pid %d on %s, updated %s ago\n\n", state.PID, state.Host, time.Since(state.UpdatedAt).Round(time.Second))
+
+				table := tabby.New()
+				table.AddHeader("Job", "Interval", "Next Run", "Last Run", "Status")
+
+				for _, js := range state.Jobs {
+					var status string
+					switch {
+					case js.Running:
+						status = "running"
+					case js.LastRun.IsZero():
+						status = "pending"
+					case js.LastError != "":
+						status = "failed: " + js.LastError
+					default:
+						status = "ok"
+					}
+
+					var next string
+					if js.Running {
+						next = "-"
+					} else {
+						next = fmt.Sprint("in ", time.Until(js.NextRun).Round(time.Second))
+					}
+
+					var last string
+					if !js.LastRun.IsZero() {
+						last = renderAge(time.Since(js.LastRun))
+					}
+
+					table.AddLine(js.ID, js.Interval, next, last, status)
+				}
+
+				table.Print()
+				return nil
+			}).Add)
+}
@@ -0,0 +1,120 @@
+package operations
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tychoish/cmdr"
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/sardis"
+	"github.com/tychoish/sardis/subexec"
+	"github.com/urfave/cli/v3"
+)
+
+// dryRunOptions are the values of the dry run flags. Operations
+// that support dry runs print the explanations of what they would
+// run, in the format, rather than running anything.
+type dryRunOptions struct {
+	enabled bool
+	format  string
+}
+
+func withDryRunFlags(cmd *cmdr.Commander) *cmdr.Commander {
+	return cmd.Flags(
+		cmdr.FlagBuilder(false).
+			SetName("dry-run").
+			SetUsage("print the resolved plan of the operation without running anything").
+			Flag(),
+		cmdr.FlagBuilder("text").
+			SetName("dry-run-format").
+			SetUsage("output format of the dry run: text|json").
+			Flag(),
+	)
+}
+
+func getDryRunOptions(cc *cli.Command) dryRunOptions {
+	return dryRunOptions{enabled: cc.Bool("dry-run"), format: cc.String("dry-run-format")}
+}
+
+type dryRunCtxKey struct{}
+
+func withDryRun(ctx context.Context, opts dryRunOptions) context.Context {
+	return context.WithValue(ctx, dryRunCtxKey{}, opts)
+}
+
+func getDryRun(ctx context.Context) dryRunOptions {
+	opts, _ := ctx.Value(dryRunCtxKey{}).(dryRunOptions)
+	return opts
+}
+
+type dryRunOperation struct {
+	conf   *sardis.Configuration
+	dryRun dryRunOptions
+}
+
+// dryRunOperationSpec is the StandardSardisOperationSpec for
+// operations with the dry run flags.
+func dryRunOperationSpec() *cmdr.OperationSpec[*dryRunOperation] {
+	return cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*dryRunOperation, error) {
+		conf, err := ResolveConfiguration(ctx, cc)
+		if err != nil {
+			return nil, err
+		}
+		return &dryRunOperation{conf: conf, dryRun: getDryRunOptions(cc)}, nil
+	}).SetMiddleware(func(ctx context.Context, op *dryRunOperation) context.Context {
+		return withDryRun(withOperationContext(ctx, op.conf), op.dryRun)
+	})
+}
+
+func writeExplanations(format string, exps []subexec.Explanation) error {
+	ec := &erc.Collector{}
+	buf := bufio.NewWriter(os.Stdout)
+
+	switch format {
+	case "JSON", "json", "js", "j":
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "    ")
+		ec.Push(enc.Encode(exps))
+	case "text":
+		fallthrough
+	default:
+		for idx, exp := range exps {
+			if idx > 0 {
+				erc.Must(fmt.Fprintln(buf))
+			}
+
+			erc.Must(fmt.Fprintf(buf, "[%d] %s\n", exp.Layer, exp.Name))
+			if exp.Directory != "" {
+				erc.Must(fmt.Fprintf(buf, "    dir:        %s\n", exp.Directory))
+			}
+			for _, env := range exp.Env {
+				if env.Defined {
+					erc.Must(fmt.Fprintf(buf, "    env:        %s=%s (was %s)\n", env.Name, env.Value, env.Previous))
+				} else {
+					erc.Must(fmt.Fprintf(buf, "    env:        %s=%s\n", env.Name, env.Value))
+				}
+			}
+			erc.Must(fmt.Fprintf(buf, "    background: %t\n", exp.Background))
+			erc.Must(fmt.Fprintf(buf, "    notify:     %t\n", exp.Notify))
+			if exp.Timeout != "" || exp.Retries > 0 {
+				erc.Must(fmt.Fprintf(buf, "    timeout:    %s (retries: %d)\n", exp.Timeout, exp.Retries))
+			}
+			if len(exp.Requires) > 0 {
+				erc.Must(fmt.Fprintf(buf, "    requires:   %s\n", strings.Join(exp.Requires, ", ")))
+			}
+			if exp.Operation != "" {
+				erc.Must(fmt.Fprintf(buf, "    operation:  %s\n", exp.Operation))
+			}
+			for _, line := range exp.Lines {
+				erc.Must(fmt.Fprintf(buf, "    $ %s\n", line))
+			}
+		}
+	}
+
+	ec.Push(buf.Flush())
+	return ec.Resolve()
+}
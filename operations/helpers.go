@@ -1,26 +1,36 @@
 package operations
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"io"
 	"os"
 	"strconv"
+	"text/tabwriter"
+
+	"github.com/cheynewallace/tabby"
 
 	"github.com/mattn/go-isatty"
 	"github.com/shirou/gopsutil/process"
 	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v2"
 
 	"github.com/tychoish/cmdr"
 	"github.com/tychoish/fun/erc"
 	"github.com/tychoish/grip"
 	"github.com/tychoish/grip/message"
 	"github.com/tychoish/sardis"
+	"github.com/tychoish/sardis/history"
+	"github.com/tychoish/sardis/retry"
 	"github.com/tychoish/sardis/srv"
 	"github.com/tychoish/sardis/subexec"
 )
 
 type withConf[T any] struct {
-	conf *sardis.Configuration
-	arg  T
+	conf   *sardis.Configuration
+	arg    T
+	dryRun dryRunOptions
 }
 
 func addOpCommand[T cmdr.FlagTypes](
@@ -36,14 +46,34 @@ func addOpCommand[T cmdr.FlagTypes](
 		withConfBuilderSpec[T](name),
 	).SetMiddleware(func(ctx context.Context, args *withConf[T]) context.Context {
 		erc.InvariantOk(args != nil, "must have non-nil args")
-		ctx = sardis.WithConfiguration(ctx, args.conf)
-		ctx = subexec.WithJasper(ctx, &args.conf.Operations)
-		ctx = srv.WithAppLogger(ctx, args.conf.Settings.Logging)
-		ctx = srv.WithRemoteNotify(ctx, args.conf.Settings)
-		return ctx
+		return withDryRun(withOperationContext(ctx, args.conf), args.dryRun)
 	}).SetAction(op).Add)
 }
 
+func withOperationContext(ctx context.Context, conf *sardis.Configuration) context.Context {
+	ctx = sardis.WithConfiguration(ctx, conf)
+	ctx = subexec.WithJasper(ctx, &conf.Operations)
+	ctx = srv.WithAppLogger(ctx, conf.Settings.Logging)
+	ctx = srv.WithRemoteNotify(ctx, conf.Settings)
+	ctx = withHistory(ctx, conf)
+	ctx = withRetryQueue(ctx, conf)
+	return ctx
+}
+
+func withHistory(ctx context.Context, conf *sardis.Configuration) context.Context {
+	if conf.Settings.History.Disabled || history.Context(ctx) != nil {
+		return ctx
+	}
+	return history.WithStore(ctx, history.NewStore(conf.Settings.History.Path))
+}
+
+func withRetryQueue(ctx context.Context, conf *sardis.Configuration) context.Context {
+	if conf.Settings.RetryQueue.Disabled || retry.Context(ctx) != nil {
+		return ctx
+	}
+	return retry.WithQueue(ctx, retry.NewQueue(conf.Settings.RetryQueue.Path))
+}
+
 func withConfBuilderSpec[T cmdr.FlagTypes](name string) cmdr.Hook[*withConf[T]] {
 	return func(ctx context.Context, cc *cli.Command) (*withConf[T], error) {
 		conf, err := ResolveConfiguration(ctx, cc)
@@ -56,7 +86,7 @@ func withConfBuilderSpec[T cmdr.FlagTypes](name string) cmdr.Hook[*withConf[T]]
 			return nil, err
 		}
 
-		return &withConf[T]{conf: conf, arg: arg}, nil
+		return &withConf[T]{conf: conf, arg: arg, dryRun: getDryRunOptions(cc)}, nil
 	}
 }
 
@@ -114,6 +144,36 @@ func embeddedFlag[T cmdr.FlagTypes](name string, cc *cli.Command) (zero T, _ err
 	return arg, nil
 }
 
+// writeFormatted writes the value to standard output as JSON or YAML,
+// depending on the format, and otherwise renders it with the text
+// function, which most reports use to print a table.
+func writeFormatted(format string, v any, text func(io.Writer) error) error {
+	ec := &erc.Collector{}
+	buf := bufio.NewWriter(os.Stdout)
+
+	switch format {
+	case "JSON", "json", "js", "j":
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "    ")
+		ec.Push(enc.Encode(v))
+	case "YAML", "yaml", "yml", "y":
+		enc := yaml.NewEncoder(buf)
+		ec.Push(enc.Encode(v))
+		ec.Push(enc.Close())
+	default:
+		ec.Push(text(buf))
+	}
+
+	ec.Push(buf.Flush())
+	return ec.Resolve()
+}
+
+// newTable returns a table that writes to w, with the same layout as
+// tabby.New.
+func newTable(w io.Writer) *tabby.Tabby {
+	return tabby.NewCustom(tabwriter.NewWriter(w, 0, 0, 2, ' ', 0))
+}
+
 type OperationRuntimeInfo struct {
 	ShouldBlock bool
 	TTY         bool
@@ -0,0 +1,209 @@
+package operations
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v2"
+
+	"github.com/tychoish/cmdr"
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/sardis"
+	"github.com/tychoish/sardis/history"
+)
+
+func History() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("history").
+		SetUsage("list and inspect past repository, command, and service runs").
+		Subcommanders(
+			historyList(),
+			historyShow(),
+		)
+}
+
+type historyListOptions struct {
+	conf   *sardis.Configuration
+	filter history.Filter
+	format string
+}
+
+func historyList() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("list").
+		Aliases("ls").
+		SetUsage("list past runs, most recent last").
+		Flags(
+			cmdr.FlagBuilder("").
+				SetName("op", "o").
+				SetUsage("only show runs of this operation (e.g. repo-fetch, repo-sync, command)").
+				Flag(),
+			cmdr.FlagBuilder("").
+				SetName("target", "t").
+				SetUsage("only show runs whose repository or command name contains this string").
+				Flag(),
+			cmdr.FlagBuilder("").
+				SetName("host").
+				SetUsage("only show runs from this host").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("failed").
+				SetUsage("only show runs that returned an error").
+				Flag(),
+			cmdr.FlagBuilder(time.Duration(0)).
+				SetName("since", "s").
+				SetUsage("only show runs started within this duration").
+				Flag(),
+			cmdr.FlagBuilder(32).
+				SetName("limit", "n").
+				SetUsage("maximum number of runs to show, 0 for all").
+				Flag(),
+			cmdr.FlagBuilder("table").
+				SetName("format", "f").
+				SetUsage("output format: table|json|yaml").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*historyListOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			opts := &historyListOptions{
+				conf:   conf,
+				format: cc.String("format"),
+				filter: history.Filter{
+					Op:         cc.String("op"),
+					Target:     cc.String("target"),
+					Host:       cc.String("host"),
+					FailedOnly: cc.Bool("failed"),
+					Limit:      cc.Int("limit"),
+				},
+			}
+
+			if since := cc.Duration("since"); since > 0 {
+				opts.filter.Since = time.Now().Add(-since)
+			}
+
+			return opts, nil
+		}).SetAction(func(ctx context.Context, opts *historyListOptions) error {
+			store, err := historyStore(opts.conf)
+			if err != nil {
+				return err
+			}
+
+			records, err := store.Read(opts.filter)
+			if err != nil {
+				return err
+			}
+
+			return writeHistoryReport(opts.format, records)
+		}).Add)
+}
+
+func historyShow() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("show").
+		SetUsage("show the details and captured output of a run, by id").
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*withConf[string], error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			if cc.Args().Len() != 1 {
+				return nil, fmt.Errorf("must specify exactly one run id, got %d", cc.Args().Len())
+			}
+
+			return &withConf[string]{conf: conf, arg: cc.Args().First()}, nil
+		}).SetAction(func(ctx context.Context, args *withConf[string]) error {
+			store, err := historyStore(args.conf)
+			if err != nil {
+				return err
+			}
+
+			rec, err := store.Find(args.arg)
+			if err != nil {
+				return err
+			}
+
+			buf := bufio.NewWriter(os.Stdout)
+			fmt.Fprintf(buf, "id:      %s\n", rec.ID)
+			fmt.Fprintf(buf, "op:      %s\n", rec.Op)
+			fmt.Fprintf(buf, "target:  %s\n", rec.Target)
+			fmt.Fprintf(buf, "host:    %s\n", rec.Host)
+			fmt.Fprintf(buf, "started: %s\n", rec.StartedAt.Format(time.RFC3339))
+			fmt.Fprintf(buf, "dur:     %s\n", rec.Duration)
+			fmt.Fprintf(buf, "success: %t\n", rec.Success)
+			if !rec.Success {
+				fmt.Fprintf(buf, "exit:    %d\n", rec.ExitCode)
+			}
+			if rec.Error != "" {
+				fmt.Fprintf(buf, "error:   %s\n", rec.Error)
+			}
+			if rec.Output != "" {
+				fmt.Fprintln(buf)
+				fmt.Fprint(buf, rec.Output)
+			}
+
+			return buf.Flush()
+		}).Add)
+}
+
+func historyStore(conf *sardis.Configuration) (*history.Store, error) {
+	if conf.Settings.History.Disabled {
+		return nil, errors.New("history is disabled in the configuration")
+	}
+
+	return history.NewStore(conf.Settings.History.Path), nil
+}
+
+func writeHistoryReport(format string, records []history.Record) error {
+	ec := &erc.Collector{}
+	buf := bufio.NewWriter(os.Stdout)
+
+	switch format {
+	case "JSON", "json", "js", "j":
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "    ")
+		ec.Push(enc.Encode(records))
+	case "YAML", "yaml", "yml", "y":
+		enc := yaml.NewEncoder(buf)
+		ec.Push(enc.Encode(records))
+		ec.Push(enc.Close())
+	case "table":
+		fallthrough
+	default:
+		table := tabby.New()
+		table.AddHeader("ID", "Started", "Op", "Target", "Host", "Dur", "Status")
+
+		for _, rec := range records {
+			status := "ok"
+			if !rec.Success {
+				status = fmt.Sprintf("failed (%d)", rec.ExitCode)
+			}
+
+			table.AddLine(
+				rec.ID,
+				rec.StartedAt.Format("2006-01-02 15:04:05"),
+				rec.Op,
+				rec.Target,
+				rec.Host,
+				rec.Duration.Round(time.Millisecond),
+				status,
+			)
+		}
+
+		table.Print()
+	}
+
+	ec.Push(buf.Flush())
+	return ec.Resolve()
+}
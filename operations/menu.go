@@ -36,25 +36,26 @@ import (
 const commandFlagName string = "command"
 
 func RunCommand() *cmdr.Commander {
-	return addOpCommand(cmdr.MakeCommander().
+	return addOpCommand(withDryRunFlags(cmdr.MakeCommander().
 		SetName("run").
 		Aliases("r").
 		SetUsage("runs a predefined command").
 		Subcommanders(
 			listCommands(),
-		),
+		)),
 		commandFlagName, func(ctx context.Context, args *withConf[[]string]) error {
-			cmds, err := subexec.FilterCommands(args.conf.Operations.ExportAllCommands(), args.arg)
+			names, params := subexec.SplitParamArgs(args.arg)
+			cmds, err := subexec.FilterCommands(args.conf.Operations.ExportAllCommands(), names)
 			if err != nil {
-				return ers.Wrapf(err, "resolving commands %s", args.arg)
+				return ers.Wrapf(err, "resolving commands %s", names)
 			}
 
-			return subexec.RunCommands(ctx, cmds)
+			return runCommands(ctx, args.conf, cmds, params, nil)
 		})
 }
 
 func SearchMenu() *cmdr.Commander {
-	return addOpCommand(cmdr.MakeCommander().
+	return addOpCommand(withDryRunFlags(cmdr.MakeCommander().
 		SetName("cmd").
 		SetUsage("list or run a command").
 		Aliases("c", "m", "cmds").
@@ -62,8 +63,9 @@ func SearchMenu() *cmdr.Commander {
 			fuzzy(),
 			searchCommand(),
 			listCommands(),
-		),
+		)),
 		"name", func(ctx context.Context, args *withConf[[]string]) error {
+			names, params := subexec.SplitParamArgs(args.arg)
 			if args.conf.Settings.Runtime.WithAnnotations {
 				erc.InvariantOk(len(args.conf.Settings.Runtime.AnnotationSeparator) > 0,
 					"annotation separator must be defined as something other than the empty string.")
@@ -71,22 +73,22 @@ func SearchMenu() *cmdr.Commander {
 				erc.InvariantOk(args.conf.Settings.Runtime.AnnotationSeparator != "\n",
 					"annotation separator must be defined as something other than a newline character.")
 
-				for idx, op := range args.arg {
+				for idx, op := range names {
 					if op == "" {
 						continue
 					}
-					args.arg[idx] = strings.SplitN(op, args.conf.Settings.Runtime.AnnotationSeparator, 1)[0]
+					names[idx] = strings.SplitN(op, args.conf.Settings.Runtime.AnnotationSeparator, 1)[0]
 				}
 			}
 
-			stage, err := args.conf.Operations.ResolveCommands(args.arg)
+			stage, err := args.conf.Operations.ResolveCommands(names)
 			var ops []string
 
 			switch {
 			case err != nil:
 				return err
 			case stage.Commands != nil:
-				return subexec.RunCommands(ctx, stage.Commands)
+				return runCommands(ctx, args.conf, stage.Commands, params, fzfParamPrompter())
 			case stage.Prefixed != nil:
 				ops = stage.Prefixed
 			case stage.Selections != nil:
@@ -255,7 +257,8 @@ func searchCommand() *cmdr.Commander {
 			fuzzy(),
 		),
 		"name", func(ctx context.Context, args *withConf[[]string]) error {
-			prefix := util.DotJoinParts(args.arg)
+			names, params := subexec.SplitParamArgs(args.arg)
+			prefix := util.DotJoinParts(names)
 			searchTree := args.conf.Operations.Tree().Find(prefix)
 
 			var options []string
@@ -266,11 +269,11 @@ func searchCommand() *cmdr.Commander {
 				cmd := searchTree.Command()
 
 				// hopefully logging for this all goes to standard err and not stdout 😬
-				if err := subexec.RunCommands(ctx, stw.SliceRefs([]*subexec.Command{cmd})); err != nil {
+				if err := runCommands(ctx, args.conf, stw.SliceRefs([]*subexec.Command{cmd}), params, fzfParamPrompter()); err != nil {
 					return fmt.Errorf("problem running command %s, %w; missed running children %s", cmd.Name, err, prefix)
 				}
 			case searchTree.HasCommand():
-				return subexec.RunCommands(ctx, stw.SliceRefs([]*subexec.Command{searchTree.Command()}))
+				return runCommands(ctx, args.conf, stw.SliceRefs([]*subexec.Command{searchTree.Command()}), params, fzfParamPrompter())
 			case !searchTree.HasChidren():
 				return fmt.Errorf("no further selections at %q", prefix)
 			}
@@ -299,7 +302,7 @@ func fuzzy() *cmdr.Commander {
 			),
 		"name",
 		func(ctx context.Context, args *withConf[[]string]) error {
-			op := args.arg
+			op, params := subexec.SplitParamArgs(args.arg)
 
 			prompt := new(dt.List[string])
 			prompt.PushBack(util.GetHostname())
@@ -312,7 +315,9 @@ func fuzzy() *cmdr.Commander {
 				case err != nil:
 					return err
 				case stage.Commands != nil:
-					err, ranFor := util.DoWithTiming(func() error { return subexec.RunCommands(ctx, stage.Commands) })
+					err, ranFor := util.DoWithTiming(func() error {
+						return runCommands(ctx, args.conf, stage.Commands, params, fzfParamPrompter())
+					})
 
 					waitedFor := util.CallWithTiming(func() {
 						if opr.ShouldBlock && err == nil {
@@ -381,11 +386,11 @@ func fuzzySearch() *cmdr.Commander {
 				case searchTree == nil:
 					return fmt.Errorf("no command found at level %d, ", ct)
 				case searchTree.HasCommand() && searchTree.HasChidren():
-					if err := subexec.RunCommands(ctx, stw.SliceRefs([]*subexec.Command{searchTree.Command()})); err != nil {
+					if err := runCommands(ctx, args.conf, stw.SliceRefs([]*subexec.Command{searchTree.Command()}), nil, fzfParamPrompter()); err != nil {
 						return err
 					}
 				case searchTree.HasCommand():
-					return subexec.RunCommands(ctx, stw.SliceRefs([]*subexec.Command{searchTree.Command()}))
+					return runCommands(ctx, args.conf, stw.SliceRefs([]*subexec.Command{searchTree.Command()}), nil, fzfParamPrompter())
 				case !searchTree.HasChidren():
 					return fmt.Errorf("no further selections at level %d", ct)
 				}
@@ -414,7 +419,7 @@ func fuzzySearch() *cmdr.Commander {
 
 				searchTree = nextSearch
 				if len(cmds) > 0 {
-					if err := subexec.RunCommands(ctx, slices.Collect(util.MakeSparseRefs(slices.Values(cmds)))); err != nil {
+					if err := runCommands(ctx, args.conf, slices.Collect(util.MakeSparseRefs(slices.Values(cmds))), nil, fzfParamPrompter()); err != nil {
 						return err
 					}
 					if searchTree.Len() == 0 {
@@ -427,7 +432,7 @@ func fuzzySearch() *cmdr.Commander {
 }
 
 func DMenu() *cmdr.Commander {
-	return addOpCommand(cmdr.MakeCommander().
+	return addOpCommand(withDryRunFlags(cmdr.MakeCommander().
 		SetName("dmenu").
 		Aliases("d", "menu").
 		SetUsage("unless running a subcommand, launches a menu for specific group specific group, or attmepts to run a command directly.").
@@ -435,9 +440,9 @@ func DMenu() *cmdr.Commander {
 			dmenuSearch(),
 			listCommands(),
 			ExecCommand(),
-		),
+		)),
 		commandFlagName, func(ctx context.Context, args *withConf[[]string]) error {
-			op := args.arg
+			op, params := subexec.SplitParamArgs(args.arg)
 			var selected string
 
 			for {
@@ -446,7 +451,11 @@ func DMenu() *cmdr.Commander {
 				case err != nil:
 					return err
 				case stage.Commands != nil:
-					return subexec.RunCommands(ctx, stage.Commands)
+					err := runCommands(ctx, args.conf, stage.Commands, params, dmenuParamPrompter(args.conf))
+					if ers.Is(err, godmenu.ErrSelectionMissing) {
+						return nil
+					}
+					return err
 				case stage.Selections != nil:
 					selected, err = godmenu.Run(ctx,
 						godmenu.SetSelections(stage.Selections),
@@ -499,12 +508,12 @@ func dmenuSearch() *cmdr.Commander {
 					return fmt.Errorf("no command found named %s []", util.DotJoin(pathSlice...))
 				case searchTree.HasCommand() && searchTree.HasChidren():
 					if path.Len() > 0 && searchTree.ID() == path.Back().Value() {
-						if err := subexec.RunCommands(ctx, stw.SliceRefs([]*subexec.Command{searchTree.Command()})); err != nil {
+						if err := runCommands(ctx, args.conf, stw.SliceRefs([]*subexec.Command{searchTree.Command()}), nil, dmenuParamPrompter(args.conf)); err != nil {
 							return err
 						}
 					}
 				case searchTree.HasCommand():
-					return subexec.RunCommands(ctx, stw.SliceRefs([]*subexec.Command{searchTree.Command()}))
+					return runCommands(ctx, args.conf, stw.SliceRefs([]*subexec.Command{searchTree.Command()}), nil, dmenuParamPrompter(args.conf))
 				case !searchTree.HasChidren():
 					pathSlice := irt.Collect(func(yield func(string) bool) {
 						for elem := path.Front(); elem != nil; elem = elem.Next() {
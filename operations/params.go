@@ -0,0 +1,186 @@
+package operations
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	fzf "github.com/koki-develop/go-fzf"
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/stw"
+	"github.com/tychoish/godmenu"
+	"github.com/tychoish/sardis"
+	"github.com/tychoish/sardis/subexec"
+)
+
+// paramPrompter asks the user for the value of a parameter, offering
+// the choices (if any) with the default first. When strict is true
+// the value must be one of the choices.
+type paramPrompter func(ctx context.Context, label string, choices []string, def string, strict bool) (string, error)
+
+func dmenuParamPrompter(conf *sardis.Configuration) paramPrompter {
+	return func(ctx context.Context, label string, choices []string, def string, strict bool) (string, error) {
+		selections := withDefaultFirst(choices, def)
+		return godmenu.Run(ctx,
+			godmenu.SetSelections(selections),
+			godmenu.SetMatchRequirement(strict),
+			godmenu.WithFlags(stw.Ptr(conf.Settings.DMenuFlags)),
+			godmenu.Prompt(fmt.Sprintf("%s ==>>", label)),
+			godmenu.MenuLines(max(1, min(len(selections), conf.Settings.DMenuFlags.Lines))),
+		)
+	}
+}
+
+func fzfParamPrompter() paramPrompter {
+	return func(ctx context.Context, label string, choices []string, def string, strict bool) (string, error) {
+		if len(choices) == 0 {
+			return readParamLine(label, def)
+		}
+
+		selections := withDefaultFirst(choices, def)
+		idxs, err := erc.Must(fzf.New(
+			fzf.WithPrompt(fmt.Sprintf("%s =>> ", label)),
+			fzf.WithLimit(1),
+			fzf.WithCaseSensitive(false),
+		)).Find(selections, func(idx int) string { return selections[idx] })
+		switch {
+		case err != nil:
+			return "", fmt.Errorf("selecting %s: %w", label, err)
+		case len(idxs) == 0:
+			return def, nil
+		default:
+			return selections[idxs[0]], nil
+		}
+	}
+}
+
+// readParamLine prompts on standard error and reads the value from
+// standard input, returning the default for empty lines.
+func readParamLine(label, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", label)
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading %s: %w", label, err)
+	}
+
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func withDefaultFirst(choices []string, def string) []string {
+	if def == "" {
+		return choices
+	}
+	return append([]string{def}, slices.DeleteFunc(slices.Clone(choices), func(c string) bool { return c == def })...)
+}
+
+func paramChoices(ctx context.Context, conf *sardis.Configuration, cmd *subexec.Command, p *subexec.Param) ([]string, error) {
+	choices, err := p.ListChoices(ctx, cmd.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(choices) == 0 && p.Type == subexec.ParamRepo {
+		for _, repo := range conf.Repos.GitRepos {
+			choices = append(choices, repo.Name)
+		}
+	}
+
+	return choices, nil
+}
+
+// bindCommands binds the parameter values to the commands, prompting
+// for the parameters that do not have values when there is a
+// prompter. Values that are not a parameter of any of the commands
+// are an error.
+func bindCommands(ctx context.Context, conf *sardis.Configuration, cmds stw.Slice[subexec.Command], values map[string]string, prompt paramPrompter) (stw.Slice[subexec.Command], error) {
+	used := map[string]bool{}
+	out := make(stw.Slice[subexec.Command], 0, len(cmds))
+
+	for idx := range cmds {
+		cmd := &cmds[idx]
+		if !cmd.HasParams() {
+			out = append(out, *cmd)
+			continue
+		}
+
+		bound := make(map[string]string, len(cmd.Params))
+		for pidx := range cmd.Params {
+			p := &cmd.Params[pidx]
+			if value, ok := values[p.Name]; ok {
+				used[p.Name] = true
+				bound[p.Name] = value
+				continue
+			}
+
+			if prompt == nil {
+				continue
+			}
+
+			choices, err := paramChoices(ctx, conf, cmd, p)
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := prompt(ctx, fmt.Sprintf("%s.%s", cmd.Name, p.Label()), choices, p.Default, p.Type == subexec.ParamEnum || p.Type == subexec.ParamRepo)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q of %q: %w", p.Name, cmd.Name, err)
+			}
+
+			// an empty answer is no answer: the parameter
+			// gets its default, or is missing.
+			if value != "" {
+				bound[p.Name] = value
+			}
+		}
+
+		bcmd, err := cmd.Bind(bound)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *bcmd)
+	}
+
+	ec := &erc.Collector{}
+	for name := range values {
+		ec.Whenf(!used[name], "%q is not a parameter of any of the %d commands", name, len(out))
+	}
+
+	return out, ec.Resolve()
+}
+
+// runCommands binds and runs the commands, or for dry runs, prints
+// the explanations of the commands. Dry runs do not prompt, and so
+// never run choices_from commands: parameters without values get
+// their defaults, or are missing.
+func runCommands(ctx context.Context, conf *sardis.Configuration, cmds stw.Slice[subexec.Command], values map[string]string, prompt paramPrompter) error {
+	dr := getDryRun(ctx)
+	if dr.enabled {
+		prompt = nil
+	}
+
+	cmds, err := bindCommands(ctx, conf, cmds, values, prompt)
+	if err != nil {
+		return err
+	}
+
+	if dr.enabled {
+		exps, err := conf.Operations.Explain(cmds)
+		if err != nil {
+			return err
+		}
+		return writeExplanations(dr.format, exps)
+	}
+
+	return conf.Operations.RunCommands(ctx, cmds)
+}
@@ -0,0 +1,194 @@
+package operations
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v2"
+
+	"github.com/tychoish/cmdr"
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/sardis"
+	"github.com/tychoish/sardis/repo"
+	"github.com/tychoish/sardis/retry"
+)
+
+func Queue() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("queue").
+		SetUsage("inspect and retry network operations deferred while offline").
+		Subcommanders(
+			queueList(),
+			queueRun(),
+			queueClear(),
+		)
+}
+
+type queueListOptions struct {
+	conf   *sardis.Configuration
+	format string
+	failed bool
+}
+
+func queueList() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("list").
+		Aliases("ls").
+		SetUsage("list pending and failed operations, in the order they will be retried").
+		Flags(
+			cmdr.FlagBuilder(false).
+				SetName("failed").
+				SetUsage("only show operations that will not be retried").
+				Flag(),
+			cmdr.FlagBuilder("table").
+				SetName("format", "f").
+				SetUsage("output format: table|json|yaml").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*queueListOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			return &queueListOptions{
+				conf:   conf,
+				format: cc.String("format"),
+				failed: cc.Bool("failed"),
+			}, nil
+		}).SetAction(func(ctx context.Context, opts *queueListOptions) error {
+			q, err := retryQueue(opts.conf)
+			if err != nil {
+				return err
+			}
+
+			items, err := q.Read()
+			if err != nil {
+				return err
+			}
+
+			if opts.failed {
+				items = slices.DeleteFunc(items, func(item retry.Item) bool { return item.State != retry.StateFailed })
+			}
+
+			return writeQueueReport(opts.format, items)
+		}).Add)
+}
+
+func queueRun() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("run").
+		SetUsage("retry the pending operations that are due, if their remotes are reachable").
+		With(StandardSardisOperationSpec().
+			SetAction(func(ctx context.Context, conf *sardis.Configuration) error {
+				if _, err := retryQueue(conf); err != nil {
+					return err
+				}
+
+				return repo.RetryJob(conf.Repos.GitRepos).Run(ctx)
+			}).Add)
+}
+
+type queueClearOptions struct {
+	conf *sardis.Configuration
+	all  bool
+}
+
+func queueClear() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("clear").
+		SetUsage("remove failed operations from the queue").
+		Flags(
+			cmdr.FlagBuilder(false).
+				SetName("all").
+				SetUsage("also remove pending operations").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*queueClearOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			return &queueClearOptions{conf: conf, all: cc.Bool("all")}, nil
+		}).SetAction(func(ctx context.Context, opts *queueClearOptions) error {
+			q, err := retryQueue(opts.conf)
+			if err != nil {
+				return err
+			}
+
+			return q.Update(func(items []retry.Item) []retry.Item {
+				return slices.DeleteFunc(items, func(item retry.Item) bool {
+					return opts.all || item.State == retry.StateFailed
+				})
+			})
+		}).Add)
+}
+
+func retryQueue(conf *sardis.Configuration) (*retry.Queue, error) {
+	if conf.Settings.RetryQueue.Disabled {
+		return nil, errors.New("the retry queue is disabled in the configuration")
+	}
+
+	return retry.NewQueue(conf.Settings.RetryQueue.Path), nil
+}
+
+func writeQueueReport(format string, items []retry.Item) error {
+	ec := &erc.Collector{}
+	buf := bufio.NewWriter(os.Stdout)
+
+	switch format {
+	case "JSON", "json", "js", "j":
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "    ")
+		ec.Push(enc.Encode(items))
+	case "YAML", "yaml", "yml", "y":
+		enc := yaml.NewEncoder(buf)
+		ec.Push(enc.Encode(items))
+		ec.Push(enc.Close())
+	case "table":
+		fallthrough
+	default:
+		table := tabby.New()
+		table.AddHeader("ID", "Op", "Repo", "Host", "State", "Attempts", "Deferred", "Next Attempt", "Error")
+
+		for _, item := range items {
+			next := ""
+			if item.State == retry.StatePending {
+				next = renderUntil(time.Until(item.NextAttemptAt))
+			}
+
+			table.AddLine(
+				item.ID,
+				item.Op,
+				item.Target,
+				item.Host,
+				item.State,
+				item.Attempts,
+				renderAge(time.Since(item.DeferredAt)),
+				next,
+				item.Error,
+			)
+		}
+
+		table.Print()
+	}
+
+	ec.Push(buf.Flush())
+	return ec.Resolve()
+}
+
+func renderUntil(dur time.Duration) string {
+	if dur <= 0 {
+		return "now"
+	}
+	return fmt.Sprint("in ", dur.Round(time.Second))
+}
@@ -1,23 +1,38 @@
 package operations
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/cheynewallace/tabby"
 	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v2"
 
 	"github.com/tychoish/cmdr"
 	"github.com/tychoish/fun/erc"
 	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/fun/opt"
+	"github.com/tychoish/fun/wpa"
 	"github.com/tychoish/grip"
 	"github.com/tychoish/grip/level"
 	"github.com/tychoish/grip/message"
 	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis"
+	"github.com/tychoish/sardis/global"
 	"github.com/tychoish/sardis/repo"
 	"github.com/tychoish/sardis/subexec"
 	"github.com/tychoish/sardis/util"
@@ -35,6 +50,12 @@ func Repo() *cmdr.Commander {
 			repoCleanup(),
 			repoStatus(),
 			repoFetch(),
+			repoDiscover(),
+			repoAdd(),
+			repoRemove(),
+			repoForeach(),
+			repoDoctor(),
+			repoWorktree(),
 		)
 }
 
@@ -55,7 +76,10 @@ func repoList() *cmdr.Commander {
 			if len(args.arg) == 0 {
 				repos = args.conf.Repos.GitRepos.Copy()
 			} else {
-				repos = args.conf.Repos.FindAll(args.arg...)
+				var err error
+				if repos, err = args.conf.Repos.Select(args.arg...); err != nil {
+					return err
+				}
 			}
 
 			sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
@@ -78,79 +102,293 @@ func repoList() *cmdr.Commander {
 }
 
 func repoUpdate() *cmdr.Commander {
-	const opName = "repo-update"
-
-	return addOpCommand(
+	return repoPullCommand(
 		cmdr.MakeCommander().
 			SetName("update").
 			Aliases("sync"),
-		"repo", func(ctx context.Context, args *withConf[[]string]) error {
-			ct := &atomic.Int64{}
+		"update",
+		func(rc repo.GitRepository) fnx.Worker { return rc.UpdateJob() },
+	)
+}
 
-			repos := args.conf.Repos.FindAll(args.arg...)
+type repoPullOptions struct {
+	conf   *sardis.Configuration
+	repos  []string
+	digest bool
+	stat   bool
+	dryRun dryRunOptions
+}
 
-			jobs := func(yield func(fnx.Worker) bool) {
+// repoPullCommand builds the commands that pull changes into
+// repositories in dependency order, and report a digest of the pulled
+// commits. The pull function returns nil for repositories that should
+// be skipped; op names the operation for dry runs.
+func repoPullCommand(cmd *cmdr.Commander, op string, pull func(repo.GitRepository) fnx.Worker) *cmdr.Commander {
+	return withDryRunFlags(cmd).
+		Flags(
+			cmdr.FlagBuilder(true).
+				SetName("digest").
+				SetUsage("print a digest of the pulled commits").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("stat").
+				SetUsage("include a diffstat in the digest").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*repoPullOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			return &repoPullOptions{
+				conf:   conf,
+				repos:  cc.Args().Slice(),
+				digest: cc.Bool("digest"),
+				stat:   cc.Bool("stat"),
+				dryRun: getDryRunOptions(cc),
+			}, nil
+		}).SetMiddleware(func(ctx context.Context, opts *repoPullOptions) context.Context {
+			return withOperationContext(ctx, opts.conf)
+		}).SetAction(func(ctx context.Context, opts *repoPullOptions) error {
+			repos, err := opts.conf.Repos.Select(opts.repos...)
+			if err != nil {
+				return err
+			}
+
+			if opts.dryRun.enabled {
+				var exps []subexec.Explanation
 				for _, rc := range repos {
-					ct.Add(1)
-					if !yield(rc.UpdateJob()) {
-						return
+					if pull(rc) != nil {
+						exps = append(exps, rc.Explain(op, nil))
 					}
 				}
+				if len(exps) == 0 {
+					return fmt.Errorf("no repositories for %s", opts.repos)
+				}
+				return writeExplanations(opts.dryRun.format, exps)
+			}
+
+			ct := &atomic.Int64{}
+			job := func(rc repo.GitRepository) fnx.Worker {
+				wf := pull(rc)
+				if wf != nil {
+					ct.Add(1)
+				}
+				return wf
+			}
+
+			digests := &repo.DigestCollector{Stat: opts.stat}
+			err = digests.Worker(repo.BatchJob(repos, job)).Run(ctx)
+
+			if report := digests.Report(); opts.digest && report != "" {
+				fmt.Print(report)
 			}
 
-			err := subexec.TOOLS.WorkerPool(jobs).Run(ctx)
 			switch {
 			case ct.Load() == 0:
-				return fmt.Errorf("no repositories for %s", args.arg)
+				return fmt.Errorf("no repositories for %s", opts.repos)
 			case err != nil:
 				return err
 			default:
 				return nil
 			}
-		},
-	)
+		}).Add)
+}
+
+type repoCleanupOptions struct {
+	conf   *sardis.Configuration
+	repos  []string
+	modes  []repo.CleanupMode
+	report bool
+	format string
+	dryRun dryRunOptions
 }
 
 func repoCleanup() *cmdr.Commander {
-	return addOpCommand(
-		cmdr.MakeCommander().
-			SetName("gc").
-			Aliases("cleanup").
-			SetUsage("run repository cleanup"),
-		"repo", func(ctx context.Context, args *withConf[[]string]) error {
-			repos := args.conf.Repos.FindAll(args.arg...)
+	return withDryRunFlags(cmdr.MakeCommander()).
+		SetName("gc").
+		Aliases("cleanup").
+		SetUsage("run repository cleanup").
+		Flags(
+			cmdr.FlagBuilder("").
+				SetName("mode", "m").
+				SetUsage("comma separated cleanup modes (gc, maintenance, remotes, reflog, branches, or all), defaults to the configured modes").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("report").
+				SetUsage("report the space reclaimed in each repository").
+				Flag(),
+			cmdr.FlagBuilder("table").
+				SetName("format", "f").
+				SetUsage("report format: table|json|yaml").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*repoCleanupOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
 
-			ct := &atomic.Int64{}
+			modes, err := repo.ParseCleanupModes(cc.String("mode"))
+			if err != nil {
+				return nil, err
+			}
 
-			jobs := func(yield func(fnx.Worker) bool) {
+			return &repoCleanupOptions{
+				conf:   conf,
+				repos:  cc.Args().Slice(),
+				modes:  modes,
+				report: cc.Bool("report"),
+				format: cc.String("format"),
+				dryRun: getDryRunOptions(cc),
+			}, nil
+		}).SetMiddleware(func(ctx context.Context, opts *repoCleanupOptions) context.Context {
+			return withOperationContext(ctx, opts.conf)
+		}).SetAction(func(ctx context.Context, opts *repoCleanupOptions) error {
+			repos, err := opts.conf.Repos.Select(opts.repos...)
+			if err != nil {
+				return err
+			}
+			if len(repos) == 0 {
+				return fmt.Errorf("no repositories for %s", opts.repos)
+			}
+
+			if opts.dryRun.enabled {
+				exps := make([]subexec.Explanation, 0, len(repos))
 				for _, rc := range repos {
-					ct.Add(1)
-					if !yield(rc.CleanupJob()) {
+					exps = append(exps, rc.Explain("cleanup", opts.modes))
+				}
+				return writeExplanations(opts.dryRun.format, exps)
+			}
+
+			results := make([]repo.CleanupResult, len(repos))
+
+			jobs := func(yield func(fnx.Worker) bool) {
+				for idx := range repos {
+					if !yield(repos[idx].CleanupReportJob(opts.modes, &results[idx])) {
 						return
 					}
 				}
 			}
 
-			err := subexec.TOOLS.WorkerPool(jobs).Run(ctx)
-			switch {
-			case ct.Load() == 0:
-				return fmt.Errorf("no repositories for %s", args.arg)
-			case err != nil:
-				return err
-			default:
-				return nil
+			err = subexec.TOOLS.WorkerPool(jobs).Run(ctx)
+
+			if opts.report {
+				// repositories that never started (because an
+				// earlier job failed) have no result.
+				results = slices.DeleteFunc(results, func(res repo.CleanupResult) bool { return res.Repo == "" })
+				sort.Slice(results, func(i, j int) bool { return results[i].Repo < results[j].Repo })
+
+				if rerr := writeRepoCleanupReport(opts.format, results); rerr != nil {
+					return rerr
+				}
 			}
-		},
-	)
+
+			return err
+		}).Add)
+}
+
+func writeRepoCleanupReport(format string, results []repo.CleanupResult) error {
+	ec := &erc.Collector{}
+	buf := bufio.NewWriter(os.Stdout)
+
+	var total int64
+	for idx := range results {
+		total += results[idx].Reclaimed()
+	}
+
+	report := struct {
+		Repos     []repo.CleanupResult `json:"repos" yaml:"repos"`
+		Reclaimed int64                `json:"reclaimed" yaml:"reclaimed"`
+	}{Repos: results, Reclaimed: total}
+
+	switch format {
+	case "JSON", "json", "js", "j":
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "    ")
+		ec.Push(enc.Encode(report))
+	case "YAML", "yaml", "yml", "y":
+		enc := yaml.NewEncoder(buf)
+		ec.Push(enc.Encode(report))
+		ec.Push(enc.Close())
+	case "table":
+		fallthrough
+	default:
+		table := tabby.New()
+		table.AddHeader("Name", "Modes", "Before", "After", "Reclaimed", "Objects", "Packs", "Deleted", "Error")
+
+		for _, res := range results {
+			modes := make([]string, 0, len(res.Modes))
+			for _, mode := range res.Modes {
+				modes = append(modes, string(mode))
+			}
+
+			table.AddLine(
+				res.Repo,
+				strings.Join(modes, ","),
+				renderBytes(res.Before.Bytes),
+				renderBytes(res.After.Bytes),
+				renderBytes(res.Reclaimed()),
+				fmt.Sprintf("%d -> %d", res.Before.Objects(), res.After.Objects()),
+				fmt.Sprintf("%d -> %d", res.Before.Packs, res.After.Packs),
+				len(res.Deleted),
+				res.Error,
+			)
+		}
+
+		table.AddLine("total", "", "", "", renderBytes(total), "", "", "", "")
+		table.Print()
+	}
+
+	ec.Push(buf.Flush())
+	return ec.Resolve()
 }
 
 func repoClone() *cmdr.Commander {
 	return addOpCommand(
-		cmdr.MakeCommander().
+		withDryRunFlags(cmdr.MakeCommander().
 			SetName("clone").
-			SetUsage("clone a repository or all matching repositories"),
+			SetUsage("clone a repository or all matching repositories, or clone <forge>:<account>/<name> into the current directory")),
 		"repo", func(ctx context.Context, args *withConf[[]string]) error {
-			repos := args.conf.Repos.FindAll(args.arg...)
+			var selectors []string
+			var remotes []string
+			for _, arg := range args.arg {
+				if _, err := args.conf.Repos.FindOne(arg); err != nil && strings.Contains(arg, ":") {
+					remotes = append(remotes, arg)
+					continue
+				}
+				selectors = append(selectors, arg)
+			}
+
+			repos, err := args.conf.Repos.Select(selectors...)
+			if err != nil {
+				return err
+			}
+
+			urls := make([]string, 0, len(remotes))
+			for _, spec := range remotes {
+				remote, err := args.conf.Repos.ParseRemote(spec)
+				if err != nil {
+					return err
+				}
+				urls = append(urls, remote.URL)
+			}
+
+			if args.dryRun.enabled {
+				var exps []subexec.Explanation
+				for _, rc := range repos {
+					if !util.FileExists(rc.Path) {
+						exps = append(exps, rc.Explain("clone", nil))
+					}
+				}
+				for _, url := range urls {
+					exp := subexec.ExplainOperation(util.DotJoin("repo", "clone", url), ".", fmt.Sprintf("clone %s into the working directory", url))
+					exp.Lines = []string{"git clone " + url}
+					exps = append(exps, exp)
+				}
+				return writeExplanations(args.dryRun.format, exps)
+			}
 
 			jobs := func(yield func(fnx.Worker) bool) {
 				for _, rc := range repos {
@@ -166,12 +404,35 @@ func repoClone() *cmdr.Commander {
 						})
 					}
 				}
+
+				for _, url := range urls {
+					if !yield(cloneRemote(url, "")) {
+						return
+					}
+				}
 			}
 
 			return subexec.TOOLS.WorkerPool(jobs).Run(ctx)
 		})
 }
 
+// cloneRemote clones a repository that is not in the configuration
+// into the directory, or the working directory.
+func cloneRemote(url, dir string) fnx.Worker {
+	return func(ctx context.Context) error {
+		grip.Notice(message.Fields{
+			"op":     "clone",
+			"remote": url,
+			"dir":    util.Default(dir, "."),
+		})
+
+		return jasper.Context(ctx).CreateCommand(ctx).
+			Directory(dir).
+			SetCombinedSender(level.Debug, grip.Sender()).
+			AppendArgs("git", "clone", url).Run(ctx)
+	}
+}
+
 func fallbackTo[T comparable](first T, args ...T) (out T) {
 	if first != out {
 		return first
@@ -185,78 +446,842 @@ func fallbackTo[T comparable](first T, args ...T) (out T) {
 	return out
 }
 
+type repoStatusOptions struct {
+	conf   *sardis.Configuration
+	repos  []string
+	format string
+	dirty  bool
+	behind bool
+}
+
 func repoStatus() *cmdr.Commander {
-	return addOpCommand(
-		cmdr.MakeCommander().
-			SetName("status").
-			SetUsage("report on the status of repos"),
-		"repo", func(ctx context.Context, args *withConf[[]string]) error {
-			repos := args.conf.Repos.FindAll(args.arg...)
+	return cmdr.MakeCommander().
+		SetName("status").
+		SetUsage("report on the status of repos").
+		Flags(
+			cmdr.FlagBuilder("table").
+				SetName("format", "f").
+				SetUsage("output format: table|json|yaml").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("dirty").
+				SetUsage("only report repositories with uncommitted or untracked changes").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("behind").
+				SetUsage("only report repositories that are behind their remote branch").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*repoStatusOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
 
-			ct := &atomic.Int64{}
+			return &repoStatusOptions{
+				conf:   conf,
+				repos:  cc.Args().Slice(),
+				format: cc.String("format"),
+				dirty:  cc.Bool("dirty"),
+				behind: cc.Bool("behind"),
+			}, nil
+		}).SetMiddleware(func(ctx context.Context, opts *repoStatusOptions) context.Context {
+			return withOperationContext(ctx, opts.conf)
+		}).SetAction(func(ctx context.Context, opts *repoStatusOptions) error {
+			var repos []repo.GitRepository
+			if len(opts.repos) == 0 {
+				repos = opts.conf.Repos.GitRepos.Copy()
+			} else {
+				var err error
+				if repos, err = opts.conf.Repos.Select(opts.repos...); err != nil {
+					return err
+				}
+			}
+
+			if len(repos) == 0 {
+				return fmt.Errorf("no repositories for %s", opts.repos)
+			}
+
+			results := make([][]*repo.Status, len(repos))
 
 			jobs := func(yield func(fnx.Worker) bool) {
-				for _, rc := range repos {
-					ct.Add(1)
-					if !yield(rc.StatusJob()) {
+				for idx := range repos {
+					rc := repos[idx]
+					if !yield(func(context.Context) error {
+						stat, err := rc.Status()
+						if err != nil {
+							stat.Error = err.Error()
+						}
+						results[idx] = append(results[idx], stat)
+
+						worktrees, err := rc.Worktrees()
+						if err != nil {
+							stat.Error = util.Default(stat.Error, err.Error())
+						}
+
+						for _, wt := range worktrees {
+							wrc := rc.WorktreeRepository(wt)
+							stat, err := wrc.Status()
+							if err != nil {
+								stat.Error = err.Error()
+							}
+							results[idx] = append(results[idx], stat)
+						}
+						return nil
+					}) {
 						return
 					}
 				}
 			}
 
-			err := subexec.TOOLS.WorkerPool(jobs).Run(ctx)
-			switch {
-			case ct.Load() == 0:
-				return fmt.Errorf("no repositories for %s", args.arg)
-			case err != nil:
+			if err := subexec.TOOLS.WorkerPool(jobs).Run(ctx); err != nil {
 				return err
+			}
+
+			report := slices.Concat(results...)
+			// the filters never hide repositories that could not
+			// be inspected, so that errors are always reported.
+			report = slices.DeleteFunc(report, func(stat *repo.Status) bool {
+				if stat.Missing || stat.Error != "" {
+					return false
+				}
+				return (opts.dirty && !stat.IsDirty()) || (opts.behind && !stat.IsBehind())
+			})
+			sort.Slice(report, func(i, j int) bool { return report[i].Name < report[j].Name })
+
+			return writeRepoStatusReport(opts.format, report)
+		}).Add)
+}
+
+func writeRepoStatusReport(format string, report []*repo.Status) error {
+	ec := &erc.Collector{}
+	buf := bufio.NewWriter(os.Stdout)
+
+	switch format {
+	case "JSON", "json", "js", "j":
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "    ")
+		ec.Push(enc.Encode(report))
+	case "YAML", "yaml", "yml", "y":
+		enc := yaml.NewEncoder(buf)
+		ec.Push(enc.Encode(report))
+		ec.Push(enc.Close())
+	case "table":
+		fallthrough
+	default:
+		table := tabby.New()
+		table.AddHeader("Name", "Branch", "Tracking", "Ahead", "Behind", "Dirty", "Untracked", "Stashes", "Last Commit")
+
+		for _, stat := range report {
+			switch {
+			case stat.Missing:
+				table.AddLine(stat.Name, "<missing>", stat.Tracking, "", "", "", "", "", "")
+			case stat.Error != "":
+				table.AddLine(stat.Name, "<error>", stat.Error, "", "", "", "", "", "")
 			default:
-				return nil
+				table.AddLine(
+					stat.Name,
+					stat.Branch,
+					stat.Tracking,
+					stat.Ahead,
+					stat.Behind,
+					stat.Dirty,
+					stat.Untracked,
+					stat.Stashes,
+					renderAge(stat.LastCommitAge()),
+				)
 			}
-		},
-	)
+		}
+
+		table.Print()
+	}
+
+	ec.Push(buf.Flush())
+	return ec.Resolve()
 }
 
-func repoFetch() *cmdr.Commander {
-	return addOpCommand(
-		cmdr.MakeCommander().
-			SetName("fetch").
-			SetUsage("fetch one or more repos"),
-		"repo", func(ctx context.Context, args *withConf[[]string]) error {
-			repos := args.conf.Repos.FindAll(args.arg...)
+func renderBytes(size int64) string {
+	const unit = 1024
+	abs := max(size, -size)
+	if abs < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := abs / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func renderAge(dur time.Duration) string {
+	switch {
+	case dur <= 0:
+		return ""
+	case dur < time.Hour:
+		return fmt.Sprintf("%dm", int(dur.Minutes()))
+	case dur < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(dur.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(dur.Hours()/24))
+	}
+}
+
+type repoDoctorOptions struct {
+	conf   *sardis.Configuration
+	repos  []string
+	format string
+	fix    bool
+}
+
+func repoDoctor() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("doctor").
+		SetUsage("compare repository checkouts with their configuration, and optionally repair them").
+		Flags(
+			cmdr.FlagBuilder("table").
+				SetName("format", "f").
+				SetUsage("output format: table|json|yaml").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("fix").
+				SetUsage("repair remote urls, upstream tracking, git config, and (for clean checkouts) the checked out branch").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*repoDoctorOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			return &repoDoctorOptions{
+				conf:   conf,
+				repos:  cc.Args().Slice(),
+				format: cc.String("format"),
+				fix:    cc.Bool("fix"),
+			}, nil
+		}).SetMiddleware(func(ctx context.Context, opts *repoDoctorOptions) context.Context {
+			return withOperationContext(ctx, opts.conf)
+		}).SetAction(func(ctx context.Context, opts *repoDoctorOptions) error {
+			var repos []repo.GitRepository
+			if len(opts.repos) == 0 {
+				repos = opts.conf.Repos.GitRepos.Copy()
+			} else {
+				var err error
+				if repos, err = opts.conf.Repos.Select(opts.repos...); err != nil {
+					return err
+				}
+			}
+
+			if len(repos) == 0 {
+				return fmt.Errorf("no repositories for %s", opts.repos)
+			}
+
+			report := make([]*repo.Diagnosis, len(repos))
 
-			ct := &atomic.Int64{}
 			jobs := func(yield func(fnx.Worker) bool) {
-				for _, rc := range repos {
-					if rc.Fetch {
-						ct.Add(1)
-						if !yield(rc.FetchJob()) {
-							return
+				for idx := range repos {
+					rc := repos[idx]
+					if !yield(func(ctx context.Context) error {
+						diag, err := rc.Doctor(ctx, opts.fix)
+						if err != nil {
+							diag.Error = err.Error()
 						}
+						report[idx] = diag
+						return nil
+					}) {
+						return
 					}
 				}
 			}
 
-			err := subexec.TOOLS.WorkerPool(jobs).Run(ctx)
+			if err := subexec.TOOLS.WorkerPool(jobs).Run(ctx); err != nil {
+				return err
+			}
+
+			sort.Slice(report, func(i, j int) bool { return report[i].Name < report[j].Name })
+
+			if err := writeRepoDoctorReport(opts.format, report); err != nil {
+				return err
+			}
+
+			var unhealthy int
+			for _, diag := range report {
+				if !diag.Healthy() {
+					unhealthy++
+				}
+			}
+			if unhealthy > 0 {
+				return fmt.Errorf("%d of %d repositories need attention", unhealthy, len(report))
+			}
+			return nil
+		}).Add)
+}
+
+func writeRepoDoctorReport(format string, report []*repo.Diagnosis) error {
+	return writeFormatted(format, report, func(w io.Writer) error {
+		table := newTable(w)
+		table.AddHeader("Name", "Check", "Fixable", "Fixed", "Message")
+
+		for _, diag := range report {
 			switch {
-			case ct.Load() == 0:
-				return fmt.Errorf("no repositories for %s", args.arg)
-			case err != nil:
+			case diag.Error != "":
+				table.AddLine(diag.Name, "<error>", "", "", diag.Error)
+			case len(diag.Findings) == 0:
+				table.AddLine(diag.Name, "ok", "", "", "")
+			}
+
+			for _, finding := range diag.Findings {
+				msg := finding.Message
+				if finding.Error != "" {
+					msg = fmt.Sprintf("%s (fix failed: %s)", msg, finding.Error)
+				}
+				table.AddLine(diag.Name, finding.Check, finding.Fixable, finding.Fixed, msg)
+			}
+		}
+
+		table.Print()
+		return nil
+	})
+}
+
+type repoDiscoverOptions struct {
+	conf   *sardis.Configuration
+	format string
+	append string
+}
+
+func repoDiscover() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("discover").
+		SetUsage("find git repositories that are not in the configuration, and emit config entries for them").
+		Flags(
+			cmdr.FlagBuilder("yaml").
+				SetName("format", "f").
+				SetUsage("output format: yaml|json|table").
+				Flag(),
+			cmdr.FlagBuilder("").
+				SetName("append").
+				SetUsage("append the discovered repositories to this yaml config file rather than printing them").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*repoDiscoverOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			return &repoDiscoverOptions{
+				conf:   conf,
+				format: cc.String("format"),
+				append: cc.String("append"),
+			}, nil
+		}).
+			SetAction(func(ctx context.Context, opts *repoDiscoverOptions) error {
+				repos, err := opts.conf.Repos.Discover()
+				if err != nil {
+					return err
+				}
+
+				if len(repos) == 0 {
+					grip.Info("no unmanaged repositories found")
+					return nil
+				}
+
+				if opts.append != "" {
+					if err := sardis.AppendRepositories(opts.append, repos...); err != nil {
+						return err
+					}
+
+					grip.Notice(message.Fields{
+						"op":    "repo-discover",
+						"path":  opts.append,
+						"count": len(repos),
+						"msg":   "appended repositories to config",
+					})
+					return nil
+				}
+
+				switch opts.format {
+				case "JSON", "json", "js", "j":
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "    ")
+					return enc.Encode(repos)
+				case "table":
+					table := tabby.New()
+					table.AddHeader("Name", "Path", "Remote", "Branch", "Tags")
+					for _, rp := range repos {
+						table.AddLine(rp.Name, rp.Path, rp.Remote, rp.Branch, strings.Join(rp.Tags, ", "))
+					}
+					table.Print()
+					return nil
+				default:
+					payload, err := sardis.MarshalRepositories(repos...)
+					if err != nil {
+						return err
+					}
+					_, err = os.Stdout.Write(payload)
+					return err
+				}
+			}).Add)
+}
+
+type repoAddOptions struct {
+	conf    *sardis.Configuration
+	remote  string
+	name    string
+	path    string
+	branch  string
+	file    string
+	tags    []string
+	sync    bool
+	fetch   bool
+	noClone bool
+}
+
+func repoAdd() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("add").
+		SetUsage("clone a remote (url or <forge>:<owner>/<name>) and add it to the configuration").
+		Flags(
+			cmdr.FlagBuilder("").
+				SetName("name", "n").
+				SetUsage("name of the repository, defaults to the name of the remote").
+				Flag(),
+			cmdr.FlagBuilder("").
+				SetName("path", "p").
+				SetUsage("path of the checkout, defaults to the path derived from the repositories layout").
+				Flag(),
+			cmdr.FlagBuilder("main").
+				SetName("branch", "b").
+				SetUsage("branch to track").
+				Flag(),
+			cmdr.FlagBuilder("").
+				SetName("tags", "t").
+				SetUsage("comma separated list of tags for the repository").
+				Flag(),
+			cmdr.FlagBuilder("").
+				SetName("file").
+				SetUsage("config file to add the repository to, defaults to the file that owns the first tag").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("sync").
+				SetUsage("sync local changes to the remote during updates").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("fetch").
+				SetUsage("fetch from the remote during updates").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("no-clone").
+				SetUsage("only add the repository to the configuration").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*repoAddOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			opts := &repoAddOptions{
+				conf:    conf,
+				remote:  cc.Args().First(),
+				name:    cc.String("name"),
+				path:    cc.String("path"),
+				branch:  cc.String("branch"),
+				file:    cc.String("file"),
+				sync:    cc.Bool("sync"),
+				fetch:   cc.Bool("fetch"),
+				noClone: cc.Bool("no-clone"),
+			}
+
+			for tag := range strings.SplitSeq(cc.String("tags"), ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					opts.tags = append(opts.tags, tag)
+				}
+			}
+
+			if opts.remote == "" {
+				return nil, errors.New("must specify a remote to add")
+			}
+
+			return opts, nil
+		}).SetMiddleware(func(ctx context.Context, opts *repoAddOptions) context.Context {
+			return withOperationContext(ctx, opts.conf)
+		}).SetAction(func(ctx context.Context, opts *repoAddOptions) error {
+			remote, err := opts.conf.Repos.ParseRemote(opts.remote)
+			if err != nil {
 				return err
-			default:
+			}
+
+			rp := repo.GitRepository{
+				Name:      util.Default(opts.name, remote.Name),
+				Path:      util.TryCollapseHomeDir(util.Default(opts.path, remote.Path(opts.conf.Repos.Layout))),
+				Remote:    remote.URL,
+				Branch:    opts.branch,
+				LocalSync: opts.sync,
+				Fetch:     opts.fetch,
+				Tags:      opts.tags,
+			}
+
+			if _, err := opts.conf.Repos.FindOne(rp.Name); err == nil {
+				return fmt.Errorf("repository %q is already configured", rp.Name)
+			}
+
+			fn := opts.file
+			if fn == "" && len(rp.Tags) > 0 {
+				fn = opts.conf.RepositoryConfigFileForTag(rp.Tags[0])
+			}
+			fn = util.Default(fn, opts.conf.OriginalPath())
+
+			if !opts.noClone {
+				clone := rp
+				if err := clone.CloneJob().Run(ctx); err != nil {
+					return err
+				}
+			}
+
+			if err := sardis.AppendRepositories(fn, rp); err != nil {
+				return err
+			}
+
+			grip.Notice(message.Fields{
+				"op":     "repo-add",
+				"repo":   rp.Name,
+				"path":   rp.Path,
+				"remote": rp.Remote,
+				"file":   fn,
+			})
+
+			return nil
+		}).Add)
+}
+
+type repoRemoveOptions struct {
+	conf       *sardis.Configuration
+	name       string
+	file       string
+	archive    bool
+	archiveDir string
+}
+
+func repoRemove() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("remove").
+		Aliases("rm").
+		SetUsage("remove a repository from the configuration, leaving the checkout in place unless archived").
+		Flags(
+			cmdr.FlagBuilder("").
+				SetName("file").
+				SetUsage("config file to remove the repository from, defaults to the file that defines it").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("archive").
+				SetUsage("move the checkout into the archive directory").
+				Flag(),
+			cmdr.FlagBuilder(filepath.Join(util.GetStateDir(global.ApplicationName), "archive")).
+				SetName("archive-dir").
+				SetUsage("directory to move archived checkouts into").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*repoRemoveOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			opts := &repoRemoveOptions{
+				conf:       conf,
+				name:       cc.Args().First(),
+				file:       cc.String("file"),
+				archive:    cc.Bool("archive"),
+				archiveDir: util.TryExpandHomeDir(cc.String("archive-dir")),
+			}
+
+			if opts.name == "" {
+				return nil, errors.New("must specify a repository to remove")
+			}
+
+			return opts, nil
+		}).SetAction(func(ctx context.Context, opts *repoRemoveOptions) error {
+			var rp *repo.GitRepository
+			for idx := range opts.conf.Repos.GitRepos {
+				if opts.conf.Repos.GitRepos[idx].Name == opts.name {
+					rp = &opts.conf.Repos.GitRepos[idx]
+					break
+				}
+			}
+			if rp == nil {
+				return fmt.Errorf("no repository named %q", opts.name)
+			}
+
+			fn := opts.file
+			if fn == "" {
+				var err error
+				if fn, err = opts.conf.RepositoryConfigFile(rp.Name); err != nil {
+					return err
+				}
+			}
+
+			count, err := sardis.RemoveRepository(fn, rp.Name)
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				return fmt.Errorf("repository %q is not defined in %q", rp.Name, fn)
+			}
+
+			msg := message.Fields{
+				"op":   "repo-remove",
+				"repo": rp.Name,
+				"file": fn,
+			}
+
+			if opts.archive && util.FileExists(rp.Path) {
+				target := filepath.Join(opts.archiveDir, fmt.Sprint(rp.Name, "-", time.Now().Format("20060102-150405")))
+				if err := os.MkdirAll(opts.archiveDir, 0o755); err != nil {
+					return err
+				}
+				if err := os.Rename(rp.Path, target); err != nil {
+					return fmt.Errorf("removed %q from config, but could not archive checkout: %w", rp.Name, err)
+				}
+				msg["archive"] = target
+			}
+
+			grip.Notice(msg)
+
+			return nil
+		}).Add)
+}
+
+type repoForeachOptions struct {
+	conf            *sardis.Configuration
+	selectors       []string
+	command         []string
+	output          string
+	jobs            int
+	continueOnError bool
+	dryRun          dryRunOptions
+}
+
+func repoForeach() *cmdr.Commander {
+	return withDryRunFlags(cmdr.MakeCommander()).
+		SetName("foreach").
+		SetUsage("run a command in every matching repository: foreach <selector> -- <command>").
+		Flags(
+			cmdr.FlagBuilder("prefix").
+				SetName("output", "o").
+				SetUsage("output mode: prefix (interleaved lines, prefixed with the repo name) or group (per-repo blocks)").
+				Flag(),
+			cmdr.FlagBuilder(runtime.NumCPU()).
+				SetName("jobs", "j").
+				SetUsage("number of repositories to run the command in concurrently").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("continue-on-error", "k").
+				SetUsage("keep running the command in other repositories after a failure").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*repoForeachOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			opts := &repoForeachOptions{
+				conf:            conf,
+				output:          cc.String("output"),
+				jobs:            max(1, cc.Int("jobs")),
+				continueOnError: cc.Bool("continue-on-error"),
+				dryRun:          getDryRunOptions(cc),
+			}
+
+			// selectors are either everything before the "--", or
+			// (when the argument parser consumes it) the first
+			// argument.
+			args := cc.Args().Slice()
+			selectors := args
+			if idx := slices.Index(args, "--"); idx >= 0 {
+				selectors, opts.command = args[:idx], args[idx+1:]
+			} else if len(args) > 0 {
+				selectors, opts.command = args[:1], args[1:]
+			}
+
+			opts.selectors = slices.DeleteFunc(selectors, func(s string) bool { return strings.TrimSpace(s) == "" })
+
+			switch {
+			case len(opts.selectors) == 0:
+				return nil, errors.New("must specify repositories or tags to run the command in")
+			case len(opts.command) == 0:
+				return nil, errors.New("must specify a command to run")
+			case opts.output != "prefix" && opts.output != "group":
+				return nil, fmt.Errorf("%q is not a valid output mode", opts.output)
+			}
+
+			return opts, nil
+		}).SetMiddleware(func(ctx context.Context, opts *repoForeachOptions) context.Context {
+			return withOperationContext(ctx, opts.conf)
+		}).SetAction(func(ctx context.Context, opts *repoForeachOptions) error {
+			repos, err := opts.conf.Repos.Select(opts.selectors...)
+			if err != nil {
+				return err
+			}
+			if len(repos) == 0 {
+				return fmt.Errorf("no repositories for %s", opts.selectors)
+			}
+			sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+
+			if opts.dryRun.enabled {
+				exps := make([]subexec.Explanation, 0, len(repos))
+				for _, rp := range repos {
+					exps = append(exps, rp.ExplainForeach(opts.command))
+				}
+				return writeExplanations(opts.dryRun.format, exps)
+			}
+
+			width := 0
+			for _, rp := range repos {
+				width = max(width, len(rp.Name))
+			}
+
+			mtx := &sync.Mutex{}
+			results := make([]repo.ForeachResult, len(repos))
+
+			jobs := func(yield func(fnx.Worker) bool) {
+				for idx := range repos {
+					rp := repos[idx]
+
+					var job fnx.Worker
+					switch opts.output {
+					case "group":
+						buf := &bytes.Buffer{}
+						job = rp.ForeachJob(opts.command, buf, &results[idx]).
+							PostHook(func() {
+								mtx.Lock()
+								defer mtx.Unlock()
+								fmt.Printf("==> %s (%s) <==\n", rp.Name, util.TryCollapseHomeDir(rp.Path))
+								_, _ = buf.WriteTo(os.Stdout)
+								fmt.Println()
+							})
+					default:
+						pw := &prefixWriter{
+							prefix: fmt.Sprintf("%-*s | ", width, rp.Name),
+							mtx:    mtx,
+							out:    os.Stdout,
+						}
+						job = rp.ForeachJob(opts.command, pw, &results[idx]).PostHook(pw.Flush)
+					}
+
+					if !yield(job) {
+						return
+					}
+				}
+			}
+
+			poolOpts := []opt.Provider[*wpa.WorkerGroupConf]{wpa.WorkerGroupConfNumWorkers(opts.jobs)}
+			if opts.continueOnError {
+				poolOpts = append(poolOpts, wpa.WorkerGroupConfContinueOnError())
+			}
+
+			err = subexec.TOOLS.WorkerPool(jobs, poolOpts...).Run(ctx)
+
+			table := tabby.New()
+			table.AddHeader("Name", "Exit", "Duration", "Error")
+			failed := 0
+			for _, res := range results {
+				if res.Repo == "" {
+					// never started, because an earlier job failed.
+					continue
+				}
+				if res.Error != "" {
+					failed++
+				}
+				table.AddLine(res.Repo, res.ExitCode, res.Duration.Round(time.Millisecond), res.Error)
+			}
+			fmt.Println()
+			table.Print()
+
+			if failed > 0 {
+				return fmt.Errorf("command failed in %d of %d repositories", failed, len(repos))
+			}
+			return err
+		}).Add)
+}
+
+// prefixWriter writes complete lines to the underlying writer, each
+// prefixed, so that the output of concurrent commands interleaves
+// line by line.
+type prefixWriter struct {
+	prefix string
+	mtx    *sync.Mutex
+	out    io.Writer
+	buf    []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+
+	for {
+		idx := bytes.IndexByte(pw.buf, '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+
+		if err := pw.writeLine(pw.buf[:idx+1]); err != nil {
+			return len(p), err
+		}
+		pw.buf = pw.buf[idx+1:]
+	}
+}
+
+func (pw *prefixWriter) Flush() {
+	if len(pw.buf) == 0 {
+		return
+	}
+	_ = pw.writeLine(append(pw.buf, '\n'))
+	pw.buf = nil
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	pw.mtx.Lock()
+	defer pw.mtx.Unlock()
+
+	if _, err := io.WriteString(pw.out, pw.prefix); err != nil {
+		return err
+	}
+	_, err := pw.out.Write(line)
+	return err
+}
+
+func repoFetch() *cmdr.Commander {
+	return repoPullCommand(
+		cmdr.MakeCommander().
+			SetName("fetch").
+			SetUsage("fetch one or more repos"),
+		"fetch",
+		func(rc repo.GitRepository) fnx.Worker {
+			if !rc.Fetch {
 				return nil
 			}
-		})
+			return rc.FetchJob()
+		},
+	)
 }
 
 func repoGithubClone() *cmdr.Commander {
 	return cmdr.MakeCommander().
 		SetName("gh-clone").Aliases("gh", "ghc").
-		SetUsage("clone a repository or all matching repositories").
+		SetUsage("clone a repository from a forge: <account> <name>, or <forge>:<account>/<name>").
 		Flags(
-			cmdr.FlagBuilder("tychoish").
+			cmdr.FlagBuilder(repo.DefaultForge).
+				SetName("forge", "f").
+				SetUsage("name of the forge, as configured in repositories.forges").
+				Flag(),
+			cmdr.FlagBuilder("").
 				SetName("account", "a").
-				SetUsage("name of ").
+				SetUsage("name of the account, defaults to the account configured for the forge").
 				Flag(),
 			cmdr.FlagBuilder("").
 				SetName("repo", "r").
@@ -268,20 +1293,268 @@ func repoGithubClone() *cmdr.Commander {
 				Flag(),
 		).
 		SetAction(func(ctx context.Context, cc *cli.Command) error {
-			jpm := jasper.Context(ctx)
-			args := append(cc.Args().Slice(), "", "")
-
-			grip.Info(grip.MPrintln(args, len(args)))
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return err
+			}
 
-			account := fallbackTo(cc.String("account"), args...)
-			repo := fallbackTo(cc.String("repo"), args[1:]...)
-			repoPath := fmt.Sprintf("git@github.com:%s/%s.git", account, repo)
+			args := cc.Args().Slice()
+			spec := fallbackTo(cc.String("repo"), args...)
+			switch {
+			case len(args) == 1 && strings.Contains(spec, ":"):
+			case len(args) >= 2:
+				account := fallbackTo(cc.String("account"), args[0])
+				spec = fmt.Sprintf("%s:%s/%s", cc.String("forge"), account, fallbackTo(cc.String("repo"), args[1]))
+			case cc.String("account") != "":
+				spec = fmt.Sprintf("%s:%s/%s", cc.String("forge"), cc.String("account"), spec)
+			default:
+				spec = fmt.Sprintf("%s:%s", cc.String("forge"), spec)
+			}
 
-			grip.Notice(repoPath)
+			remote, err := conf.Repos.ParseRemote(spec)
+			if err != nil {
+				return err
+			}
 
-			return jpm.CreateCommand(ctx).
-				Directory(cc.String("path")).
-				SetCombinedSender(level.Debug, grip.Sender()).
-				AppendArgs("git", "clone", repoPath).Run(ctx)
+			return cloneRemote(remote.URL, cc.String("path")).Run(withOperationContext(ctx, conf))
 		})
 }
+
+func repoWorktree() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("worktree").
+		Aliases("wt").
+		SetUsage("manage git worktrees of configured repositories").
+		Subcommanders(
+			repoWorktreeAdd(),
+			repoWorktreeList(),
+			repoWorktreePrune(),
+		)
+}
+
+type repoWorktreeAddOptions struct {
+	conf   *sardis.Configuration
+	repo   string
+	branch string
+	base   string
+}
+
+func repoWorktreeAdd() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("add").
+		SetUsage("create a worktree for a branch: <repo> <branch>").
+		Flags(
+			cmdr.FlagBuilder("").
+				SetName("base").
+				SetUsage("start point for new branches, defaults to the remote branch of the repository").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(func(ctx context.Context, cc *cli.Command) (*repoWorktreeAddOptions, error) {
+			conf, err := ResolveConfiguration(ctx, cc)
+			if err != nil {
+				return nil, err
+			}
+
+			if cc.Args().Len() != 2 {
+				return nil, fmt.Errorf("must specify a repository and a branch, not %d arguments", cc.Args().Len())
+			}
+
+			return &repoWorktreeAddOptions{
+				conf:   conf,
+				repo:   cc.Args().Get(0),
+				branch: cc.Args().Get(1),
+				base:   cc.String("base"),
+			}, nil
+		}).SetMiddleware(func(ctx context.Context, opts *repoWorktreeAddOptions) context.Context {
+			return withOperationContext(ctx, opts.conf)
+		}).SetAction(func(ctx context.Context, opts *repoWorktreeAddOptions) error {
+			rc, err := opts.conf.Repos.FindOne(opts.repo)
+			if err != nil {
+				return err
+			}
+
+			wt, err := rc.AddWorktree(ctx, opts.conf.Repos.WorktreeLayout, opts.branch, opts.base)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(wt.Path)
+			return nil
+		}).Add)
+}
+
+type repoWorktreeOptions struct {
+	conf   *sardis.Configuration
+	repos  []string
+	format string
+	force  bool
+	dryRun dryRunOptions
+}
+
+func repoWorktreeSpec(ctx context.Context, cc *cli.Command) (*repoWorktreeOptions, error) {
+	conf, err := ResolveConfiguration(ctx, cc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repoWorktreeOptions{
+		conf:   conf,
+		repos:  cc.Args().Slice(),
+		format: cc.String("format"),
+		force:  cc.Bool("force"),
+		dryRun: getDryRunOptions(cc),
+	}, nil
+}
+
+func (opts *repoWorktreeOptions) selectRepos() ([]repo.GitRepository, error) {
+	if len(opts.repos) == 0 {
+		return opts.conf.Repos.GitRepos.Copy(), nil
+	}
+
+	repos, err := opts.conf.Repos.Select(opts.repos...)
+	if err != nil {
+		return nil, err
+	}
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("no repositories for %s", opts.repos)
+	}
+	return repos, nil
+}
+
+func repoWorktreeList() *cmdr.Commander {
+	return cmdr.MakeCommander().
+		SetName("list").
+		Aliases("ls").
+		SetUsage("list the worktrees of repositories, with their branch and status").
+		Flags(
+			cmdr.FlagBuilder("table").
+				SetName("format", "f").
+				SetUsage("output format: table|json|yaml").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(repoWorktreeSpec).
+			SetMiddleware(func(ctx context.Context, opts *repoWorktreeOptions) context.Context {
+				return withOperationContext(ctx, opts.conf)
+			}).SetAction(func(ctx context.Context, opts *repoWorktreeOptions) error {
+			repos, err := opts.selectRepos()
+			if err != nil {
+				return err
+			}
+
+			ec := &erc.Collector{}
+			report := []repo.Worktree{}
+			for _, rc := range repos {
+				worktrees, err := rc.Worktrees()
+				ec.Wrapf(err, "listing worktrees for %q", rc.Name)
+				report = append(report, worktrees...)
+			}
+
+			ec.Push(writeRepoWorktreeReport(opts.format, report, func(table *tabby.Tabby) {
+				table.AddHeader("Name", "Branch", "Dirty", "Path", "State")
+				for _, wt := range report {
+					table.AddLine(wt.Repo, util.Default(wt.Branch, "<detached>"), wt.Dirty, util.TryCollapseHomeDir(wt.Path), renderWorktreeState(wt))
+				}
+			}))
+
+			return ec.Resolve()
+		}).Add)
+}
+
+func renderWorktreeState(wt repo.Worktree) string {
+	switch {
+	case wt.Error != "":
+		return wt.Error
+	case wt.Prunable:
+		return "missing"
+	case wt.Locked:
+		return "locked"
+	default:
+		return ""
+	}
+}
+
+func repoWorktreePrune() *cmdr.Commander {
+	return withDryRunFlags(cmdr.MakeCommander()).
+		SetName("prune").
+		SetUsage("remove worktrees whose branches are merged or deleted").
+		Flags(
+			cmdr.FlagBuilder("table").
+				SetName("format", "f").
+				SetUsage("output format: table|json|yaml").
+				Flag(),
+			cmdr.FlagBuilder(false).
+				SetName("force").
+				SetUsage("also remove worktrees whose branches were deleted, which may have unmerged commits").
+				Flag(),
+		).
+		With(cmdr.SpecBuilder(repoWorktreeSpec).
+			SetMiddleware(func(ctx context.Context, opts *repoWorktreeOptions) context.Context {
+				return withOperationContext(ctx, opts.conf)
+			}).SetAction(func(ctx context.Context, opts *repoWorktreeOptions) error {
+			repos, err := opts.selectRepos()
+			if err != nil {
+				return err
+			}
+
+			ec := &erc.Collector{}
+			if opts.dryRun.enabled {
+				exps := make([]subexec.Explanation, 0, len(repos))
+				for _, rc := range repos {
+					results, err := rc.PruneWorktrees(ctx, true, opts.force)
+					ec.Wrapf(err, "finding worktrees to prune for %q", rc.Name)
+					exps = append(exps, rc.ExplainPruneWorktrees(results))
+				}
+				ec.Push(writeExplanations(opts.dryRun.format, exps))
+				return ec.Resolve()
+			}
+
+			report := []repo.WorktreeResult{}
+			for _, rc := range repos {
+				results, err := rc.PruneWorktrees(ctx, false, opts.force)
+				ec.Wrapf(err, "pruning worktrees for %q", rc.Name)
+				report = append(report, results...)
+			}
+
+			ec.Push(writeRepoWorktreeReport(opts.format, report, func(table *tabby.Tabby) {
+				table.AddHeader("Name", "Branch", "Path", "Reason", "Removed")
+				for _, res := range report {
+					reason := res.Reason
+					if res.Error != "" {
+						reason = fmt.Sprintf("%s (%s)", reason, res.Error)
+					}
+					table.AddLine(res.Repo, res.Branch, util.TryCollapseHomeDir(res.Path), reason, res.Removed)
+				}
+			}))
+
+			for _, res := range report {
+				ec.Whenf(res.Error != "", "removing worktree %q: %s", res.Path, res.Error)
+			}
+
+			return ec.Resolve()
+		}).Add)
+}
+
+func writeRepoWorktreeReport(format string, report any, table func(*tabby.Tabby)) error {
+	ec := &erc.Collector{}
+	buf := bufio.NewWriter(os.Stdout)
+
+	switch format {
+	case "JSON", "json", "js", "j":
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "    ")
+		ec.Push(enc.Encode(report))
+	case "YAML", "yaml", "yml", "y":
+		enc := yaml.NewEncoder(buf)
+		ec.Push(enc.Encode(report))
+		ec.Push(enc.Close())
+	case "table":
+		fallthrough
+	default:
+		tbl := tabby.New()
+		table(tbl)
+		tbl.Print()
+	}
+
+	ec.Push(buf.Flush())
+	return ec.Resolve()
+}
@@ -0,0 +1,305 @@
+package repo
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/sardis/util"
+)
+
+type CleanupMode string
+
+const (
+	// CleanupModeGC runs git gc and git prune.
+	CleanupModeGC CleanupMode = "gc"
+	// CleanupModeMaintenance runs the incremental git maintenance
+	// tasks, which are cheaper than a full gc.
+	CleanupModeMaintenance CleanupMode = "maintenance"
+	// CleanupModeRemotes prunes remote-tracking branches that no
+	// longer exist on the remotes.
+	CleanupModeRemotes CleanupMode = "remotes"
+	// CleanupModeReflog expires old reflog entries.
+	CleanupModeReflog CleanupMode = "reflog"
+	// CleanupModeBranches deletes local branches that are merged
+	// into the repository's branch.
+	CleanupModeBranches CleanupMode = "branches"
+)
+
+// CleanupModes are all of the supported cleanup modes, in the order
+// that they run.
+var CleanupModes = []CleanupMode{
+	CleanupModeBranches,
+	CleanupModeRemotes,
+	CleanupModeReflog,
+	CleanupModeMaintenance,
+	CleanupModeGC,
+}
+
+// DefaultReflogExpiry is the age of the reflog entries that the
+// reflog cleanup mode removes, in the form accepted by git.
+const DefaultReflogExpiry = "90.days.ago"
+
+// CleanupSettings configure the cleanup job for a repository. Without
+// modes, cleanup runs git gc and git prune.
+type CleanupSettings struct {
+	Modes        []CleanupMode `bson:"modes" json:"modes" yaml:"modes"`
+	ReflogExpiry string        `bson:"reflog_expiry" json:"reflog_expiry" yaml:"reflog_expiry"`
+}
+
+func (cs *CleanupSettings) Validate() error { return ValidateCleanupModes(cs.Modes) }
+
+// ParseCleanupModes parses a comma separated list of cleanup modes;
+// "all" selects every mode.
+func ParseCleanupModes(spec string) ([]CleanupMode, error) {
+	var out []CleanupMode
+	for mode := range strings.SplitSeq(spec, ",") {
+		switch mode = strings.TrimSpace(mode); mode {
+		case "":
+		case "all":
+			out = append(out, CleanupModes...)
+		default:
+			out = append(out, CleanupMode(mode))
+		}
+	}
+
+	return out, ValidateCleanupModes(out)
+}
+
+func ValidateCleanupModes(modes []CleanupMode) error {
+	ec := &erc.Collector{}
+	for _, mode := range modes {
+		ec.Whenf(!slices.Contains(CleanupModes, mode), "%q is not a valid cleanup mode", mode)
+	}
+	return ec.Resolve()
+}
+
+// cleanupModes returns the modes to run, in order: the modes given,
+// or the configured modes, or gc.
+func (conf *GitRepository) cleanupModes(modes []CleanupMode) []CleanupMode {
+	if len(modes) == 0 {
+		modes = conf.Cleanup.Modes
+	}
+	if len(modes) == 0 {
+		return []CleanupMode{CleanupModeGC}
+	}
+
+	out := make([]CleanupMode, 0, len(modes))
+	for _, mode := range CleanupModes {
+		if slices.Contains(modes, mode) {
+			out = append(out, mode)
+		}
+	}
+	return out
+}
+
+// DiskUsage is the size of a repository's git directory.
+type DiskUsage struct {
+	Bytes         int64 `bson:"bytes" json:"bytes" yaml:"bytes"`
+	LooseObjects  int   `bson:"loose_objects" json:"loose_objects" yaml:"loose_objects"`
+	PackedObjects int   `bson:"packed_objects" json:"packed_objects" yaml:"packed_objects"`
+	Packs         int   `bson:"packs" json:"packs" yaml:"packs"`
+}
+
+func (du DiskUsage) Objects() int { return du.LooseObjects + du.PackedObjects }
+
+// CleanupResult is the outcome of cleaning up a single repository.
+type CleanupResult struct {
+	Repo     string        `bson:"repo" json:"repo" yaml:"repo"`
+	Path     string        `bson:"path" json:"path" yaml:"path"`
+	Modes    []CleanupMode `bson:"modes" json:"modes" yaml:"modes"`
+	Before   DiskUsage     `bson:"before" json:"before" yaml:"before"`
+	After    DiskUsage     `bson:"after" json:"after" yaml:"after"`
+	Deleted  []string      `bson:"deleted,omitempty" json:"deleted,omitempty" yaml:"deleted,omitempty"`
+	Duration time.Duration `bson:"dur" json:"dur" yaml:"dur"`
+	Error    string        `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Reclaimed returns the number of bytes that the cleanup freed, which
+// may be negative (e.g. when gc packs loose objects that were shared
+// via hardlinks).
+func (cr *CleanupResult) Reclaimed() int64 { return cr.Before.Bytes - cr.After.Bytes }
+
+// DiskUsage measures the git directory of the checkout: the total
+// size of its files, the number of loose objects, and the number of
+// packs and objects in them.
+func (conf *GitRepository) DiskUsage() (DiskUsage, error) {
+	var out DiskUsage
+
+	dir := conf.gitDir()
+	if dir == "" {
+		return out, fmt.Errorf("%q is not a git checkout", conf.Path)
+	}
+
+	objects := filepath.Join(dir, "objects")
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		out.Bytes += info.Size()
+
+		rel, err := filepath.Rel(objects, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil
+		}
+
+		switch parent := filepath.Dir(rel); {
+		case len(parent) == 2:
+			out.LooseObjects++
+		case parent == "pack" && strings.HasSuffix(rel, ".idx"):
+			count, err := countPackObjects(path)
+			if err != nil {
+				return err
+			}
+			out.Packs++
+			out.PackedObjects += count
+		}
+
+		return nil
+	})
+
+	return out, err
+}
+
+// countPackObjects reads the number of objects in a pack from the
+// last entry of the fanout table in its (version 2) index.
+func countPackObjects(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer util.DropErrorOnDefer(file.Close)
+
+	header := make([]byte, 8+256*4)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return 0, fmt.Errorf("reading pack index %q: %w", path, err)
+	}
+
+	if string(header[:4]) != "\xfftOc" || binary.BigEndian.Uint32(header[4:8]) != 2 {
+		return 0, fmt.Errorf("pack index %q has an unsupported format", path)
+	}
+
+	return int(binary.BigEndian.Uint32(header[len(header)-4:])), nil
+}
+
+// cleanupArgs returns the git commands that implement the mode.
+// Deleting merged branches does not run commands.
+func (conf *GitRepository) cleanupArgs(mode CleanupMode) [][]string {
+	switch mode {
+	case CleanupModeGC:
+		return [][]string{{"git", "gc"}, {"git", "prune"}}
+	case CleanupModeMaintenance:
+		return [][]string{{"git", "maintenance", "run", "--task=commit-graph", "--task=loose-objects", "--task=incremental-repack"}}
+	case CleanupModeRemotes:
+		var out [][]string
+		for _, rm := range conf.AllRemotes() {
+			if rm.Fetches() {
+				out = append(out, []string{"git", "remote", "prune", rm.Name})
+			}
+		}
+		return out
+	case CleanupModeReflog:
+		expiry := util.Default(conf.Cleanup.ReflogExpiry, DefaultReflogExpiry)
+		return [][]string{{"git", "reflog", "expire", "--expire=" + expiry, "--all"}}
+	default:
+		return nil
+	}
+}
+
+// deleteMergedBranches deletes the local branches whose heads are
+// reachable from the repository's branch, except for branches that
+// are checked out in the checkout or one of its worktrees, and
+// branches that point at the tip of the repository's branch, which
+// were just created rather than merged.
+func (conf *GitRepository) deleteMergedBranches(ctx context.Context) ([]string, error) {
+	repo, err := openRepo(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := repo.Reference(plumbing.NewBranchReferenceName(conf.Branch), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		base, err = repo.Reference(plumbing.NewRemoteReferenceName(conf.RemoteName, conf.Branch), true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolving %q: %w", conf.Branch, err)
+	}
+
+	baseCommit, err := repo.CommitObject(base.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	checkedOut := map[string]bool{conf.Branch: true}
+	if head, err := repo.Head(); err == nil && head.Name().IsBranch() {
+		checkedOut[head.Name().Short()] = true
+	}
+	worktrees, err := conf.Worktrees()
+	if err != nil {
+		return nil, err
+	}
+	for _, wt := range worktrees {
+		checkedOut[wt.Branch] = true
+	}
+
+	branches, err := repo.Branches()
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []*plumbing.Reference
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		if checkedOut[ref.Name().Short()] || ref.Hash() == baseCommit.Hash || ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+
+		if ok, err := commit.IsAncestor(baseCommit); err != nil {
+			return err
+		} else if ok {
+			merged = append(merged, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]string, 0, len(merged))
+	for _, ref := range merged {
+		if err := repo.Storer.RemoveReference(ref.Name()); err != nil {
+			return deleted, err
+		}
+		if err := repo.DeleteBranch(ref.Name().Short()); err != nil && !errors.Is(err, git.ErrBranchNotFound) {
+			return deleted, err
+		}
+		deleted = append(deleted, ref.Name().Short())
+	}
+
+	return deleted, nil
+}
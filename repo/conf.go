@@ -2,18 +2,31 @@ package repo
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/tychoish/fun/adt"
 	"github.com/tychoish/fun/dt"
 	"github.com/tychoish/fun/erc"
 	"github.com/tychoish/fun/irt"
 	"github.com/tychoish/fun/stw"
+	"github.com/tychoish/sardis/util"
 )
 
 type Configuration struct {
 	GitRepos  stw.Slice[GitRepository]           `bson:"git" json:"git" yaml:"git"`
 	Projects  []Project                          `bson:"projects" json:"projects" yaml:"projects"`
 	TagGroups stw.Map[string, stw.Slice[string]] `bson:"tag_groups" json:"tag_groups" yaml:"tag_groups"`
+	Discovery *Discovery                         `bson:"discovery" json:"discovery" yaml:"discovery"`
+	Layout    string                             `bson:"layout" json:"layout" yaml:"layout"`
+	Selectors map[string]string                  `bson:"selectors" json:"selectors" yaml:"selectors"`
+	Forges    Forges                             `bson:"forges" json:"forges" yaml:"forges"`
+
+	// TagGitConfig maps tags to the git config defaults for the
+	// repositories with that tag.
+	TagGitConfig map[string]map[string]string `bson:"tag_git_config" json:"tag_git_config" yaml:"tag_git_config"`
+
+	WorktreeLayout string `bson:"worktree_layout" json:"worktree_layout" yaml:"worktree_layout"`
 
 	lookupProcessed bool
 	caches          struct {
@@ -27,12 +40,25 @@ func (conf *Configuration) Validate() error { return conf.caches.validation.Do(c
 func (conf *Configuration) doValidate() error {
 	ec := &erc.Collector{}
 	ec.Push(conf.projectsValidate())
+	ec.Push(conf.Forges.withDefaults().Validate())
+
+	for tag, config := range conf.TagGitConfig {
+		var err error
+		conf.TagGitConfig[tag], err = normalizeGitConfig(config)
+		ec.Wrapf(err, "git config for tag %q", tag)
+	}
 
 	for idx := range conf.GitRepos {
+		ec.Push(conf.expandRemotes(&conf.GitRepos[idx]))
 		ec.Wrapf((&conf.GitRepos[idx]).Validate(), "%d/%d of %T is not valid", idx, len(conf.GitRepos), conf.GitRepos[idx])
+		ec.Push(conf.GitRepos[idx].applyTagGitConfig(conf.TagGitConfig))
 	}
 
 	ec.Push(conf.rebuildIndexes())
+	for tag := range conf.TagGitConfig {
+		ec.Whenf(!conf.caches.tags.Check(tag), "git config for tag %q does not apply to any repository", tag)
+	}
+	ec.Push(validateDependencies(conf.GitRepos))
 
 	for group, tags := range conf.TagGroups {
 		ec.Whenf(conf.caches.lookup.Check(group), "group name %q is an existing repo name", group)
@@ -43,12 +69,59 @@ func (conf *Configuration) doValidate() error {
 		}
 	}
 
+	for name, expr := range conf.Selectors {
+		ec.Whenf(conf.caches.lookup.Check(name), "selector name %q is an existing repo name", name)
+		ec.Whenf(conf.caches.tags.Check(name), "selector name %q is an existing tag name", name)
+		if _, err := conf.Select(expr); err != nil {
+			ec.Wrapf(err, "selector %q", name)
+		}
+	}
+
 	return ec.Resolve()
 }
 
+// Join merges a later configuration file into the configuration:
+// where both specify a value, the later file wins.
 func (conf *Configuration) Join(mcf *Configuration) {
 	conf.GitRepos.Extend(irt.Slice(mcf.GitRepos))
 	conf.TagGroups.Extend(mcf.TagGroups.Iterator())
+	conf.Layout = util.Default(mcf.Layout, conf.Layout)
+	conf.WorktreeLayout = util.Default(mcf.WorktreeLayout, conf.WorktreeLayout)
+
+	for tag, config := range mcf.TagGitConfig {
+		if conf.TagGitConfig == nil {
+			conf.TagGitConfig = map[string]map[string]string{}
+		}
+		if conf.TagGitConfig[tag] == nil {
+			conf.TagGitConfig[tag] = map[string]string{}
+		}
+		maps.Copy(conf.TagGitConfig[tag], config)
+	}
+
+	for idx := range mcf.Forges {
+		if f, ok := conf.Forges.Find(mcf.Forges[idx].Name); ok {
+			merged := mcf.Forges[idx]
+			merged.Aliases = slices.Clone(merged.Aliases)
+			merged.join(f)
+			*f = merged
+			continue
+		}
+		conf.Forges = append(conf.Forges, mcf.Forges[idx])
+	}
+
+	for name, expr := range mcf.Selectors {
+		if conf.Selectors == nil {
+			conf.Selectors = map[string]string{}
+		}
+		conf.Selectors[name] = expr
+	}
+
+	if mcf.Discovery != nil {
+		if conf.Discovery == nil {
+			conf.Discovery = new(Discovery)
+		}
+		conf.Discovery.Join(mcf.Discovery)
+	}
 }
 
 func (conf *Configuration) FindOne(name string) (*GitRepository, error) {
@@ -67,6 +140,29 @@ func (conf *Configuration) FindOne(name string) (*GitRepository, error) {
 	return nil, fmt.Errorf("no repository named %q", name)
 }
 
+// FindAll returns the repositories that match the ids, which may be
+// names, tags, or selector expressions, in the order of the ids. Unlike
+// Select, ids that do not match any repositories are ignored.
+func (conf *Configuration) FindAll(ids ...string) stw.Slice[GitRepository] {
+	matching := stw.Slice[GitRepository]{}
+	seen := dt.Set[string]{}
+
+	for _, id := range ids {
+		repos, err := conf.Select(id)
+		if err != nil {
+			continue
+		}
+
+		for _, rp := range repos {
+			if !seen.Add(rp.Name) {
+				matching.Push(rp)
+			}
+		}
+	}
+
+	return matching
+}
+
 func (conf *Configuration) Tags() stw.Slice[string] {
 	conf.rebuildIndexes()
 
@@ -109,29 +205,3 @@ func (conf *Configuration) rebuildIndexes() error {
 	}
 	return ec.Resolve()
 }
-
-func (conf *Configuration) FindAll(ids ...string) stw.Slice[GitRepository] {
-	if len(ids) == 0 {
-		return nil
-	}
-
-	matching := stw.Slice[GitRepository]{}
-	seen := dt.Set[string]{}
-
-	for _, id := range ids {
-		if rp, ok := conf.caches.lookup[id]; ok {
-			if !seen.Add(rp.Name) {
-				matching.Push(rp)
-			}
-			continue
-		}
-
-		for _, rtn := range conf.caches.tags[id] {
-			if !seen.Add(rtn) && conf.caches.lookup.Check(rtn) {
-				matching.Push(conf.caches.lookup.Get(rtn))
-			}
-		}
-	}
-
-	return matching
-}
@@ -0,0 +1,39 @@
+package repo
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConfigurationJoin(t *testing.T) {
+	conf := &Configuration{
+		Layout:       "~/src/{{name}}",
+		TagGitConfig: map[string]map[string]string{"work": {"user.email": "old@example.com", "core.autocrlf": "false"}},
+		Forges:       Forges{{Name: "work", Aliases: []string{"w"}, SSH: "git@old.example.com:{{account}}/{{name}}.git", Account: "team"}},
+	}
+	conf.Join(&Configuration{
+		Layout:       "~/code/{{name}}",
+		TagGitConfig: map[string]map[string]string{"work": {"user.email": "new@example.com"}},
+		Forges:       Forges{{Name: "work", Aliases: []string{"w", "wk"}, SSH: "git@new.example.com:{{account}}/{{name}}.git"}},
+	})
+
+	if conf.Layout != "~/code/{{name}}" {
+		t.Errorf("layout %q, expected the later layout", conf.Layout)
+	}
+
+	work := conf.TagGitConfig["work"]
+	if work["user.email"] != "new@example.com" || work["core.autocrlf"] != "false" {
+		t.Errorf("unexpected tag git config %v", work)
+	}
+
+	if len(conf.Forges) != 1 {
+		t.Fatalf("expected one forge, got %v", conf.Forges)
+	}
+	forge := conf.Forges[0]
+	if forge.SSH != "git@new.example.com:{{account}}/{{name}}.git" || forge.Account != "team" {
+		t.Errorf("unexpected forge %+v", forge)
+	}
+	if !slices.Equal(forge.Aliases, []string{"w", "wk"}) {
+		t.Errorf("unexpected forge aliases %q", forge.Aliases)
+	}
+}
@@ -0,0 +1,206 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/grip/level"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/grip/send"
+	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/srv"
+	"github.com/tychoish/sardis/util"
+)
+
+const ErrRebaseInProgress ers.Error = "rebase in progress"
+
+// the markers that remoteRebaseCmd writes to standard error, for
+// remoteConflictError.
+const (
+	remoteConflictMarker = "sardis: rebase conflict"
+	remoteConflictPath   = "sardis: conflicting path: "
+	remoteRebaseAborted  = "sardis: rebase aborted"
+)
+
+// remoteRebaseCmd rebases the checkout on a mirror host. If the
+// rebase stops, it reports the conflicting paths on standard error,
+// aborts the rebase, and fails, as checkConflicts does for the local
+// checkout.
+const remoteRebaseCmd = "{ " + rebaseCmd + " || { echo '" + remoteConflictMarker + "' >&2; " +
+	"git diff --name-only --diff-filter=U | sed 's/^/" + remoteConflictPath + "/' >&2; " +
+	"git rebase --abort && echo '" + remoteRebaseAborted + "' >&2; exit 1; }; }"
+
+// ConflictError reports a sync that stopped because a rebase could
+// not be applied cleanly. When Aborted is true, the rebase was rolled
+// back and the checkout is at Head; otherwise the repository was
+// already mid-rebase before the sync started and was left alone.
+type ConflictError struct {
+	Repo    string   `bson:"repo" json:"repo" yaml:"repo"`
+	Path    string   `bson:"path" json:"path" yaml:"path"`
+	Host    string   `bson:"host" json:"host" yaml:"host"`
+	Head    string   `bson:"head" json:"head" yaml:"head"`
+	Paths   []string `bson:"paths" json:"paths" yaml:"paths"`
+	Aborted bool     `bson:"aborted" json:"aborted" yaml:"aborted"`
+	Err     error    `bson:"-" json:"-" yaml:"-"`
+}
+
+func (e *ConflictError) Unwrap() error { return e.Err }
+
+func (e *ConflictError) Error() string {
+	var state string
+	if e.Aborted {
+		state = "rebase aborted"
+	} else {
+		state = "rebase left in progress"
+	}
+
+	if len(e.Paths) == 0 {
+		return fmt.Sprintf("sync conflict in %q on %s (%s)", e.Repo, e.Host, state)
+	}
+
+	return fmt.Sprintf("sync conflict in %q on %s (%s): %s", e.Repo, e.Host, state, strings.Join(e.Paths, ", "))
+}
+
+// rebaseInProgress reports if git has rebase state in the repository,
+// which is left behind by both interactive and am-style rebases.
+func (conf *GitRepository) rebaseInProgress() bool {
+	gitDir := filepath.Join(conf.Path, ".git")
+	return util.FileExists(filepath.Join(gitDir, "rebase-merge")) || util.FileExists(filepath.Join(gitDir, "rebase-apply"))
+}
+
+// conflictedPaths returns the sorted names of all files with unmerged
+// entries in the index.
+func (conf *GitRepository) conflictedPaths() ([]string, error) {
+	repo, err := git.PlainOpen(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	out := []string{}
+	for _, entry := range idx.Entries {
+		// merged entries decode as stage 0, even though go-git's
+		// index.Merged constant is (incorrectly) 1.
+		if entry.Stage == 0 || seen[entry.Name] {
+			continue
+		}
+		seen[entry.Name] = true
+		out = append(out, entry.Name)
+	}
+	slices.Sort(out)
+
+	return out, nil
+}
+
+func (conf *GitRepository) headRef() string {
+	repo, err := git.PlainOpen(conf.Path)
+	if err != nil {
+		return ""
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+
+	return head.Hash().String()
+}
+
+// checkConflicts inspects the repository after a failed sync. If git
+// stopped mid-rebase, it collects the conflicting paths, aborts the
+// rebase, and returns a *ConflictError wrapping the original error;
+// otherwise it returns the original error unchanged.
+func (conf *GitRepository) checkConflicts(ctx context.Context, id, host string, sender send.Sender, err error) error {
+	if !conf.rebaseInProgress() {
+		return err
+	}
+
+	cerr := &ConflictError{Repo: conf.Name, Path: conf.Path, Host: host, Err: err}
+
+	paths, perr := conf.conflictedPaths()
+	cerr.Paths = paths
+
+	if aerr := jasper.Context(ctx).
+		CreateCommand(ctx).
+		ID(id).
+		SetOutputSender(level.Info, sender).
+		SetErrorSender(level.Info, sender).
+		Directory(conf.Path).
+		AppendArgs("git", "rebase", "--abort").
+		Run(ctx); aerr != nil {
+		cerr.Err = erc.Join(err, perr, ers.Wrap(aerr, "aborting rebase"))
+		return cerr
+	}
+
+	cerr.Aborted = !conf.rebaseInProgress()
+	cerr.Head = conf.headRef()
+	cerr.Err = erc.Join(err, perr)
+
+	return cerr
+}
+
+// remoteConflictError returns a *ConflictError for a sync that failed
+// because the rebase on the mirror host stopped, with the conflicting
+// paths that remoteRebaseCmd reported; otherwise it returns the error
+// unchanged.
+func (conf *GitRepository) remoteConflictError(host string, err error) error {
+	var terr *transportError
+	if host == "" || !errors.As(err, &terr) || !strings.Contains(terr.stderr, remoteConflictMarker) {
+		return err
+	}
+
+	cerr := &ConflictError{Repo: conf.Name, Path: conf.Path, Host: host, Paths: []string{}, Err: err}
+	for line := range strings.Lines(terr.stderr) {
+		line = strings.TrimSpace(line)
+		if path, ok := strings.CutPrefix(line, remoteConflictPath); ok {
+			cerr.Paths = append(cerr.Paths, path)
+		} else if line == remoteRebaseAborted {
+			cerr.Aborted = true
+		}
+	}
+	slices.Sort(cerr.Paths)
+
+	return cerr
+}
+
+// checkRebaseState returns a *ConflictError if the repository is
+// already mid-rebase before a sync begins. Rebases that the sync did
+// not start are never aborted automatically.
+func (conf *GitRepository) checkRebaseState(host string) error {
+	if _, err := os.Stat(conf.Path); err != nil || !conf.rebaseInProgress() {
+		return nil
+	}
+
+	paths, err := conf.conflictedPaths()
+	return &ConflictError{
+		Repo:  conf.Name,
+		Path:  conf.Path,
+		Host:  host,
+		Head:  conf.headRef(),
+		Paths: paths,
+		Err:   erc.Join(ErrRebaseInProgress, err),
+	}
+}
+
+func (conf *GitRepository) notifyConflict(ctx context.Context, opName, id string, err error) {
+	srv.RemoteNotify(ctx).Error(message.WrapError(err, message.Fields{
+		"op":   opName,
+		"id":   id,
+		"repo": conf.Name,
+		"path": conf.Path,
+		"host": util.GetHostname(),
+	}))
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestRemoteConflictError(t *testing.T) {
+	conf := &GitRepository{Name: "notes", Path: "/src/notes"}
+	stderr := "Auto-merging b.txt\nCONFLICT (content): Merge conflict in b.txt\n" +
+		remoteConflictMarker + "\n" +
+		remoteConflictPath + "b.txt\n" +
+		remoteConflictPath + "a.txt\n" +
+		remoteRebaseAborted + "\n"
+
+	t.Run("Conflict", func(t *testing.T) {
+		cause := asTransportError(errors.New("exit status 1"), stderr)
+		err := conf.remoteConflictError("mirror", cause)
+
+		var cerr *ConflictError
+		if !errors.As(err, &cerr) {
+			t.Fatalf("expected a conflict error, got %v", err)
+		}
+		if cerr.Host != "mirror" || !cerr.Aborted || !slices.Equal(cerr.Paths, []string{"a.txt", "b.txt"}) {
+			t.Errorf("unexpected conflict %+v", cerr)
+		}
+		if !errors.Is(err, cause) {
+			t.Error("conflict should wrap the sync error")
+		}
+	})
+	t.Run("AbortFailed", func(t *testing.T) {
+		err := conf.remoteConflictError("mirror", asTransportError(errors.New("exit status 1"), remoteConflictMarker+"\n"))
+
+		var cerr *ConflictError
+		if !errors.As(err, &cerr) || cerr.Aborted || len(cerr.Paths) != 0 {
+			t.Errorf("unexpected conflict %v", err)
+		}
+	})
+	t.Run("Passthrough", func(t *testing.T) {
+		for name, err := range map[string]error{
+			"Local":        asTransportError(errors.New("exit status 1"), stderr),
+			"OtherError":   asTransportError(errors.New("exit status 255"), "ssh: connect to host mirror port 22: Connection refused"),
+			"NotTransport": errors.New(remoteConflictMarker),
+		} {
+			host := "mirror"
+			if name == "Local" {
+				host = ""
+			}
+			if got := conf.remoteConflictError(host, err); got != err {
+				t.Errorf("%s: error should pass through unchanged, got %v", name, got)
+			}
+		}
+	})
+}
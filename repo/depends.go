@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/fun/irt"
+	"github.com/tychoish/fun/wpa"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+)
+
+const ErrBlocked ers.Error = "blocked by failed dependency"
+
+// validateDependencies checks that every dependency names a
+// configured repository and that dependencies do not form a cycle.
+func validateDependencies(repos []GitRepository) error {
+	ec := &erc.Collector{}
+
+	index := make(map[string]*GitRepository, len(repos))
+	for idx := range repos {
+		index[repos[idx].Name] = &repos[idx]
+	}
+
+	for _, rp := range repos {
+		for _, dep := range rp.DependsOn {
+			ec.Whenf(index[dep] == nil, "repository %q depends on %q, which is not configured", rp.Name, dep)
+			ec.Whenf(dep == rp.Name, "repository %q depends on itself", rp.Name)
+		}
+	}
+	if !ec.Ok() {
+		return ec.Resolve()
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(repos))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			start := slices.Index(path, name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path[start:], name), " -> "))
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range index[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, rp := range repos {
+		if err := visit(rp.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Layers sorts repositories into dependency layers: every repository
+// comes in a later layer than all of its dependencies. Dependencies on
+// repositories that are not in the set are ignored.
+func Layers(repos []GitRepository) ([][]GitRepository, error) {
+	inSet := make(map[string]bool, len(repos))
+	for _, rp := range repos {
+		inSet[rp.Name] = true
+	}
+
+	done := map[string]bool{}
+	remaining := slices.Clone(repos)
+	var out [][]GitRepository
+
+	for len(remaining) > 0 {
+		var layer, next []GitRepository
+		for _, rp := range remaining {
+			if slices.ContainsFunc(rp.DependsOn, func(dep string) bool { return inSet[dep] && !done[dep] }) {
+				next = append(next, rp)
+			} else {
+				layer = append(layer, rp)
+			}
+		}
+
+		if len(layer) == 0 {
+			names := make([]string, 0, len(next))
+			for _, rp := range next {
+				names = append(names, rp.Name)
+			}
+			return nil, fmt.Errorf("dependency cycle between %s", strings.Join(names, ", "))
+		}
+
+		for _, rp := range layer {
+			done[rp.Name] = true
+		}
+
+		out = append(out, layer)
+		remaining = next
+	}
+
+	return out, nil
+}
+
+// BatchJob runs a job for every repository in dependency order. Each
+// layer runs in parallel, and later layers start once the previous
+// layer completes. Repositories that depend on a repository whose job
+// failed or was blocked are skipped, and reported as blocked. The job
+// function may return nil to skip a repository.
+func BatchJob(repos []GitRepository, job func(GitRepository) fnx.Worker) fnx.Worker {
+	const opName = "repo-batch"
+
+	return func(ctx context.Context) error {
+		layers, err := Layers(repos)
+		if err != nil {
+			return err
+		}
+
+		ec := &erc.Collector{}
+		mtx := &sync.Mutex{}
+		failed := map[string]bool{}
+
+		for _, layer := range layers {
+			var workers []fnx.Worker
+			for _, rp := range layer {
+				if blocker := slices.IndexFunc(rp.DependsOn, func(dep string) bool { return failed[dep] }); blocker >= 0 {
+					failed[rp.Name] = true
+					ec.Push(ers.Wrapf(ErrBlocked, "%s is blocked by %s", rp.Name, rp.DependsOn[blocker]))
+					grip.Warning(message.NewKV().
+						KV("op", opName).
+						KV("state", "BLOCKED").
+						KV("repo", rp.Name).
+						KV("dependency", rp.DependsOn[blocker]))
+					continue
+				}
+
+				wf := job(rp)
+				if wf == nil {
+					continue
+				}
+
+				name := rp.Name
+				workers = append(workers, wf.WithErrorFilter(func(err error) error {
+					if err != nil {
+						mtx.Lock()
+						failed[name] = true
+						mtx.Unlock()
+					}
+					return err
+				}))
+			}
+
+			if len(workers) == 0 {
+				continue
+			}
+
+			ec.Push(wpa.RunWithPool(irt.Slice(workers),
+				wpa.WorkerGroupConfContinueOnError(),
+				wpa.WorkerGroupConfWorkerPerCPU(),
+			).Run(ctx))
+
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		return ec.Resolve()
+	}
+}
@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tychoish/fun/fnx"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		repos []GitRepository
+		err   string
+	}{
+		{
+			name: "Valid",
+			repos: []GitRepository{
+				{Name: "a"},
+				{Name: "b", DependsOn: []string{"a"}},
+				{Name: "c", DependsOn: []string{"a", "b"}},
+			},
+		},
+		{
+			name:  "Missing",
+			repos: []GitRepository{{Name: "a", DependsOn: []string{"nothing"}}},
+			err:   `depends on "nothing", which is not configured`,
+		},
+		{
+			name:  "Self",
+			repos: []GitRepository{{Name: "a", DependsOn: []string{"a"}}},
+			err:   "depends on itself",
+		},
+		{
+			name: "Cycle",
+			repos: []GitRepository{
+				{Name: "a", DependsOn: []string{"c"}},
+				{Name: "b", DependsOn: []string{"a"}},
+				{Name: "c", DependsOn: []string{"b"}},
+			},
+			err: "dependency cycle: a -> c -> b -> a",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDependencies(tt.repos)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatal(err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLayers(t *testing.T) {
+	t.Run("Ordered", func(t *testing.T) {
+		layers, err := Layers([]GitRepository{
+			{Name: "app", DependsOn: []string{"lib", "tools"}},
+			{Name: "lib", DependsOn: []string{"base"}},
+			{Name: "base"},
+			{Name: "tools"},
+			{Name: "docs", DependsOn: []string{"unselected"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := [][]string{{"base", "tools", "docs"}, {"lib"}, {"app"}}
+		if len(layers) != len(want) {
+			t.Fatalf("got %d layers, want %d", len(layers), len(want))
+		}
+		for idx := range want {
+			if got := repoNames(layers[idx]); !slices.Equal(got, want[idx]) {
+				t.Errorf("layer %d is %v, want %v", idx, got, want[idx])
+			}
+		}
+	})
+	t.Run("Cycle", func(t *testing.T) {
+		if _, err := Layers([]GitRepository{
+			{Name: "a", DependsOn: []string{"b"}},
+			{Name: "b", DependsOn: []string{"a"}},
+		}); err == nil {
+			t.Fatal("expected an error for a cycle")
+		}
+	})
+}
+
+func TestBatchJob(t *testing.T) {
+	repos := []GitRepository{
+		{Name: "base"},
+		{Name: "broken"},
+		{Name: "lib", DependsOn: []string{"base"}},
+		{Name: "app", DependsOn: []string{"lib", "broken"}},
+		{Name: "cli", DependsOn: []string{"app"}},
+		{Name: "skipped"},
+	}
+
+	mtx := &sync.Mutex{}
+	var ran []string
+	errBroken := errors.New("broken")
+
+	err := BatchJob(repos, func(rp GitRepository) fnx.Worker {
+		if rp.Name == "skipped" {
+			return nil
+		}
+		return func(context.Context) error {
+			mtx.Lock()
+			defer mtx.Unlock()
+			ran = append(ran, rp.Name)
+			if rp.Name == "broken" {
+				return errBroken
+			}
+			return nil
+		}
+	}).Run(t.Context())
+
+	if !errors.Is(err, errBroken) {
+		t.Errorf("expected the job error, got %v", err)
+	}
+	if !errors.Is(err, ErrBlocked) {
+		t.Errorf("expected the dependents to be blocked, got %v", err)
+	}
+
+	slices.Sort(ran)
+	if !slices.Equal(ran, []string{"base", "broken", "lib"}) {
+		t.Errorf("unexpected jobs ran: %v", ran)
+	}
+}
@@ -0,0 +1,239 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/sardis/srv"
+)
+
+// maxDigestSubjects limits the number of commit subjects listed for
+// each repository in rendered digests.
+const maxDigestSubjects = 16
+
+// Digest summarizes the commits pulled into a repository by a fetch
+// or update.
+type Digest struct {
+	Repo     string    `bson:"repo" json:"repo" yaml:"repo"`
+	Branch   string    `bson:"branch" json:"branch" yaml:"branch"`
+	OldRef   string    `bson:"old_ref" json:"old_ref" yaml:"old_ref"`
+	NewRef   string    `bson:"new_ref" json:"new_ref" yaml:"new_ref"`
+	Commits  int       `bson:"commits" json:"commits" yaml:"commits"`
+	Authors  []string  `bson:"authors" json:"authors" yaml:"authors"`
+	Subjects []string  `bson:"subjects" json:"subjects" yaml:"subjects"`
+	DiffStat *DiffStat `bson:"diffstat,omitempty" json:"diffstat,omitempty" yaml:"diffstat,omitempty"`
+
+	notify bool
+}
+
+type DiffStat struct {
+	Files      int `bson:"files" json:"files" yaml:"files"`
+	Insertions int `bson:"insertions" json:"insertions" yaml:"insertions"`
+	Deletions  int `bson:"deletions" json:"deletions" yaml:"deletions"`
+}
+
+func (d *Digest) Message() *message.KV {
+	msg := message.NewKV().
+		KV("repo", d.Repo).
+		KV("branch", d.Branch).
+		KV("old", d.OldRef).
+		KV("new", d.NewRef).
+		KV("commits", d.Commits).
+		KV("authors", d.Authors)
+	if d.DiffStat != nil {
+		msg.KV("files", d.DiffStat.Files).
+			KV("insertions", d.DiffStat.Insertions).
+			KV("deletions", d.DiffStat.Deletions)
+	}
+	return msg
+}
+
+func (d *Digest) String() string {
+	buf := &strings.Builder{}
+
+	fmt.Fprintf(buf, "%s (%s): %d commit(s) %s..%s by %s\n",
+		d.Repo, d.Branch, d.Commits, shortRef(d.OldRef), shortRef(d.NewRef), strings.Join(d.Authors, ", "))
+	if d.DiffStat != nil {
+		fmt.Fprintf(buf, "    %d file(s) changed, %d insertion(s), %d deletion(s)\n",
+			d.DiffStat.Files, d.DiffStat.Insertions, d.DiffStat.Deletions)
+	}
+
+	for idx, subject := range d.Subjects {
+		if idx == maxDigestSubjects {
+			fmt.Fprintf(buf, "    ... and %d more\n", len(d.Subjects)-idx)
+			break
+		}
+		fmt.Fprintf(buf, "    - %s\n", subject)
+	}
+
+	return buf.String()
+}
+
+func shortRef(ref string) string { return ref[:min(len(ref), 8)] }
+
+// digest collects the commits reachable from newRef that are not
+// reachable from oldRef.
+func (conf *GitRepository) digest(oldRef, newRef string, withStat bool) (*Digest, error) {
+	repo, err := git.PlainOpen(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	oldCommit, err := repo.CommitObject(plumbing.NewHash(oldRef))
+	if err != nil {
+		return nil, err
+	}
+	newCommit, err := repo.CommitObject(plumbing.NewHash(newRef))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Digest{Repo: conf.Name, Branch: conf.Branch, OldRef: oldRef, NewRef: newRef, notify: conf.Notify}
+
+	err = walkSince(newCommit, []*object.Commit{oldCommit}, func(c *object.Commit) error {
+		out.Commits++
+		out.Subjects = append(out.Subjects, strings.TrimSpace(strings.SplitN(c.Message, "\n", 2)[0]))
+		if !slices.Contains(out.Authors, c.Author.Name) {
+			out.Authors = append(out.Authors, c.Author.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if withStat {
+		patch, err := oldCommit.Patch(newCommit)
+		if err != nil {
+			return nil, err
+		}
+
+		out.DiffStat = &DiffStat{}
+		for _, fs := range patch.Stats() {
+			out.DiffStat.Files++
+			out.DiffStat.Insertions += fs.Addition
+			out.DiffStat.Deletions += fs.Deletion
+		}
+	}
+
+	return out, nil
+}
+
+// recordDigest adds the digest of the commits between oldRef and
+// newRef to the collector in the context, if there is one.
+func (conf *GitRepository) recordDigest(ctx context.Context, oldRef, newRef string) {
+	dc := DigestCollectorFrom(ctx)
+	if dc == nil || oldRef == "" || newRef == "" || oldRef == newRef {
+		return
+	}
+
+	digest, err := conf.digest(oldRef, newRef, dc.Stat)
+	if err != nil {
+		grip.Warning(message.WrapError(err, message.Fields{
+			"op":   "repo-digest",
+			"repo": conf.Name,
+			"old":  oldRef,
+			"new":  newRef,
+		}))
+		return
+	}
+
+	dc.Add(digest)
+}
+
+// DigestCollector aggregates the digests of all repositories pulled
+// during a batch run.
+type DigestCollector struct {
+	// Stat adds a diffstat to each digest.
+	Stat bool
+
+	mtx     sync.Mutex
+	digests []*Digest
+}
+
+type digestCtxKey struct{}
+
+func WithDigestCollector(ctx context.Context, dc *DigestCollector) context.Context {
+	return context.WithValue(ctx, digestCtxKey{}, dc)
+}
+
+func DigestCollectorFrom(ctx context.Context) *DigestCollector {
+	dc, _ := ctx.Value(digestCtxKey{}).(*DigestCollector)
+	return dc
+}
+
+func (dc *DigestCollector) Add(d *Digest) {
+	dc.mtx.Lock()
+	defer dc.mtx.Unlock()
+	dc.digests = append(dc.digests, d)
+}
+
+// Digests returns the collected digests, sorted by repository name.
+func (dc *DigestCollector) Digests() []*Digest {
+	dc.mtx.Lock()
+	defer dc.mtx.Unlock()
+
+	out := slices.Clone(dc.digests)
+	slices.SortFunc(out, func(a, b *Digest) int { return strings.Compare(a.Repo, b.Repo) })
+	return out
+}
+
+// Report renders the collected digests as a single report, or the
+// empty string when nothing was pulled.
+func (dc *DigestCollector) Report() string { return renderDigests(dc.Digests()) }
+
+func renderDigests(digests []*Digest) string {
+	if len(digests) == 0 {
+		return ""
+	}
+
+	var commits int
+	for _, d := range digests {
+		commits += d.Commits
+	}
+
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "pulled %d commit(s) into %d repositories\n", commits, len(digests))
+	for _, d := range digests {
+		buf.WriteString(d.String())
+	}
+	return buf.String()
+}
+
+// Worker runs the worker with the collector in its context, and then
+// sends the aggregated digest of the repositories that have
+// notifications enabled to the remote notifier.
+func (dc *DigestCollector) Worker(wf fnx.Worker) fnx.Worker {
+	return func(ctx context.Context) error {
+		err := wf.Run(WithDigestCollector(ctx, dc))
+
+		notify := slices.DeleteFunc(dc.Digests(), func(d *Digest) bool { return !d.notify })
+		if report := renderDigests(notify); report != "" {
+			srv.RemoteNotify(ctx).Notice(message.MakeString(report))
+		}
+
+		return err
+	}
+}
+
+// withDigest runs the worker with a new digest collector for every
+// run, and logs the resulting report.
+func withDigest(wf fnx.Worker) fnx.Worker {
+	return func(ctx context.Context) error {
+		dc := &DigestCollector{}
+		err := dc.Worker(wf).Run(ctx)
+		if report := dc.Report(); report != "" {
+			grip.Notice(message.MakeString(report))
+		}
+		return err
+	}
+}
@@ -0,0 +1,173 @@
+package repo
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/sardis/util"
+)
+
+type Discovery struct {
+	SearchPaths        []string `bson:"search" json:"search" yaml:"search"`
+	IgnorePathPrefixes []string `bson:"ignore_path_prefixes" json:"ignore_path_prefixes" yaml:"ignore_path_prefixes"`
+	MaxDepth           int      `bson:"max_depth" json:"max_depth" yaml:"max_depth"`
+}
+
+func (disco *Discovery) Join(mcf *Discovery) {
+	if mcf == nil {
+		return
+	}
+
+	disco.SearchPaths = append(disco.SearchPaths, mcf.SearchPaths...)
+	disco.IgnorePathPrefixes = append(disco.IgnorePathPrefixes, mcf.IgnorePathPrefixes...)
+	disco.MaxDepth = max(disco.MaxDepth, mcf.MaxDepth)
+}
+
+func (disco *Discovery) Validate() error {
+	ec := &erc.Collector{}
+
+	if len(disco.SearchPaths) == 0 {
+		disco.SearchPaths = append(disco.SearchPaths, util.GetHomeDir())
+	}
+	disco.MaxDepth = util.Default(disco.MaxDepth, 4)
+
+	disco.SearchPaths = util.TryExpandHomeDirs(disco.SearchPaths)
+	disco.IgnorePathPrefixes = util.TryExpandHomeDirs(disco.IgnorePathPrefixes)
+
+	for _, path := range disco.SearchPaths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			ec.Wrapf(err, "repo search tree %q", path)
+			continue
+		}
+		ec.Whenf(!stat.IsDir(), "repo search tree %q is not a directory", path)
+	}
+	ec.Whenf(disco.MaxDepth < 0, "max depth %d cannot be negative", disco.MaxDepth)
+
+	slices.Sort(disco.SearchPaths)
+	disco.SearchPaths = slices.Compact(disco.SearchPaths)
+
+	return ec.Resolve()
+}
+
+// Discover walks the search paths and returns a configuration entry
+// for every git repository that is not already configured. Names are
+// the directory name, disambiguated with the parent directory when
+// needed, and tags are the directories between the search root and
+// the repository.
+func (conf *Configuration) Discover() ([]GitRepository, error) {
+	disco := conf.Discovery
+	if disco == nil {
+		disco = &Discovery{}
+	}
+	if err := disco.Validate(); err != nil {
+		return nil, err
+	}
+
+	managed := map[string]bool{}
+	names := map[string]bool{}
+	for _, rp := range conf.GitRepos {
+		managed[filepath.Clean(util.TryExpandHomeDir(rp.Path))] = true
+		names[rp.Name] = true
+	}
+
+	ec := &erc.Collector{}
+	out := []GitRepository{}
+
+	for _, root := range disco.SearchPaths {
+		rootDepth := strings.Count(filepath.Clean(root), string(filepath.Separator))
+
+		ec.Push(filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			switch {
+			case err != nil && errors.Is(err, fs.ErrPermission):
+				return fs.SkipDir
+			case err != nil:
+				return err
+			case !d.IsDir():
+				return nil
+			case path != root && strings.HasPrefix(d.Name(), "."):
+				return fs.SkipDir
+			case hasAnyPrefix(path, disco.IgnorePathPrefixes):
+				return fs.SkipDir
+			case strings.Count(path, string(filepath.Separator))-rootDepth > disco.MaxDepth:
+				return fs.SkipDir
+			case !util.FileExists(filepath.Join(path, ".git")):
+				return nil
+			case managed[filepath.Clean(path)]:
+				return fs.SkipDir
+			}
+
+			rp, err := discoverRepository(root, path)
+			if err != nil {
+				ec.Wrapf(err, "reading repository at %q", path)
+				return fs.SkipDir
+			}
+
+			if names[rp.Name] {
+				rp.Name = util.DotJoin(filepath.Base(filepath.Dir(path)), rp.Name)
+			}
+			names[rp.Name] = true
+
+			out = append(out, *rp)
+			return fs.SkipDir
+		}))
+	}
+
+	return out, ec.Resolve()
+}
+
+func discoverRepository(root, path string) (*GitRepository, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &GitRepository{
+		Name: filepath.Base(path),
+		Path: util.TryCollapseHomeDir(path),
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, remote := range remotes {
+		rc := remote.Config()
+		if len(rc.URLs) == 0 {
+			continue
+		}
+
+		if out.Remote == "" || rc.Name == "origin" {
+			out.Remote = rc.URLs[0]
+			out.RemoteName = rc.Name
+		}
+	}
+
+	if head, err := repo.Head(); err == nil && head.Name().IsBranch() {
+		out.Branch = head.Name().Short()
+	}
+
+	if rel, err := filepath.Rel(root, filepath.Dir(path)); err == nil && rel != "." {
+		out.Tags = strings.Split(rel, string(filepath.Separator))
+	} else {
+		out.Tags = []string{filepath.Base(root)}
+	}
+
+	return out, nil
+}
+
+func hasAnyPrefix(str string, prefixes []string) bool {
+	for _, pf := range prefixes {
+		if strings.HasPrefix(str, pf) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/sardis/util"
+)
+
+type CheckKind string
+
+const (
+	CheckMissing       CheckKind = "missing"
+	CheckNotRepository CheckKind = "not-a-repository"
+	CheckRebase        CheckKind = "rebase-in-progress"
+	CheckRemoteMissing CheckKind = "remote-missing"
+	CheckRemoteURL     CheckKind = "remote-url"
+	CheckDetachedHead  CheckKind = "detached-head"
+	CheckWrongBranch   CheckKind = "wrong-branch"
+	CheckUpstream      CheckKind = "upstream"
+	CheckGitConfig     CheckKind = "git-config"
+)
+
+// Finding is a single difference between the configuration of a
+// repository and its checkout. Fixable findings can be repaired
+// without risking local changes.
+type Finding struct {
+	Check   CheckKind `bson:"check" json:"check" yaml:"check"`
+	Message string    `bson:"message" json:"message" yaml:"message"`
+	Fixable bool      `bson:"fixable" json:"fixable" yaml:"fixable"`
+	Fixed   bool      `bson:"fixed" json:"fixed" yaml:"fixed"`
+	Error   string    `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Diagnosis collects the findings for one repository.
+type Diagnosis struct {
+	Name     string    `bson:"name" json:"name" yaml:"name"`
+	Path     string    `bson:"path" json:"path" yaml:"path"`
+	Findings []Finding `bson:"findings" json:"findings" yaml:"findings"`
+	Error    string    `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Healthy reports if the checkout matches the configuration, or if
+// every finding was fixed.
+func (d *Diagnosis) Healthy() bool {
+	return d.Error == "" && !slices.ContainsFunc(d.Findings, func(f Finding) bool { return !f.Fixed })
+}
+
+// doctor accumulates findings, and applies fixes when requested.
+type doctor struct {
+	conf *GitRepository
+	out  *Diagnosis
+	fix  bool
+}
+
+func (d *doctor) report(check CheckKind, format string, args ...any) {
+	d.out.Findings = append(d.out.Findings, Finding{Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *doctor) repair(check CheckKind, fix func() error, format string, args ...any) {
+	finding := Finding{Check: check, Message: fmt.Sprintf(format, args...), Fixable: true}
+	if d.fix {
+		if err := fix(); err != nil {
+			finding.Error = err.Error()
+		} else {
+			finding.Fixed = true
+		}
+
+		grip.Info(message.NewKV().
+			KV("op", "repo-doctor").
+			KV("repo", d.conf.Name).
+			KV("path", d.conf.Path).
+			KV("check", check).
+			KV("fixed", finding.Fixed).
+			KV("err", finding.Error))
+	}
+	d.out.Findings = append(d.out.Findings, finding)
+}
+
+// Doctor compares the checkout of the repository with its
+// configuration. When fix is true, it repairs the findings that are
+// safe to repair: remote urls, upstream tracking, git config, and
+// (when the worktree is clean) the checked out branch. Interrupted
+// rebases are reported but never aborted. Canceling the context stops
+// the diagnosis between checks.
+func (conf *GitRepository) Doctor(ctx context.Context, fix bool) (*Diagnosis, error) {
+	d := &doctor{conf: conf, fix: fix, out: &Diagnosis{Name: conf.Name, Path: conf.Path}}
+
+	if !util.FileExists(conf.Path) {
+		d.report(CheckMissing, "%q does not exist; run repo clone", conf.Path)
+		return d.out, nil
+	}
+
+	repo, err := git.PlainOpen(conf.Path)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		d.report(CheckNotRepository, "%q is not a git repository", conf.Path)
+		return d.out, nil
+	} else if err != nil {
+		return d.out, err
+	}
+
+	if conf.rebaseInProgress() {
+		d.report(CheckRebase, "an interrupted rebase must be continued or aborted by hand")
+	}
+
+	for _, check := range []func() error{
+		func() error { return d.checkRemotes(repo) },
+		func() error { return d.checkBranch(repo) },
+		func() error { return d.checkUpstream(repo) },
+		func() error { return d.checkGitConfig(ctx) },
+	} {
+		if err := ctx.Err(); err != nil {
+			return d.out, err
+		}
+		if err := check(); err != nil {
+			return d.out, err
+		}
+	}
+
+	return d.out, nil
+}
+
+func (d *doctor) checkRemotes(repo *git.Repository) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+
+	for _, rm := range d.conf.AllRemotes() {
+		if rm.URL == "" {
+			continue
+		}
+
+		existing, ok := cfg.Remotes[rm.Name]
+		switch {
+		case !ok:
+			d.repair(CheckRemoteMissing, func() error {
+				_, err := repo.CreateRemote(&config.RemoteConfig{Name: rm.Name, URLs: []string{rm.URL}})
+				return err
+			}, "remote %q is not configured", rm.Name)
+		case len(existing.URLs) == 0 || existing.URLs[0] != rm.URL:
+			d.repair(CheckRemoteURL, func() error {
+				cfg, err := repo.Config()
+				if err != nil {
+					return err
+				}
+				cfg.Remotes[rm.Name].URLs = []string{rm.URL}
+				return repo.SetConfig(cfg)
+			}, "remote %q is %q, not %q", rm.Name, existing.URLs, rm.URL)
+		}
+	}
+
+	return nil
+}
+
+func (d *doctor) checkBranch(repo *git.Repository) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	var check CheckKind
+	switch {
+	case !head.Name().IsBranch():
+		check = CheckDetachedHead
+	case head.Name().Short() != d.conf.Branch:
+		check = CheckWrongBranch
+	default:
+		return nil
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	stat, err := wt.Status()
+	if err != nil {
+		return err
+	}
+
+	if !stat.IsClean() {
+		d.report(check, "checkout is at %s, not %q, and has local changes", head.Name().Short(), d.conf.Branch)
+		return nil
+	}
+
+	d.repair(check, func() error {
+		opts := &git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(d.conf.Branch)}
+
+		if _, err := repo.Reference(opts.Branch, true); errors.Is(err, plumbing.ErrReferenceNotFound) {
+			remote, err := repo.Reference(plumbing.NewRemoteReferenceName(d.conf.RemoteName, d.conf.Branch), true)
+			if err != nil {
+				return fmt.Errorf("branch %q does not exist locally or on %q: %w", d.conf.Branch, d.conf.RemoteName, err)
+			}
+			opts.Create = true
+			opts.Hash = remote.Hash()
+		} else if err != nil {
+			return err
+		}
+
+		return wt.Checkout(opts)
+	}, "checkout is at %s, not %q", head.Name().Short(), d.conf.Branch)
+
+	return nil
+}
+
+func (d *doctor) checkUpstream(repo *git.Repository) error {
+	if _, err := repo.Reference(plumbing.NewBranchReferenceName(d.conf.Branch), true); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+
+	merge := plumbing.NewBranchReferenceName(d.conf.Branch)
+	if br, ok := cfg.Branches[d.conf.Branch]; ok && br.Remote == d.conf.RemoteName && br.Merge == merge {
+		return nil
+	}
+
+	d.repair(CheckUpstream, func() error {
+		cfg, err := repo.Config()
+		if err != nil {
+			return err
+		}
+
+		br, ok := cfg.Branches[d.conf.Branch]
+		if !ok {
+			br = &config.Branch{Name: d.conf.Branch}
+			cfg.Branches[d.conf.Branch] = br
+		}
+		br.Remote = d.conf.RemoteName
+		br.Merge = merge
+
+		return repo.SetConfig(cfg)
+	}, "branch %q does not track %s/%s", d.conf.Branch, d.conf.RemoteName, d.conf.Branch)
+
+	return nil
+}
+
+// checkGitConfig compares the effective value of each declared git
+// config key, which may come from the global configuration, and sets
+// the key in the checkout's configuration to fix it.
+func (d *doctor) checkGitConfig(ctx context.Context) error {
+	for _, key := range d.conf.gitConfigKeys() {
+		want := d.conf.GitConfig[key]
+		got, err := d.conf.readGitConfig(ctx, key, gitConfigType(want))
+		if err != nil {
+			return err
+		}
+		if got == canonicalGitConfig(want) {
+			continue
+		}
+
+		d.repair(CheckGitConfig, func() error {
+			return d.conf.writeGitConfig(ctx, key, want)
+		}, "git config %s is %q, not %q", key, got, want)
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package repo
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tychoish/sardis/subexec"
+	"github.com/tychoish/sardis/util"
+)
+
+// Explain describes what the job for the operation (one of the
+// ScheduledOperations) does to the repository, without running it.
+// Lines are the equivalent shell commands, where the operation has
+// them.
+func (conf *GitRepository) Explain(op string, modes []CleanupMode) subexec.Explanation {
+	exp := subexec.ExplainOperation(util.DotJoin("repo", op, conf.Name), conf.Path, conf.describe(op, modes))
+	exp.Notify = conf.Notify
+
+	switch op {
+	case "clone":
+		exp.Lines = conf.cloneLines()
+	case "fetch":
+		exp.Lines = conf.fetchLines()
+	case "sync":
+		hn := util.GetHostname()
+		exp.Lines = conf.syncLines(hn, hn)
+	case "update":
+		hn := util.GetHostname()
+		mirrored := false
+		for _, mirror := range conf.Mirrors {
+			if !strings.Contains(mirror, hn) {
+				mirrored = true
+				exp.Lines = append(exp.Lines, conf.syncLines(mirror, hn)...)
+			}
+		}
+		if conf.LocalSync {
+			exp.Lines = append(exp.Lines, "# when there are local changes:")
+			exp.Lines = append(exp.Lines, conf.syncLines(hn, hn)...)
+			exp.Lines = append(exp.Lines, "# otherwise:")
+		}
+		if conf.Fetch || conf.LocalSync || mirrored {
+			exp.Lines = append(exp.Lines, conf.fetchLines()...)
+		}
+	case "cleanup":
+		for _, mode := range conf.cleanupModes(modes) {
+			for _, args := range conf.cleanupArgs(mode) {
+				exp.Lines = append(exp.Lines, strings.Join(args, " "))
+			}
+		}
+	}
+
+	return exp
+}
+
+// ExplainForeach describes what ForeachJob does with the command,
+// without running it.
+func (conf *GitRepository) ExplainForeach(args []string) subexec.Explanation {
+	desc := fmt.Sprintf("run the command in %s", conf.Name)
+	if !util.FileExists(conf.Path) {
+		desc = fmt.Sprintf("nothing: the checkout %q does not exist", util.TryCollapseHomeDir(conf.Path))
+	}
+
+	exp := subexec.ExplainOperation(util.DotJoin("repo", "foreach", conf.Name), conf.Path, desc)
+	exp.Lines = []string{strings.Join(args, " ")}
+	return exp
+}
+
+// ExplainPruneWorktrees describes what PruneWorktrees does, given
+// the results of a dry run.
+func (conf *GitRepository) ExplainPruneWorktrees(results []WorktreeResult) subexec.Explanation {
+	exp := subexec.ExplainOperation(util.DotJoin("repo", "worktree-prune", conf.Name), conf.Path,
+		"remove worktrees whose branches are merged or deleted")
+
+	for _, res := range results {
+		switch {
+		case res.Skipped:
+			exp.Lines = append(exp.Lines, fmt.Sprintf("# skipping %s: %s", res.Path, res.Reason))
+		case res.Prunable:
+			exp.Lines = append(exp.Lines, fmt.Sprintf("git worktree prune # %s: %s", res.Path, res.Reason))
+		default:
+			exp.Lines = append(exp.Lines, fmt.Sprintf("git worktree remove %s # %s", res.Path, res.Reason))
+		}
+	}
+	return exp
+}
+
+// cloneLines are the shell equivalents of CloneJob for a checkout
+// that does not exist. The post hooks run in the parent directory.
+func (conf *GitRepository) cloneLines() []string {
+	lines := append([]string{strings.Join(conf.cloneArgs(), " ")}, conf.Post...)
+	for _, rm := range conf.extraRemotes() {
+		lines = append(lines, fmt.Sprintf("git remote add %s %s", rm.Name, rm.URL))
+	}
+	return lines
+}
+
+// fetchLines are the shell equivalents of FetchJob, which clones
+// checkouts that do not exist.
+func (conf *GitRepository) fetchLines() []string {
+	if !util.FileExists(conf.Path) {
+		return conf.cloneLines()
+	}
+
+	lines := slices.Clone(conf.Pre)
+	switch {
+	case !conf.primaryRemote().Fetches():
+	case conf.Native:
+		// go-git fetches and fast-forwards clean checkouts
+		// itself, and only shells out to pull otherwise.
+		lines = append(lines,
+			fmt.Sprintf("git fetch %s", conf.RemoteName),
+			fmt.Sprintf("git merge --ff-only %s/%s # when the checkout is clean and behind", conf.RemoteName, conf.Branch),
+			strings.Join(conf.pullArgs(), " ")+" # when the branches have diverged or there are local changes",
+		)
+	default:
+		lines = append(lines, strings.Join(conf.pullArgs(), " "))
+	}
+	for _, rm := range conf.extraRemotes() {
+		if rm.Fetches() {
+			lines = append(lines, strings.Join(rm.fetchArgs(), " "))
+		}
+	}
+	return append(lines, conf.Post...)
+}
+
+// syncLines are the shell equivalents of SyncRemoteJob for the host,
+// run by the operator host. The content policy checks are not shell
+// commands, and are not included.
+func (conf *GitRepository) syncLines(host, operator string) []string {
+	buildID := conf.syncID(host, operator)
+	remote := fmt.Sprintf("ssh %s %q", host, conf.remoteSyncCmd(buildID))
+
+	var lines []string
+	if host != operator {
+		lines = append(lines, remote)
+	}
+	lines = append(lines, conf.Pre...)
+	lines = append(lines, "git add -A", "git fetch origin", rebaseCmd, removeDeletedCmd, "git add -A", syncCommitCmd(buildID))
+	for _, cmd := range conf.pushCommands() {
+		lines = append(lines, strings.Join(cmd.args, " "))
+	}
+	if host != operator {
+		lines = append(lines, remote, "git fetch origin", rebaseCmd)
+	}
+	return append(lines, conf.Post...)
+}
+
+func (conf *GitRepository) describe(op string, modes []CleanupMode) string {
+	switch op {
+	case "clone":
+		return fmt.Sprintf("clone %s into %s", conf.Remote, conf.Path)
+	case "fetch":
+		if !util.FileExists(conf.Path) {
+			return fmt.Sprintf("clone %s into %s (the checkout does not exist)", conf.Remote, conf.Path)
+		}
+		return fmt.Sprintf("pull %s/%s into %s and fetch the other remotes", conf.RemoteName, conf.Branch, conf.Name)
+	case "sync":
+		return fmt.Sprintf("commit the changes in %s, rebase on %s/%s, and push", conf.Name, conf.RemoteName, conf.Branch)
+	case "status":
+		return fmt.Sprintf("report the status of %s", conf.Name)
+	case "update":
+		var steps []string
+		for _, mirror := range conf.Mirrors {
+			steps = append(steps, "sync mirror "+mirror)
+		}
+		if conf.LocalSync {
+			steps = append(steps, "commit and push local changes")
+		}
+		if conf.Fetch || conf.LocalSync || len(conf.Mirrors) > 0 {
+			steps = append(steps, fmt.Sprintf("pull %s/%s", conf.RemoteName, conf.Branch))
+		}
+		if len(steps) == 0 {
+			return fmt.Sprintf("nothing: %s does not fetch, sync, or have mirrors", conf.Name)
+		}
+		return fmt.Sprintf("update %s: %s", conf.Name, strings.Join(steps, ", then "))
+	case "cleanup":
+		names := make([]string, 0, len(modes))
+		for _, mode := range conf.cleanupModes(modes) {
+			names = append(names, string(mode))
+		}
+		return fmt.Sprintf("clean up %s with modes %s", conf.Name, strings.Join(names, ","))
+	default:
+		return fmt.Sprintf("%s %s", op, conf.Name)
+	}
+}
+
+// describeBatch describes the batch jobs of the synthetic tag
+// commands, which run the operation for each repository in
+// dependency order.
+func describeBatch(op string, batch []GitRepository) string {
+	names := make([]string, 0, len(batch))
+	for _, rp := range batch {
+		if !rp.Disabled {
+			names = append(names, rp.Name)
+		}
+	}
+	return fmt.Sprintf("%s repositories %s in dependency order", op, strings.Join(names, ", "))
+}
@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func explainTestRepo(t *testing.T) GitRepository {
+	return GitRepository{
+		Name:       "notes",
+		Path:       t.TempDir(),
+		Remote:     "git@github.com:tychoish/notes.git",
+		RemoteName: "origin",
+		Branch:     "main",
+		Pre:        []string{"make pre"},
+		Post:       []string{"make post"},
+		Remotes: []GitRemote{
+			{Name: "upstream", URL: "https://example.com/notes.git", Role: RemoteRoleFetch},
+			{Name: "backup", URL: "backup:notes.git", Role: RemoteRoleMirror},
+		},
+	}
+}
+
+func TestExplainFetch(t *testing.T) {
+	t.Run("Shell", func(t *testing.T) {
+		rc := explainTestRepo(t)
+		want := []string{
+			"make pre",
+			"git pull --keep --rebase --autostash origin main",
+			"git fetch --prune upstream",
+			"make post",
+		}
+		if got := rc.Explain("fetch", nil).Lines; !slices.Equal(got, want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("Native", func(t *testing.T) {
+		rc := explainTestRepo(t)
+		rc.Native = true
+		lines := rc.Explain("fetch", nil).Lines
+		if len(lines) != 6 || lines[1] != "git fetch origin" || !strings.HasPrefix(lines[3], strings.Join(rc.pullArgs(), " ")) {
+			t.Errorf("unexpected native fetch lines %q", lines)
+		}
+	})
+	t.Run("Clone", func(t *testing.T) {
+		rc := explainTestRepo(t)
+		rc.Path = filepath.Join(rc.Path, "notes")
+		lines := rc.Explain("fetch", nil).Lines
+		if len(lines) == 0 || lines[0] != "git clone "+rc.Remote+" "+rc.Path {
+			t.Errorf("unexpected clone lines %q", lines)
+		}
+	})
+}
+
+func TestExplainSync(t *testing.T) {
+	rc := explainTestRepo(t)
+
+	local := rc.syncLines("laptop", "laptop")
+	if slices.ContainsFunc(local, func(line string) bool { return strings.HasPrefix(line, "ssh ") }) {
+		t.Errorf("local sync should not use ssh: %q", local)
+	}
+	for _, want := range []string{"git push origin main", "git push --mirror backup"} {
+		if !slices.Contains(local, want) {
+			t.Errorf("local sync is missing %q: %q", want, local)
+		}
+	}
+	if slices.Contains(local, "git push upstream main") {
+		t.Errorf("local sync pushes to the fetch remote: %q", local)
+	}
+
+	mirror := rc.syncLines("desktop", "laptop")
+	if !strings.HasPrefix(mirror[0], "ssh desktop ") || !strings.Contains(mirror[0], "sync.REMOTE(desktop).REPO(notes).OPERATOR(laptop)") {
+		t.Errorf("mirror sync should start on the mirror: %q", mirror[0])
+	}
+	if mirror[len(mirror)-1] != "make post" {
+		t.Errorf("mirror sync should end with the post hooks: %q", mirror)
+	}
+}
+
+func TestExplainPrimaryRemoteRole(t *testing.T) {
+	t.Run("MirrorPrimary", func(t *testing.T) {
+		rc := explainTestRepo(t)
+		rc.Remotes = append(rc.Remotes, GitRemote{Name: "origin", Role: RemoteRoleMirror})
+
+		fetch := rc.Explain("fetch", nil).Lines
+		if slices.ContainsFunc(fetch, func(line string) bool { return strings.HasPrefix(line, "git pull") }) {
+			t.Errorf("fetch pulls from a mirror primary: %q", fetch)
+		}
+		if !slices.Contains(fetch, "git fetch --prune upstream") {
+			t.Errorf("fetch skips the additional remotes: %q", fetch)
+		}
+
+		local := rc.syncLines("laptop", "laptop")
+		if !slices.Contains(local, "git push --mirror origin") || slices.Contains(local, "git push origin main") {
+			t.Errorf("sync does not mirror the primary: %q", local)
+		}
+	})
+	t.Run("FetchPrimary", func(t *testing.T) {
+		rc := explainTestRepo(t)
+		rc.Remotes = []GitRemote{{Name: "origin", Role: RemoteRoleFetch}}
+
+		if cmds := rc.pushCommands(); len(cmds) != 0 {
+			t.Errorf("sync pushes to a fetch primary: %v", cmds)
+		}
+		if cmd := rc.remoteSyncCmd("build"); !strings.HasSuffix(cmd, "git commit -m 'auto-update: (build)'; true") {
+			t.Errorf("mirror sync pushes to a fetch primary: %q", cmd)
+		}
+	})
+	t.Run("MirrorHostPush", func(t *testing.T) {
+		rc := explainTestRepo(t)
+		cmd := rc.remoteSyncCmd("build")
+		if !strings.HasSuffix(cmd, "{ rc=0; 'git' 'push' 'origin' 'main' || rc=$?; 'git' 'push' '--mirror' 'backup' || rc=$?; [ $rc -eq 0 ]; }") {
+			t.Errorf("mirror sync does not push to every remote: %q", cmd)
+		}
+
+		rc.Remotes = nil
+		if cmd := rc.remoteSyncCmd("build"); !strings.HasSuffix(cmd, "; 'git' 'push'") {
+			t.Errorf("mirror sync without remotes should use a bare push: %q", cmd)
+		}
+	})
+}
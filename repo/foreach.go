@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/history"
+	"github.com/tychoish/sardis/util"
+)
+
+// ForeachResult is the outcome of running a command in a single
+// repository.
+type ForeachResult struct {
+	Repo     string        `bson:"repo" json:"repo" yaml:"repo"`
+	Path     string        `bson:"path" json:"path" yaml:"path"`
+	Duration time.Duration `bson:"dur" json:"dur" yaml:"dur"`
+	ExitCode int           `bson:"exit_code" json:"exit_code" yaml:"exit_code"`
+	Error    string        `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ForeachJob runs a command in the repository's checkout, writing
+// the combined output of the command to output and recording the
+// outcome in result. A single argument is run as a bash script, so
+// that it may contain pipes and redirections; otherwise the arguments
+// are run directly. The command holds the repository lock, so it does
+// not run concurrently with other jobs for the repository.
+func (conf *GitRepository) ForeachJob(args []string, output io.Writer, result *ForeachResult) fnx.Worker {
+	const opName = "repo-foreach"
+
+	return func(ctx context.Context) (err error) {
+		startAt := time.Now()
+		nonce := strings.ToLower(rand.Text())[:7]
+		result.Repo = conf.Name
+		result.Path = conf.Path
+
+		defer func() {
+			result.Duration = time.Since(startAt)
+			if err != nil {
+				result.Error = err.Error()
+				result.ExitCode = -1
+
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					result.ExitCode = exitErr.ExitCode()
+				}
+			}
+
+			history.Add(ctx, history.NewRecord(opName, conf.Name, nonce, startAt, err, ""))
+			grip.Info(message.NewKV().
+				KV("op", opName).
+				KV("run", nonce).
+				KV("repo", conf.Name).
+				KV("dur", result.Duration).
+				KV("err", err != nil))
+		}()
+
+		if len(args) == 0 {
+			return errors.New("no command specified")
+		}
+
+		if _, err := os.Stat(conf.Path); os.IsNotExist(err) {
+			return fmt.Errorf("checkout %q does not exist", util.TryCollapseHomeDir(conf.Path))
+		}
+
+		return conf.withLock(opName, func(ctx context.Context) error {
+			cmd := jasper.Context(ctx).CreateCommand(ctx).
+				ID(util.DotJoin(opName, conf.Name)).
+				Directory(conf.Path).
+				SetCombinedWriter(util.NopWriteCloser(output))
+
+			if len(args) == 1 {
+				cmd.ShellScript("bash", args[0])
+			} else {
+				cmd.AppendArgs(args...)
+			}
+
+			return cmd.Run(ctx)
+		}).Run(ctx)
+	}
+}
@@ -0,0 +1,257 @@
+package repo
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/sardis/util"
+)
+
+// DefaultForge is the forge that bare `<account>/<name>` remote
+// shorthands resolve to.
+const DefaultForge = "github"
+
+// Forge describes a code hosting service, and the templates used to
+// expand `<forge>:<account>/<name>` (or `<forge>:<name>`, using the
+// default account) remote shorthands. The URL templates may use the
+// {{account}} and {{name}} placeholders.
+type Forge struct {
+	Name     string   `bson:"name" json:"name" yaml:"name"`
+	Aliases  []string `bson:"aliases" json:"aliases" yaml:"aliases"`
+	SSH      string   `bson:"ssh" json:"ssh" yaml:"ssh"`
+	HTTPS    string   `bson:"https" json:"https" yaml:"https"`
+	Protocol string   `bson:"protocol" json:"protocol" yaml:"protocol"`
+	Account  string   `bson:"account" json:"account" yaml:"account"`
+	API      string   `bson:"api" json:"api" yaml:"api"`
+}
+
+// DefaultGitHubAccount is the default account of the github forge,
+// which `sardis repo gh-clone` has always used when no account is
+// given. Configure the github forge's account to use another.
+const DefaultGitHubAccount = "tychoish"
+
+// DefaultForges returns the forges that are available without
+// configuration. Configured forges with the same name override the
+// fields they specify.
+func DefaultForges() Forges {
+	return Forges{
+		{
+			Name:    "github",
+			Aliases: []string{"gh"},
+			SSH:     "git@github.com:{{account}}/{{name}}.git",
+			HTTPS:   "https://github.com/{{account}}/{{name}}.git",
+			Account: DefaultGitHubAccount,
+			API:     "https://api.github.com",
+		},
+		{
+			Name:    "gitlab",
+			Aliases: []string{"gl"},
+			SSH:     "git@gitlab.com:{{account}}/{{name}}.git",
+			HTTPS:   "https://gitlab.com/{{account}}/{{name}}.git",
+			API:     "https://gitlab.com/api/v4",
+		},
+		{
+			Name:    "sourcehut",
+			Aliases: []string{"srht", "sr.ht"},
+			SSH:     "git@git.sr.ht:~{{account}}/{{name}}",
+			HTTPS:   "https://git.sr.ht/~{{account}}/{{name}}",
+			API:     "https://git.sr.ht/query",
+		},
+		{
+			Name:    "codeberg",
+			Aliases: []string{"cb"},
+			SSH:     "git@codeberg.org:{{account}}/{{name}}.git",
+			HTTPS:   "https://codeberg.org/{{account}}/{{name}}.git",
+			API:     "https://codeberg.org/api/v1",
+		},
+	}
+}
+
+func (f *Forge) Validate() error {
+	ec := &erc.Collector{}
+	ec.Whenf(f.Name == "", "forges must have a name")
+	ec.Whenf(f.SSH == "" && f.HTTPS == "", "forge %q must specify an ssh or https url template", f.Name)
+
+	for _, tmpl := range []string{f.SSH, f.HTTPS} {
+		ec.Whenf(tmpl != "" && !strings.Contains(tmpl, "{{name}}"), "url template %q for forge %q must contain {{name}}", tmpl, f.Name)
+	}
+
+	switch f.Protocol {
+	case "":
+	case "ssh", "https":
+		ec.Whenf(f.template() == "", "forge %q has no %s url template", f.Name, f.Protocol)
+	default:
+		ec.Errorf("forge %q has invalid protocol %q", f.Name, f.Protocol)
+	}
+
+	return ec.Resolve()
+}
+
+func (f *Forge) Matches(name string) bool { return f.Name == name || slices.Contains(f.Aliases, name) }
+
+// template returns the url template for the forge's protocol: ssh,
+// unless the forge specifies https or only has an https template.
+func (f *Forge) template() string {
+	switch f.Protocol {
+	case "https":
+		return f.HTTPS
+	case "ssh":
+		return f.SSH
+	default:
+		return util.Default(f.SSH, f.HTTPS)
+	}
+}
+
+// URL renders the remote url for the repository. The forge's default
+// account is used when the account is empty.
+func (f *Forge) URL(account, name string) (string, error) {
+	account = util.Default(account, f.Account)
+	if account == "" {
+		return "", fmt.Errorf("no account specified for %q and forge %q has no default account", name, f.Name)
+	}
+
+	url := f.template()
+	url = strings.ReplaceAll(url, "{{account}}", account)
+	url = strings.ReplaceAll(url, "{{name}}", strings.TrimSuffix(name, ".git"))
+	return url, nil
+}
+
+// join fills the fields that the forge does not specify from the
+// other definition of the same forge, and adds its aliases.
+func (f *Forge) join(mf *Forge) {
+	for _, alias := range mf.Aliases {
+		if !slices.Contains(f.Aliases, alias) {
+			f.Aliases = append(f.Aliases, alias)
+		}
+	}
+	f.SSH = util.Default(f.SSH, mf.SSH)
+	f.HTTPS = util.Default(f.HTTPS, mf.HTTPS)
+	f.Protocol = util.Default(f.Protocol, mf.Protocol)
+	f.Account = util.Default(f.Account, mf.Account)
+	f.API = util.Default(f.API, mf.API)
+}
+
+type Forges []Forge
+
+// Find returns the forge with the name or alias.
+func (fs Forges) Find(name string) (*Forge, bool) {
+	idx := slices.IndexFunc(fs, func(f Forge) bool { return f.Matches(name) })
+	if idx < 0 {
+		return nil, false
+	}
+	return &fs[idx], true
+}
+
+// withDefaults returns the forges, followed by the default forges
+// that they do not override. Forges that override a default forge
+// inherit the fields that they do not specify.
+func (fs Forges) withDefaults() Forges {
+	out := slices.Clone(fs)
+	for _, df := range DefaultForges() {
+		if f, ok := out.Find(df.Name); ok {
+			f.join(&df)
+			continue
+		}
+		out = append(out, df)
+	}
+	return out
+}
+
+func (fs Forges) Validate() error {
+	ec := &erc.Collector{}
+	seen := map[string]string{}
+
+	for idx := range fs {
+		ec.Push(fs[idx].Validate())
+		for _, name := range append([]string{fs[idx].Name}, fs[idx].Aliases...) {
+			if other, ok := seen[name]; ok && other != fs[idx].Name {
+				ec.Errorf("forge name %q is used by %q and %q", name, other, fs[idx].Name)
+			}
+			seen[name] = fs[idx].Name
+		}
+	}
+
+	return ec.Resolve()
+}
+
+// splitForgeShorthand splits `<forge>:<account>/<name>` remote
+// specifications. Shorthands are recognized by their form rather than
+// by the forge, so that misspelled forges are errors rather than
+// remotes on an ssh host: a prefix without a dot is a forge, as is
+// any configured or default forge (e.g. sr.ht). URLs, scp-style
+// remotes with a user or a domain (e.g. git@host:path and
+// host.example.com:path), and paths are not shorthands; ssh host
+// aliases need the ssh:// form.
+func (fs Forges) splitForgeShorthand(spec string) (forge string, rest string, ok bool) {
+	if spec == "" || strings.Contains(spec, "//") || strings.ContainsRune("/.~", rune(spec[0])) {
+		return "", "", false
+	}
+
+	forge, rest, ok = strings.Cut(spec, ":")
+	if !ok || forge == "" || strings.ContainsAny(forge, "@/") {
+		return "", "", false
+	}
+	if _, ok := fs.withDefaults().Find(forge); !ok && strings.Contains(forge, ".") {
+		return "", "", false
+	}
+	return forge, rest, true
+}
+
+// Expand resolves `<forge>:` shorthands into urls, and returns all
+// other remote specifications unchanged.
+func (fs Forges) Expand(spec string) (string, error) {
+	forge, rest, ok := fs.splitForgeShorthand(spec)
+	if !ok {
+		return spec, nil
+	}
+	return fs.expand(spec, forge, rest)
+}
+
+func (fs Forges) expand(spec, forge, rest string) (string, error) {
+	f, ok := fs.withDefaults().Find(forge)
+	if !ok {
+		return "", fmt.Errorf("remote %q has unknown forge %q (use ssh://%s/%s for ssh hosts)", spec, forge, forge, strings.TrimLeft(rest, "/"))
+	}
+
+	rest = strings.Trim(rest, "/")
+	account, name, ok := strings.Cut(rest, "/")
+	if !ok {
+		account, name = "", account
+	}
+
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("remote shorthand %q must have the form <forge>:<account>/<name> or <forge>:<name>", spec)
+	}
+
+	return f.URL(account, name)
+}
+
+// ParseRemote resolves a remote URL or shorthand using the configured
+// forges.
+func (conf *Configuration) ParseRemote(spec string) (*Remote, error) {
+	return conf.Forges.ParseRemote(spec)
+}
+
+// expandRemotes replaces forge shorthands in the remotes of the
+// repository with the urls they resolve to.
+func (conf *Configuration) expandRemotes(rp *GitRepository) error {
+	ec := &erc.Collector{}
+
+	if url, err := conf.Forges.Expand(rp.Remote); err != nil {
+		ec.Wrapf(err, "remote for %q", rp.Name)
+	} else {
+		rp.Remote = url
+	}
+
+	for idx := range rp.Remotes {
+		if url, err := conf.Forges.Expand(rp.Remotes[idx].URL); err != nil {
+			ec.Wrapf(err, "remote %q for %q", rp.Remotes[idx].Name, rp.Name)
+		} else {
+			rp.Remotes[idx].URL = url
+		}
+	}
+
+	return ec.Resolve()
+}
@@ -0,0 +1,112 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+)
+
+func forgeTestConfig() Forges {
+	return Forges{
+		{Name: "work", Aliases: []string{"w"}, HTTPS: "https://git.example.com/{{account}}/{{name}}.git", Account: "team"},
+		{Name: "gitlab", Protocol: "https", Account: "someone"},
+	}
+}
+
+func TestForgesExpand(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		spec string
+		want string
+		err  string
+	}{
+		{name: "Default", spec: "gh:tychoish/sardis", want: "git@github.com:tychoish/sardis.git"},
+		{name: "DefaultAccount", spec: "github:fun", want: "git@github.com:" + DefaultGitHubAccount + "/fun.git"},
+		{name: "Configured", spec: "work:tools", want: "https://git.example.com/team/tools.git"},
+		{name: "ConfiguredAlias", spec: "w:infra/tools", want: "https://git.example.com/infra/tools.git"},
+		{name: "OverridesDefault", spec: "gl:notes", want: "https://gitlab.com/someone/notes.git"},
+		{name: "SourceHut", spec: "srht:tychoish/notes", want: "git@git.sr.ht:~tychoish/notes"},
+		{name: "URL", spec: "https://example.com/a/b.git", want: "https://example.com/a/b.git"},
+		{name: "SCP", spec: "git@example.com:a/b.git", want: "git@example.com:a/b.git"},
+		{name: "HostAlias", spec: "ssh://mirror/src/notes.git", want: "ssh://mirror/src/notes.git"},
+		{name: "HostWithDomain", spec: "mirror.lan:src/notes.git", want: "mirror.lan:src/notes.git"},
+		{name: "ForgeWithDot", spec: "sr.ht:tychoish/notes", want: "git@git.sr.ht:~tychoish/notes"},
+		{name: "UnknownForge", spec: "gihub:me/repo", err: "unknown forge"},
+		{name: "HostAliasShorthand", spec: "mirror:src/notes.git", err: "unknown forge"},
+		{name: "Path", spec: "~/src/notes", want: "~/src/notes"},
+		{name: "NoAccount", spec: "codeberg:notes", err: "has no default account"},
+		{name: "TooManyParts", spec: "gh:a/b/c", err: "must have the form"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := forgeTestConfig().Expand(tt.spec)
+			switch {
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v (%q)", tt.err, err, got)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case got != tt.want:
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRemote(t *testing.T) {
+	for _, tt := range []struct {
+		spec  string
+		host  string
+		owner string
+		name  string
+	}{
+		{spec: "https://github.com/tychoish/sardis.git", host: "github.com", owner: "tychoish", name: "sardis"},
+		{spec: "ssh://git@git.example.com:2222/team/tools", host: "git.example.com", owner: "team", name: "tools"},
+		{spec: "git@github.com:tychoish/fun.git", host: "github.com", owner: "tychoish", name: "fun"},
+		{spec: "mirror.lan:src/notes.git", host: "mirror.lan", owner: "src", name: "notes"},
+		{spec: "ssh://mirror/src/notes.git", host: "mirror", owner: "src", name: "notes"},
+		{spec: "tychoish/grip", host: "github.com", owner: "tychoish", name: "grip"},
+		{spec: "work:tools", host: "git.example.com", owner: "team", name: "tools"},
+		{spec: "gh:jasper", host: "github.com", owner: DefaultGitHubAccount, name: "jasper"},
+	} {
+		t.Run(tt.spec, func(t *testing.T) {
+			remote, err := forgeTestConfig().ParseRemote(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if remote.Host != tt.host || remote.Owner != tt.owner || remote.Name != tt.name {
+				t.Errorf("got %s/%s/%s, want %s/%s/%s", remote.Host, remote.Owner, remote.Name, tt.host, tt.owner, tt.name)
+			}
+		})
+	}
+
+	for _, spec := range []string{"", "/srv/git/notes.git", "./notes", "gihub:me/repo"} {
+		if _, err := ParseRemote(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestExpandRemotes(t *testing.T) {
+	conf := &Configuration{Forges: forgeTestConfig()}
+	rp := &GitRepository{
+		Name:   "notes",
+		Remote: "gihub:tychoish/notes",
+		Remotes: []GitRemote{
+			{Name: "upstream", URL: "gh:upstream/notes"},
+			{Name: "backup", URL: "bakup:notes"},
+		},
+	}
+
+	err := conf.expandRemotes(rp)
+	if err == nil {
+		t.Fatal("expected errors for unknown forges")
+	}
+	for _, want := range []string{`remote for "notes"`, `remote "backup" for "notes"`, `unknown forge "gihub"`, `unknown forge "bakup"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+	if rp.Remotes[0].URL != "git@github.com:upstream/notes.git" {
+		t.Errorf("known forges should still expand, got %q", rp.Remotes[0].URL)
+	}
+}
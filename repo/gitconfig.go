@@ -0,0 +1,213 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/grip/level"
+	"github.com/tychoish/grip/send"
+	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/util"
+)
+
+const ErrIdentityMismatch ers.Error = "git identity does not match the configuration"
+
+// identityConfigKeys are the git config keys that determine the
+// author and signature of commits. Syncs do not commit unless the
+// effective values of the declared identity keys match.
+var identityConfigKeys = []string{"user.name", "user.email", "user.signingkey"}
+
+// normalizeConfigKey lowercases the section and name of a git config
+// key (section.name or section.subsection.name), which git treats as
+// case insensitive. Subsections are case sensitive.
+func normalizeConfigKey(key string) (string, error) {
+	first, last := strings.Index(key, "."), strings.LastIndex(key, ".")
+	if first <= 0 || last == len(key)-1 {
+		return "", fmt.Errorf("git config key %q must have the form <section>.<name>", key)
+	}
+
+	return strings.ToLower(key[:first]) + key[first:last+1] + strings.ToLower(key[last+1:]), nil
+}
+
+func normalizeGitConfig(config map[string]string) (map[string]string, error) {
+	ec := &erc.Collector{}
+	out := make(map[string]string, len(config))
+	for key, value := range config {
+		norm, err := normalizeConfigKey(key)
+		if err != nil {
+			ec.Push(err)
+			continue
+		}
+		out[norm] = value
+	}
+	return out, ec.Resolve()
+}
+
+// applyTagGitConfig adds the git config defaults of the repository's
+// tags, for keys that the repository does not set. Tags that set the
+// same key to different values conflict, unless the repository sets
+// the key itself.
+func (conf *GitRepository) applyTagGitConfig(defaults map[string]map[string]string) error {
+	ec := &erc.Collector{}
+	own := maps.Clone(conf.GitConfig)
+	from := map[string]string{}
+
+	for _, tag := range conf.Tags {
+		for key, value := range defaults[tag] {
+			if _, ok := own[key]; ok {
+				continue
+			}
+
+			if conf.GitConfig == nil {
+				conf.GitConfig = map[string]string{}
+			}
+
+			if existing, ok := conf.GitConfig[key]; ok {
+				ec.Whenf(existing != value, "git config %q for %q is %q from tag %q and %q from tag %q", key, conf.Name, existing, from[key], value, tag)
+				continue
+			}
+
+			conf.GitConfig[key] = value
+			from[key] = tag
+		}
+	}
+
+	return ec.Resolve()
+}
+
+// gitConfigKeys returns the declared git config keys, in order.
+func (conf *GitRepository) gitConfigKeys() []string {
+	return slices.Sorted(maps.Keys(conf.GitConfig))
+}
+
+// readGitConfig returns the effective value of the key in the
+// checkout (including global configuration and includes), or the
+// empty string if it is not set. Values of the bool type are
+// canonical (true or false), however they are spelled.
+func (conf *GitRepository) readGitConfig(ctx context.Context, key, typ string) (string, error) {
+	value, err := conf.gitConfig(ctx, "--default", "", "--get", key)
+	if err != nil || value == "" || typ == "" {
+		return value, err
+	}
+
+	return conf.gitConfig(ctx, "--type="+typ, "--get", key)
+}
+
+func (conf *GitRepository) writeGitConfig(ctx context.Context, key, value string) error {
+	_, err := conf.gitConfig(ctx, key, value)
+	return err
+}
+
+func (conf *GitRepository) gitConfig(ctx context.Context, args ...string) (string, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := jasper.Context(ctx).
+		CreateCommand(ctx).
+		ID(fmt.Sprintf("gitconfig.REPO(%s)", conf.Name)).
+		Priority(level.Debug).
+		Directory(conf.Path).
+		SetOutputWriter(util.NopWriteCloser(stdout)).
+		SetErrorWriter(util.NopWriteCloser(stderr)).
+		AppendArgs(append([]string{"git", "config"}, args...)...).
+		Run(ctx)
+	if err != nil {
+		return "", fmt.Errorf("git config %s for %q: %w: %s", strings.Join(args, " "), conf.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitConfigType returns the type to read the key with: bool for keys
+// declared with a boolean value, so that other spellings of the same
+// value (e.g. yes, on, or 1 for true) are not differences.
+func gitConfigType(value string) string {
+	switch strings.ToLower(value) {
+	case "true", "false", "yes", "no", "on", "off":
+		return "bool"
+	default:
+		return ""
+	}
+}
+
+// canonicalGitConfig returns the declared value in the form that
+// readGitConfig returns it.
+func canonicalGitConfig(value string) string {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on":
+		return "true"
+	case "false", "no", "off":
+		return "false"
+	default:
+		return value
+	}
+}
+
+// configureGitConfigJob sets every declared git config key in the
+// local configuration of a checkout.
+func (conf *GitRepository) configureGitConfigJob(id string, sender send.Sender) fnx.Worker {
+	return func(ctx context.Context) error {
+		if len(conf.GitConfig) == 0 {
+			return nil
+		}
+
+		cmd := jasper.Context(ctx).
+			CreateCommand(ctx).
+			ID(id).
+			SetOutputSender(level.Info, sender).
+			SetErrorSender(level.Info, sender).
+			Directory(conf.Path)
+
+		for _, key := range conf.gitConfigKeys() {
+			cmd.AppendArgs("git", "config", key, conf.GitConfig[key])
+		}
+
+		return cmd.Run(ctx)
+	}
+}
+
+// checkIdentity returns an error wrapping ErrIdentityMismatch if the
+// effective value of a declared identity key is different.
+func (conf *GitRepository) checkIdentity(ctx context.Context) error {
+	ec := &erc.Collector{}
+	for _, key := range identityConfigKeys {
+		want, ok := conf.GitConfig[key]
+		if !ok {
+			continue
+		}
+
+		got, err := conf.readGitConfig(ctx, key, "")
+		if err != nil {
+			ec.Push(err)
+			continue
+		}
+
+		if got != want {
+			ec.Push(fmt.Errorf("%w: %s for %q is %q, not %q", ErrIdentityMismatch, key, conf.Name, got, want))
+		}
+	}
+	return ec.Resolve()
+}
+
+// remoteIdentityCmd is a shell snippet that performs the same check
+// on the mirror hosts before the sync commits there, or the empty
+// string if the repository declares no identity.
+func (conf *GitRepository) remoteIdentityCmd() string {
+	var checks []string
+	for _, key := range identityConfigKeys {
+		if want, ok := conf.GitConfig[key]; ok {
+			checks = append(checks, fmt.Sprintf("test \"$(git config --get %s)\" = '%s'", key, strings.ReplaceAll(want, "'", `'\''`)))
+		}
+	}
+
+	if len(checks) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("{ %s || { echo '%s' >&2; exit 1; }; }", strings.Join(checks, " && "), ErrIdentityMismatch)
+}
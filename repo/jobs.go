@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"errors"
@@ -12,7 +13,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	git "github.com/go-git/go-git/v5"
 	"github.com/tychoish/fun/erc"
 	"github.com/tychoish/fun/ers"
 	"github.com/tychoish/fun/fn"
@@ -23,13 +23,36 @@ import (
 	"github.com/tychoish/grip/message"
 	"github.com/tychoish/grip/send"
 	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/history"
+	"github.com/tychoish/sardis/srv"
 	"github.com/tychoish/sardis/subexec"
 	"github.com/tychoish/sardis/util"
 )
 
+// pullArgs is the command that integrates the primary remote into
+// the checkout. FetchJob runs it, nativeFetch falls back to it when
+// the branches have diverged, and Explain reports it.
+func (conf *GitRepository) pullArgs() []string {
+	return []string{"git", "pull", "--keep", "--rebase", "--autostash", conf.RemoteName, conf.Branch}
+}
+
+// pullRemotesJob pulls from the primary remote, unless its role
+// excludes fetching, and fetches the additional remotes. The
+// additional remotes are fetched even if the pull fails.
+func (conf *GitRepository) pullRemotesJob(id string, sender send.Sender, results *[]RemoteResult) fnx.Worker {
+	return func(ctx context.Context) error {
+		ec := &erc.Collector{}
+		if conf.primaryRemote().Fetches() {
+			ec.Push(transportJob(id, conf.Path, sender, conf.pullArgs()...).Run(ctx))
+		}
+		ec.Push(conf.fetchRemotesJob(id, sender, results).Run(ctx))
+		return ec.Resolve()
+	}
+}
+
 func (conf *GitRepository) FetchJob() fnx.Worker {
 	const opName = "repo-fetch"
-	return func(ctx context.Context) (err error) {
+	return conf.withLock(opName, func(ctx context.Context) (err error) {
 		// double check this because we might have a stale
 		// version of the config
 		if err := conf.Validate(); err != nil {
@@ -60,20 +83,20 @@ func (conf *GitRepository) FetchJob() fnx.Worker {
 			return errors.New("repo-fetch requires defined remote name and branch for the repo")
 		}
 
+		if conf.Native {
+			return conf.nativeFetch(ctx, id, runID)
+		}
+
 		proclog, procbuf := subexec.NewOutputBuf(id)
 		defer util.DropErrorOnDefer(procbuf.Close)
 		proclog.Info(grip.MPrintln(ruler, id, ruler))
 
-		return jasper.Context(ctx).
-			CreateCommand(ctx).
-			ID(id).
-			SetOutputSender(level.Info, procbuf).
-			SetErrorSender(level.Info, procbuf).
-			Directory(conf.Path).
-			Append(conf.Pre...).
-			AppendArgs("git", "pull", "--keep", "--rebase", "--autostash", conf.RemoteName, conf.Branch).
-			Append(conf.Post...).
-			Worker().
+		preFetchHead := conf.headRef()
+		var remotes []RemoteResult
+
+		return conf.runHooksJob(id, procbuf, conf.Pre).
+			Join(conf.pullRemotesJob(id, procbuf, &remotes)).
+			Join(conf.runHooksJob(id, procbuf, conf.Post)).
 			PreHook(func(context.Context) {
 				grip.Info(message.NewKV().
 					KV("op", opName).
@@ -85,7 +108,10 @@ func (conf *GitRepository) FetchJob() fnx.Worker {
 				)
 			}).
 			WithErrorFilter(func(err error) error {
+				err = conf.deferOnNetworkError(ctx, "fetch", "", err)
+
 				proclog.Info(grip.MPrintln(ruler, id, ruler))
+				history.Add(ctx, history.NewRecord(opName, conf.Name, runID, startAt, err, procbuf.String()))
 				msg := message.NewKV().
 					KV("op", opName).
 					KV("state", "COMPLETED").
@@ -95,17 +121,32 @@ func (conf *GitRepository) FetchJob() fnx.Worker {
 					KV("repo", conf.Name).
 					KV("path", conf.Path)
 
-				if err != nil {
+				if len(remotes) > 0 {
+					msg.KV("remotes", renderRemoteResults(remotes))
+				}
+
+				switch {
+				case errors.Is(err, ErrNetworkUnavailable):
+					grip.Warning(msg.KV("err", err))
+					return err
+				case err != nil:
 					grip.Error(procbuf.String())
 					grip.Critical(msg.KV("err", err))
 					return err
-				} else if conf.Logs.Full() {
+				case conf.Logs.Full():
 					grip.Info(procbuf.String())
 				}
+				conf.recordDigest(ctx, preFetchHead, conf.headRef())
 				grip.Notice(msg)
 				return nil
 			}).PostHook(fn.MakeFuture(procbuf.Close).Ignore()).Run(ctx)
-	}
+	})
+}
+
+// cloneArgs is the command that clones the repository, in the parent
+// directory of the checkout.
+func (conf *GitRepository) cloneArgs() []string {
+	return []string{"git", "clone", conf.Remote, conf.Path}
 }
 
 func (conf *GitRepository) CloneJob() fnx.Worker {
@@ -152,15 +193,20 @@ func (conf *GitRepository) CloneJob() fnx.Worker {
 			"host": hostname,
 		})
 
-		err := jasper.Context(ctx).CreateCommand(ctx).
-			ID(fmt.Sprintf("%s.%s.%s.%s.clone", opName, nonce, hostname, conf.Name)).
-			Priority(level.Debug).
-			Directory(filepath.Dir(conf.Path)).
-			SetOutputSender(level.Info, sender).
-			SetErrorSender(level.Warning, sender).
-			AppendArgs("git", "clone", conf.Remote, conf.Path).
-			Append(conf.Post...).
-			Run(ctx)
+		id := fmt.Sprintf("%s.%s.%s.%s.clone", opName, nonce, hostname, conf.Name)
+
+		var err error
+		if conf.Native {
+			err = conf.nativeClone(ctx, sender)
+		} else {
+			err = transportJob(id, filepath.Dir(conf.Path), sender, conf.cloneArgs()...).
+				Join(conf.cloneHooksJob(id, sender)).
+				Join(conf.configureRemotesJob(id, sender)).
+				Join(conf.configureGitConfigJob(id, sender)).
+				Run(ctx)
+		}
+
+		err = conf.deferOnNetworkError(ctx, "clone", "", err)
 
 		msg := message.NewKV().
 			KV("op", opName).
@@ -170,9 +216,14 @@ func (conf *GitRepository) CloneJob() fnx.Worker {
 			KV("host", hostname).
 			KV("repo", conf.Name).
 			KV("path", conf.Path).
-			KV("remote", conf.Remote)
+			KV("remote", conf.Remote).
+			KV("native", conf.Native)
 
-		if err != nil {
+		switch {
+		case errors.Is(err, ErrNetworkUnavailable):
+			grip.Warning(message.WrapError(err, msg))
+			return err
+		case err != nil:
 			grip.Error(message.WrapError(err, msg))
 			return err
 		}
@@ -186,7 +237,7 @@ func (conf *GitRepository) CloneJob() fnx.Worker {
 func (conf *GitRepository) UpdateJob() fnx.Worker {
 	const opName = "repo-update"
 	count := &atomic.Int64{}
-	return func(ctx context.Context) (err error) {
+	return conf.withLock(opName, func(ctx context.Context) (err error) {
 		wg := &fnx.WaitGroup{}
 		ec := &erc.Collector{}
 
@@ -267,15 +318,65 @@ func (conf *GitRepository) UpdateJob() fnx.Worker {
 		}
 
 		return nil
-	}
+	})
 }
 
 const (
-	remoteUpdateCmdTemplate = "git add -A && git fetch origin && git rebase origin/$(git rev-parse --abbrev-ref HEAD)"
-	syncCmdTemplate         = remoteUpdateCmdTemplate + " && git commit -a -m 'auto-update: (%s)'; git push"
+	rebaseCmd               = "git rebase origin/$(git rev-parse --abbrev-ref HEAD)"
+	removeDeletedCmd        = "git ls-files -d | xargs -r git rm --ignore-unmatch --quiet -- "
+	remoteCommitCmdTemplate = "git commit -m 'auto-update: (%s)'"
 	ruler                   = "---------"
 )
 
+// syncID identifies a sync of the repository with the host, run by
+// the operator host, in the logs and in the commit messages.
+func (conf *GitRepository) syncID(host, operator string) string {
+	if host == operator {
+		return fmt.Sprintf("sync.LOCAL(%s).REPO(%s)", operator, conf.Name)
+	}
+	return fmt.Sprintf("sync.REMOTE(%s).REPO(%s).OPERATOR(%s)", host, conf.Name, operator)
+}
+
+// remoteSyncCmd is the command that SyncRemoteJob runs on a mirror
+// over ssh, before and after syncing the local checkout.
+func (conf *GitRepository) remoteSyncCmd(buildID string) string {
+	push := conf.remotePushCmd()
+	if push == "" {
+		// the commit fails when there is nothing to commit, which
+		// must not fail the sync.
+		push = "true"
+	}
+
+	return strings.Join(slices.DeleteFunc([]string{
+		"cd " + conf.Path,
+		conf.remoteLockCmd(),
+		conf.remoteIdentityCmd(),
+		strings.TrimSpace("git add -A " + conf.Policy.excludePathspecs()),
+		conf.Policy.remoteCheckCmd(),
+		"git fetch origin",
+		remoteRebaseCmd,
+		fmt.Sprintf(remoteCommitCmdTemplate, buildID) + "; " + push,
+	}, func(cmd string) bool { return cmd == "" }), " && ")
+}
+
+// remoteSyncJob runs the sync command on the mirror host over ssh, and
+// records the files that the policy check on the host held back.
+func (conf *GitRepository) remoteSyncJob(id string, sender send.Sender, host, cmd string, result *SyncResult) fnx.Worker {
+	return func(ctx context.Context) error {
+		output := &bytes.Buffer{}
+		err := transportJob(id, conf.Path, send.MakeMulti(sender, send.MakeBytesBuffer(output)), "ssh", host, cmd).Run(ctx)
+		for _, v := range parseHeldBack(output.String()) {
+			v.Host = host
+			result.HeldBack = append(result.HeldBack, v)
+		}
+		return err
+	}
+}
+
+func syncCommitCmd(buildID string) string {
+	return fmt.Sprintf("git commit -m 'update: (%s)' || true", buildID)
+}
+
 // this "remote" in the sense of a git remote, which means it might be
 // the local repository in some cases
 func (conf *GitRepository) SyncRemoteJob(host string) fnx.Worker {
@@ -285,34 +386,55 @@ func (conf *GitRepository) SyncRemoteJob(host string) fnx.Worker {
 	}
 
 	isLocal := host == hn
-	var buildID string
-	if isLocal {
-		buildID = fmt.Sprintf("sync.LOCAL(%s).REPO(%s)", hn, conf.Name)
-	} else {
-		buildID = fmt.Sprintf("sync.REMOTE(%s).REPO(%s).OPERATOR(%s)", host, conf.Name, hn)
+	buildID := conf.syncID(host, hn)
+	var mirrorHost string
+	if !isLocal {
+		mirrorHost = host
 	}
 
 	bullet := fmt.Sprintf("%s.PATH(%s)", buildID, conf.Path)
-	nonce := strings.ToLower(rand.Text())[:7]
 
 	const opName = "repo-sync"
-	return func(ctx context.Context) error {
+	return conf.withLock(opName, func(ctx context.Context) error {
+		// the daemon reuses the worker for every scheduled sync, so
+		// each run needs its own nonce.
+		nonce := strings.ToLower(rand.Text())[:7]
+		started := time.Now()
+
+		// syncs that fail before they run any commands still
+		// belong in the history.
+		abort := func(err error) error {
+			history.Add(ctx, history.NewRecord(opName, conf.Name, nonce, started, err, ""))
+			return err
+		}
+
 		// double check this because we might have a stale
 		// version of the config
 		if err := conf.Validate(); err != nil {
-			return ers.Wrap(err, bullet)
+			return abort(ers.Wrap(err, bullet))
 		}
 
 		if host != hn && !slices.Contains(conf.Mirrors, host) {
-			return fmt.Errorf("%s: remote %q is not a configured", bullet, host)
+			return abort(fmt.Errorf("%s: remote %q is not a configured", bullet, host))
 		}
 
 		if stat, err := os.Stat(conf.Path); os.IsNotExist(err) {
-			return fmt.Errorf("path '%s' for %q does not exist", conf.Path, buildID)
+			return abort(fmt.Errorf("path '%s' for %q does not exist", conf.Path, buildID))
 		} else if !stat.IsDir() {
-			return fmt.Errorf("path '%s' for %q exists but is a %s", conf.Path, buildID, stat.Mode().String())
+			return abort(fmt.Errorf("path '%s' for %q exists but is a %s", conf.Path, buildID, stat.Mode().String()))
 		}
-		started := time.Now()
+
+		if err := conf.checkRebaseState(hn); err != nil {
+			conf.notifyConflict(ctx, opName, buildID, err)
+			return abort(err)
+		}
+
+		// the sync commits on behalf of the user, so it must not
+		// commit with the wrong identity.
+		if err := conf.checkIdentity(ctx); err != nil {
+			return abort(ers.Wrap(err, bullet))
+		}
+		preSyncHead := conf.headRef()
 
 		proclog, procbuf := subexec.NewOutputBuf(buildID)
 		defer util.DropErrorOnDefer(procbuf.Close)
@@ -328,27 +450,74 @@ func (conf *GitRepository) SyncRemoteJob(host string) fnx.Worker {
 			KV("operator", hn),
 		)
 
-		err := jasper.Context(ctx).
-			CreateCommand(ctx).
-			SetOutputSender(level.Info, procbuf).
-			SetErrorSender(level.Error, procbuf).
-			ID(buildID).
-			Directory(conf.Path).
-			AppendArgsWhen(!isLocal, "ssh", host, fmt.Sprintf("cd %s && %s", conf.Path, fmt.Sprintf(syncCmdTemplate, buildID))).
-			Append(conf.Pre...).
-			AppendArgs("git", "add", "-A").
-			Bash("git fetch origin && git rebase origin/$(git rev-parse --abbrev-ref HEAD)").
-			Bash("git ls-files -d | xargs -r git rm --ignore-unmatch --quiet -- ").
-			AppendArgs("git", "add", "-A").
-			Bash(fmt.Sprintf("git commit -a -m 'update: (%s)' || true", buildID)).
-			AppendArgs("git", "push").
-			AppendArgsWhen(!isLocal, "ssh", host, fmt.Sprintf("cd %s && %s", conf.Path, fmt.Sprintf(syncCmdTemplate, buildID))).
-			BashWhen(!isLocal, "git fetch origin && git rebase origin/$(git rev-parse --abbrev-ref HEAD)").
-			Append(conf.Post...).
-			Worker().
+		result := &SyncResult{Repo: conf.Name, Host: host}
+		remoteCmd := conf.remoteSyncCmd(buildID)
+
+		err := conf.remoteSyncJob(buildID, procbuf, host, remoteCmd, result).
+			If(!isLocal).
+			Join(jasper.Context(ctx).
+				CreateCommand(ctx).
+				SetOutputSender(level.Info, procbuf).
+				SetErrorSender(level.Error, procbuf).
+				ID(buildID).
+				Directory(conf.Path).
+				Append(conf.Pre...).
+				AppendArgs("git", "add", "-A").
+				Worker()).
+			Join(transportJob(buildID, conf.Path, procbuf, "git", "fetch", "origin")).
+			Join(jasper.Context(ctx).
+				CreateCommand(ctx).
+				SetOutputSender(level.Info, procbuf).
+				SetErrorSender(level.Error, procbuf).
+				ID(buildID).
+				Directory(conf.Path).
+				Bash(rebaseCmd).
+				Bash(removeDeletedCmd).
+				AppendArgs("git", "add", "-A").
+				Worker()).
+			Join(conf.enforcePolicyJob(buildID, procbuf, result)).
+			Join(jasper.Context(ctx).
+				CreateCommand(ctx).
+				SetOutputSender(level.Info, procbuf).
+				SetErrorSender(level.Error, procbuf).
+				ID(buildID).
+				Directory(conf.Path).
+				Bash(syncCommitCmd(buildID)).
+				Worker()).
+			Join(conf.pushRemotesJob(buildID, procbuf, &result.Remotes)).
+			Join(conf.remoteSyncJob(buildID, procbuf, host, remoteCmd, result).If(!isLocal)).
+			Join(transportJob(buildID, conf.Path, procbuf, "git", "fetch", "origin").If(!isLocal)).
+			Join(jasper.Context(ctx).
+				CreateCommand(ctx).
+				SetOutputSender(level.Info, procbuf).
+				SetErrorSender(level.Error, procbuf).
+				ID(buildID).
+				Directory(conf.Path).
+				BashWhen(!isLocal, rebaseCmd).
+				Append(conf.Post...).
+				Worker().
+				If(!isLocal || len(conf.Post) > 0)).
 			WithErrorFilter(func(err error) error {
-				proclog.Notice(grip.MPrintln(ruler, bullet, ruler))
 				if err != nil {
+					err = conf.checkConflicts(ctx, buildID, hn, procbuf, err)
+					err = conf.remoteLockError(mirrorHost, err)
+					err = conf.remoteConflictError(mirrorHost, err)
+					err = conf.deferOnNetworkError(ctx, "sync", mirrorHost, err)
+				}
+				history.Add(ctx, history.NewRecord(opName, conf.Name, nonce, started, err, procbuf.String()))
+
+				proclog.Notice(grip.MPrintln(ruler, bullet, ruler))
+				if errors.Is(err, ErrNetworkUnavailable) {
+					grip.Warning(message.NewKV().
+						KV("op", opName).
+						KV("state", "DEFERRED").
+						KV("run", nonce).
+						KV("repo", conf.Name).
+						KV("host", host).
+						KV("id", buildID).
+						KV("err", err),
+					)
+				} else if err != nil {
 					grip.Critical(message.NewKV().
 						KV("op", opName).
 						KV("state", "ERRORED").
@@ -370,26 +539,51 @@ func (conf *GitRepository) SyncRemoteJob(host string) fnx.Worker {
 			}).
 			Run(ctx)
 
-		grip.Info(message.NewKV().
+		grip.Info(result.Message().
 			KV("op", opName).
 			KV("state", "COMPLETED").
 			KV("run", nonce).
-			KV("repo", conf.Name).
 			KV("path", conf.Path).
 			KV("remote", conf.Remote).
-			KV("host", host).
 			KV("operator", hn).
 			KV("id", buildID).
+			KV("head", preSyncHead).
 			KV("err", err != nil),
 		)
 
-		return nil
-	}
+		// local syncs pull like fetches do; the digest also includes
+		// the commit that the sync made with the local changes, if
+		// any. Mirror syncs are reported by the mirror.
+		if err == nil && isLocal {
+			conf.recordDigest(ctx, preSyncHead, conf.headRef())
+		}
+
+		if len(result.HeldBack) > 0 {
+			srv.RemoteNotify(ctx).Warning(result.Message().
+				KV("op", opName).
+				KV("id", buildID).
+				KV("msg", "files held back from sync by content policy"))
+		}
+
+		var conflict *ConflictError
+		if errors.As(err, &conflict) {
+			conf.notifyConflict(ctx, opName, buildID, conflict)
+		}
+
+		return err
+	})
 }
 
 func (conf *GitRepository) CleanupJob() fnx.Worker {
+	return conf.CleanupReportJob(nil, &CleanupResult{})
+}
+
+// CleanupReportJob runs the cleanup modes, or the configured modes if
+// none are specified, and records the disk usage of the git directory
+// before and after in the result.
+func (conf *GitRepository) CleanupReportJob(modes []CleanupMode, result *CleanupResult) fnx.Worker {
 	const opName = "repo-cleanup"
-	return func(ctx context.Context) (err error) {
+	return conf.withLock(opName, func(ctx context.Context) (err error) {
 		if _, err := os.Stat(conf.Path); os.IsNotExist(err) {
 			return fmt.Errorf("cannot cleanup %s, no repository exists", conf.Path)
 		}
@@ -398,29 +592,59 @@ func (conf *GitRepository) CleanupJob() fnx.Worker {
 		start := time.Now()
 		nonce := strings.ToLower(rand.Text())[:7]
 
+		result.Repo = conf.Name
+		result.Path = conf.Path
+		result.Modes = conf.cleanupModes(modes)
+
 		defer func() {
+			result.Duration = time.Since(start)
+			if err != nil {
+				result.Error = err.Error()
+			}
+
 			grip.Critical(message.NewKV().
 				KV("op", opName).
 				KV("id", id).
 				KV("run", nonce).
 				KV("repo", conf.Name).
 				KV("path", conf.Path).
-				KV("dur", time.Since(start)).
+				KV("modes", result.Modes).
+				KV("reclaimed", result.Reclaimed()).
+				KV("dur", result.Duration).
 				KV("err", err != nil),
 			)
 		}()
 
+		if result.Before, err = conf.DiskUsage(); err != nil {
+			return err
+		}
+
 		proclog, procbuf := subexec.NewOutputBuf(id)
 		defer util.DropErrorOnDefer(procbuf.Close)
 		proclog.Info(grip.MPrintln(ruler, id, ruler))
 
-		return jasper.Context(ctx).CreateCommand(ctx).Priority(level.Info).
+		cmd := jasper.Context(ctx).CreateCommand(ctx).Priority(level.Info).
 			Directory(conf.Path).
 			SetOutputSender(level.Info, procbuf).
-			SetErrorSender(level.Error, procbuf).
-			AppendArgs("git", "gc").
-			AppendArgs("git", "prune").
-			Worker().
+			SetErrorSender(level.Error, procbuf)
+
+		hasCommands := false
+		for _, mode := range result.Modes {
+			for _, args := range conf.cleanupArgs(mode) {
+				cmd.AppendArgs(args...)
+				hasCommands = true
+			}
+		}
+
+		ec := &erc.Collector{}
+		ec.Push(fnx.Worker(func(ctx context.Context) (err error) {
+			result.Deleted, err = conf.deleteMergedBranches(ctx)
+			for _, branch := range result.Deleted {
+				proclog.Info(message.MakeFormat("deleted merged branch %q", branch))
+			}
+			return err
+		}).If(slices.Contains(result.Modes, CleanupModeBranches)).
+			Join(cmd.Worker().If(hasCommands)).
 			WithErrorFilter(func(err error) error {
 				proclog.Info(grip.MPrintln(ruler, id, ruler))
 				if err != nil {
@@ -438,75 +662,43 @@ func (conf *GitRepository) CleanupJob() fnx.Worker {
 				}
 
 				return err
-			}).PostHook(fn.MakeFuture(procbuf.Close).Ignore()).Run(ctx)
-	}
-}
+			}).PostHook(fn.MakeFuture(procbuf.Close).Ignore()).Run(ctx))
 
-func (conf *GitRepository) StatusJob() fnx.Worker {
-	return func(ctx context.Context) error {
-		if _, err := os.Stat(conf.Path); os.IsNotExist(err) {
-			return fmt.Errorf("cannot check status %s, no repository exists", conf.Path)
-		}
-
-		cmd := jasper.Context(ctx)
-
-		startAt := time.Now()
-
-		logger := grip.Context(ctx)
-		sender := logger.Sender()
-
-		ec := &erc.Collector{}
-		ec.Push(cmd.CreateCommand(ctx).Priority(level.Debug).
-			Directory(conf.Path).
-			SetOutputSender(level.Debug, sender).
-			SetErrorSender(level.Debug, sender).
-			Add(conf.getStatusCommandArgs()).
-			AppendArgs("git", "status", "--short", "--branch").
-			Run(ctx))
-
-		ec.Push(conf.doOtherStat(logger))
-
-		logger.Debug(message.Fields{
-			"op":   "git status",
-			"path": conf.Path,
-			"dur":  time.Since(startAt).Seconds(),
-			"ok":   ec.Ok(),
-		})
+		var usageErr error
+		result.After, usageErr = conf.DiskUsage()
+		ec.Push(usageErr)
 
 		return ec.Resolve()
-	}
+	})
 }
 
-func (conf *GitRepository) getStatusCommandArgs() []string {
-	return []string{
-		"git", "log", "--date=relative", "--decorate", "-n", "1",
-		fmt.Sprint("--format=", filepath.Base(conf.Path)), `:%N (%cr) "%s"`,
-	}
-}
+func (conf *GitRepository) StatusJob() fnx.Worker {
+	const opName = "repo-status"
+	return func(ctx context.Context) error {
+		startAt := time.Now()
 
-func (conf *GitRepository) doOtherStat(logger grip.Logger) error {
-	repo, err := git.PlainOpen(conf.Path)
-	if err != nil {
-		return err
-	}
+		stat, err := conf.Status()
 
-	wt, err := repo.Worktree()
-	if err != nil {
-		return err
-	}
+		msg := message.NewKV().
+			KV("op", opName).
+			KV("repo", conf.Name).
+			KV("path", conf.Path).
+			KV("missing", stat.Missing).
+			KV("branch", stat.Branch).
+			KV("tracking", stat.Tracking).
+			KV("ahead", stat.Ahead).
+			KV("behind", stat.Behind).
+			KV("dirty", stat.Dirty).
+			KV("untracked", stat.Untracked).
+			KV("stashes", stat.Stashes).
+			KV("dur", time.Since(startAt))
 
-	stat, err := wt.Status()
-	if err != nil {
-		return err
-	}
+		if err != nil {
+			grip.Context(ctx).Error(message.WrapError(err, msg))
+			return err
+		}
 
-	for fn, status := range stat {
-		logger.Notice(message.Fields{
-			"file":     fn,
-			"stat":     "golib",
-			"staging":  status.Staging,
-			"worktree": status.Worktree,
-		})
+		grip.Context(ctx).Info(msg)
+		return nil
 	}
-	return nil
 }
@@ -0,0 +1,279 @@
+package repo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/sardis/util"
+)
+
+const ErrLocked ers.Error = "repository is locked"
+
+const (
+	// DefaultLockTimeout is how long jobs wait for another job to
+	// release a repository when the configuration doesn't specify.
+	DefaultLockTimeout = time.Minute
+
+	lockFileName     = "sardis.lock"
+	lockPollInterval = 250 * time.Millisecond
+)
+
+// LockSettings control how jobs wait for other jobs (from this
+// process, another process, or another host's sync) that hold the
+// lock on a repository.
+type LockSettings struct {
+	Timeout string `bson:"timeout" json:"timeout" yaml:"timeout"`
+	Skip    bool   `bson:"skip" json:"skip" yaml:"skip"`
+}
+
+func (ls *LockSettings) Validate() error {
+	_, err := time.ParseDuration(util.Default(ls.Timeout, DefaultLockTimeout.String()))
+	return err
+}
+
+func (ls *LockSettings) timeout() time.Duration {
+	dur, err := time.ParseDuration(ls.Timeout)
+	if err != nil || ls.Timeout == "" {
+		return DefaultLockTimeout
+	}
+	return dur
+}
+
+// LockHolder describes the job that holds a repository lock. Locks
+// taken by the sync commands that other hosts run over ssh do not
+// record a holder.
+type LockHolder struct {
+	PID       int       `bson:"pid" json:"pid" yaml:"pid"`
+	Op        string    `bson:"op" json:"op" yaml:"op"`
+	Run       string    `bson:"run" json:"run" yaml:"run"`
+	Host      string    `bson:"host" json:"host" yaml:"host"`
+	StartedAt time.Time `bson:"started_at" json:"started_at" yaml:"started_at"`
+}
+
+func (h *LockHolder) String() string {
+	return fmt.Sprintf("pid %d (%s, run %s) on %s for %s", h.PID, h.Op, h.Run, h.Host, time.Since(h.StartedAt).Round(time.Second))
+}
+
+// LockError reports a job that could not acquire the lock on a
+// repository before the timeout.
+type LockError struct {
+	Repo   string
+	Op     string
+	Holder *LockHolder
+	Waited time.Duration
+}
+
+func (e *LockError) Unwrap() error { return ErrLocked }
+
+func (e *LockError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%s: %q is locked by another process (waited %s)", e.Op, e.Repo, e.Waited)
+	}
+	return fmt.Sprintf("%s: %q is locked by %s (waited %s)", e.Op, e.Repo, e.Holder, e.Waited)
+}
+
+// gitDir returns the git directory of the checkout, following the
+// .git file of linked worktrees, or the empty string if the checkout
+// does not exist.
+func (conf *GitRepository) gitDir() string {
+	dotgit := filepath.Join(conf.Path, ".git")
+	stat, err := os.Stat(dotgit)
+	switch {
+	case err != nil:
+		return ""
+	case stat.IsDir():
+		return dotgit
+	}
+
+	payload, err := os.ReadFile(dotgit)
+	if err != nil {
+		return ""
+	}
+
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(payload)), "gitdir: ")
+	if !ok {
+		return ""
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(conf.Path, dir)
+	}
+	return dir
+}
+
+// lock takes an exclusive flock on a file in the git directory,
+// waiting up to the configured timeout for other holders to release
+// it. Checkouts that do not exist (yet) are not locked.
+func (conf *GitRepository) lock(ctx context.Context, op string) (release func(), err error) {
+	dir := conf.gitDir()
+	if dir == "" {
+		return func() {}, nil
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	startAt := time.Now()
+	timeout := conf.Lock.timeout()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			util.DropErrorOnDefer(file.Close)
+			return nil, err
+		}
+
+		if time.Since(startAt) >= timeout {
+			holder := readLockHolder(file)
+			util.DropErrorOnDefer(file.Close)
+			return nil, &LockError{Repo: conf.Name, Op: op, Holder: holder, Waited: time.Since(startAt).Round(time.Millisecond)}
+		}
+
+		timer.Reset(lockPollInterval)
+		select {
+		case <-ctx.Done():
+			util.DropErrorOnDefer(file.Close)
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	holder := &LockHolder{
+		PID:       os.Getpid(),
+		Op:        op,
+		Run:       strings.ToLower(rand.Text())[:7],
+		Host:      util.GetHostname(),
+		StartedAt: time.Now(),
+	}
+	if payload, err := json.Marshal(holder); err == nil {
+		_ = file.Truncate(0)
+		_, _ = file.WriteAt(payload, 0)
+	}
+
+	return func() {
+		_ = file.Truncate(0)
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		util.DropErrorOnDefer(file.Close)
+	}, nil
+}
+
+func readLockHolder(file *os.File) *LockHolder {
+	stat, err := file.Stat()
+	if err != nil || stat.Size() == 0 {
+		return nil
+	}
+
+	payload := make([]byte, stat.Size())
+	if _, err := file.ReadAt(payload, 0); err != nil {
+		return nil
+	}
+
+	holder := &LockHolder{}
+	if err := json.Unmarshal(payload, holder); err != nil {
+		return nil
+	}
+	return holder
+}
+
+type lockCtxKey struct{}
+
+func heldLocks(ctx context.Context) map[string]bool {
+	held, _ := ctx.Value(lockCtxKey{}).(map[string]bool)
+	return held
+}
+
+func withHeldLock(ctx context.Context, path string) context.Context {
+	held := map[string]bool{path: true}
+	for p := range heldLocks(ctx) {
+		held[p] = true
+	}
+	return context.WithValue(ctx, lockCtxKey{}, held)
+}
+
+// withLock runs the worker while holding the repository lock. Jobs
+// that run other jobs for the same repository (e.g. updates, which
+// sync and fetch) hold the lock once, for the duration of the outer
+// job. When the lock is held elsewhere, the job fails with a
+// *LockError, or, if the repository is configured to skip, logs the
+// holder and returns without running.
+func (conf *GitRepository) withLock(op string, wf fnx.Worker) fnx.Worker {
+	return func(ctx context.Context) error {
+		if heldLocks(ctx)[conf.Path] {
+			return wf(ctx)
+		}
+
+		release, err := conf.lock(ctx, op)
+
+		var lockErr *LockError
+		switch {
+		case errors.As(err, &lockErr) && conf.Lock.Skip:
+			grip.Notice(message.NewKV().
+				KV("op", op).
+				KV("state", "SKIPPED").
+				KV("repo", conf.Name).
+				KV("path", conf.Path).
+				KV("msg", lockErr.Error()))
+			return nil
+		case err != nil:
+			return err
+		}
+		defer release()
+
+		return wf(withHeldLock(ctx, conf.Path))
+	}
+}
+
+// remoteLockCmd is a shell snippet that takes the same lock for the
+// sync commands that run on mirror hosts over ssh, using flock(1). The
+// lock file is in the directory that `git rev-parse --git-dir`
+// reports, which (as for local locks) is the worktree's own git
+// directory in linked worktrees. Hosts without flock(1) sync without
+// the lock, and say so in the output.
+//
+// Each side of a sync holds its own lock while it waits for the
+// other's, so two hosts that sync to each other at the same time
+// block each other until one of them times out: see remoteLockError.
+func (conf *GitRepository) remoteLockCmd() string {
+	return fmt.Sprintf(
+		"{ if command -v flock >/dev/null; then exec 9>>\"$(git rev-parse --git-dir)/%s\" && flock -w %d 9 || { echo '%s' >&2; exit 1; }; "+
+			"else echo 'flock(1) is not installed, syncing without the repository lock' >&2; fi; }",
+		lockFileName, int(conf.Lock.timeout().Seconds()), ErrLocked)
+}
+
+// remoteLockError identifies syncs that failed because the lock on the
+// mirror host timed out, and logs that this is also what happens when
+// the mirror host syncs to this host at the same time.
+func (conf *GitRepository) remoteLockError(host string, err error) error {
+	var terr *transportError
+	if host == "" || !errors.As(err, &terr) || !strings.Contains(terr.stderr, ErrLocked.Error()) {
+		return err
+	}
+
+	grip.Warning(message.NewKV().
+		KV("op", "repo-sync").
+		KV("state", "LOCKED").
+		KV("repo", conf.Name).
+		KV("host", host).
+		KV("msg", "timed out waiting for the lock on the mirror host; hosts that sync to each other at the same time each hold their own lock while waiting for the other's"))
+
+	return fmt.Errorf("%w on %s: %w", ErrLocked, host, err)
+}
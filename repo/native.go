@@ -0,0 +1,281 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/level"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/grip/send"
+	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/history"
+	"github.com/tychoish/sardis/subexec"
+	"github.com/tychoish/sardis/util"
+)
+
+const (
+	ErrDetachedHead     ers.Error = "repository has a detached HEAD"
+	ErrMissingRemoteRef ers.Error = "remote branch does not exist"
+)
+
+type PullAction string
+
+const (
+	PullActionUpToDate    PullAction = "up-to-date"
+	PullActionAhead       PullAction = "ahead"
+	PullActionFastForward PullAction = "fast-forward"
+	PullActionRebase      PullAction = "rebase"
+)
+
+// PullResult describes the outcome of a native fetch: the refs before
+// and after the operation, and the number of commits pulled from the
+// remote.
+type PullResult struct {
+	Repo    string     `bson:"repo" json:"repo" yaml:"repo"`
+	Remote  string     `bson:"remote" json:"remote" yaml:"remote"`
+	Branch  string     `bson:"branch" json:"branch" yaml:"branch"`
+	Backend string     `bson:"backend" json:"backend" yaml:"backend"`
+	Action  PullAction `bson:"action" json:"action" yaml:"action"`
+	OldRef  string     `bson:"old_ref" json:"old_ref" yaml:"old_ref"`
+	NewRef  string     `bson:"new_ref" json:"new_ref" yaml:"new_ref"`
+	Commits int        `bson:"commits" json:"commits" yaml:"commits"`
+
+	Remotes []RemoteResult `bson:"remotes,omitempty" json:"remotes,omitempty" yaml:"remotes,omitempty"`
+}
+
+func (pr *PullResult) Message() *message.KV {
+	msg := message.NewKV().
+		KV("repo", pr.Repo).
+		KV("remote", pr.Remote).
+		KV("branch", pr.Branch).
+		KV("backend", pr.Backend).
+		KV("action", pr.Action).
+		KV("old", pr.OldRef).
+		KV("new", pr.NewRef).
+		KV("commits", pr.Commits)
+	if len(pr.Remotes) > 0 {
+		msg.KV("remotes", renderRemoteResults(pr.Remotes))
+	}
+	return msg
+}
+
+// nativeFetch fetches and integrates the remote branch using go-git
+// rather than the git CLI. go-git can fetch and fast-forward a clean
+// checkout, but it cannot rebase or stash, so diverged histories and
+// checkouts with local changes fall back to `git pull --rebase
+// --autostash` after the fetch.
+func (conf *GitRepository) nativeFetch(ctx context.Context, id, runID string) (err error) {
+	const opName = "repo-fetch"
+
+	startAt := time.Now()
+	hostname := util.GetHostname()
+	result := &PullResult{Repo: conf.Name, Remote: conf.RemoteName, Branch: conf.Branch, Backend: "native"}
+
+	proclog, procbuf := subexec.NewOutputBuf(id)
+	defer util.DropErrorOnDefer(procbuf.Close)
+	proclog.Info(grip.MPrintln(ruler, id, ruler))
+
+	grip.Info(message.NewKV().
+		KV("op", opName).
+		KV("state", "STARTED").
+		KV("backend", result.Backend).
+		KV("run", runID).
+		KV("repo", conf.Name).
+		KV("path", conf.Path).
+		KV("host", hostname),
+	)
+
+	defer func() {
+		err = conf.deferOnNetworkError(ctx, "fetch", "", err)
+
+		proclog.Info(grip.MPrintln(ruler, id, ruler))
+		history.Add(ctx, history.NewRecord(opName, conf.Name, runID, startAt, err, procbuf.String()))
+		msg := result.Message().
+			KV("op", opName).
+			KV("state", "COMPLETED").
+			KV("run", runID).
+			KV("err", err != nil).
+			KV("dur", time.Since(startAt)).
+			KV("path", conf.Path)
+
+		switch {
+		case errors.Is(err, ErrNetworkUnavailable):
+			grip.Warning(msg.KV("err", err))
+			return
+		case err != nil:
+			grip.Error(procbuf.String())
+			grip.Critical(msg.KV("err", err))
+			return
+		case conf.Logs.Full():
+			grip.Info(procbuf.String())
+		}
+		conf.recordDigest(ctx, result.OldRef, result.NewRef)
+		grip.Notice(msg)
+	}()
+
+	if err = conf.runHooks(ctx, id, procbuf, conf.Pre); err != nil {
+		return err
+	}
+
+	// the additional remotes are fetched even if the pull from the
+	// primary remote fails.
+	ec := &erc.Collector{}
+	if conf.primaryRemote().Fetches() {
+		ec.Push(conf.nativePull(ctx, id, procbuf, result))
+	}
+	ec.Push(conf.fetchRemotesJob(id, procbuf, &result.Remotes).Run(ctx))
+	if err = ec.Resolve(); err != nil {
+		return err
+	}
+
+	return conf.runHooks(ctx, id, procbuf, conf.Post)
+}
+
+// nativePull fetches the primary remote with go-git, and integrates
+// the remote branch into the checkout.
+func (conf *GitRepository) nativePull(ctx context.Context, id string, procbuf *subexec.OutputBuf, result *PullResult) error {
+	repo, err := git.PlainOpen(conf.Path)
+	if err != nil {
+		return ers.Wrapf(err, "opening %q", conf.Path)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return ers.Wrapf(err, "resolving HEAD for %q", conf.Name)
+	}
+	if !head.Name().IsBranch() {
+		return ers.Wrapf(ErrDetachedHead, "%s at %q", conf.Name, conf.Path)
+	}
+	result.OldRef = head.Hash().String()
+	result.NewRef = result.OldRef
+
+	err = repo.FetchContext(ctx, &git.FetchOptions{RemoteName: conf.RemoteName, Progress: procbuf.Writer()})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return ers.Wrapf(asTransportError(err, ""), "fetching %q from %q", conf.Name, conf.RemoteName)
+	}
+
+	remote, err := repo.Reference(plumbing.NewRemoteReferenceName(conf.RemoteName, conf.Branch), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return ers.Wrapf(ErrMissingRemoteRef, "%s/%s for %q", conf.RemoteName, conf.Branch, conf.Name)
+	} else if err != nil {
+		return err
+	}
+
+	if remote.Hash() == head.Hash() {
+		result.Action = PullActionUpToDate
+		return nil
+	}
+
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	remoteCommit, err := repo.CommitObject(remote.Hash())
+	if err != nil {
+		return err
+	}
+
+	ahead, behind, err := countDivergence(headCommit, remoteCommit)
+	if err != nil {
+		return ers.Wrapf(err, "comparing %s with %s", head.Name().Short(), remote.Name().Short())
+	}
+	result.Commits = behind
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	stat, err := wt.Status()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case behind == 0:
+		result.Action = PullActionAhead
+	case ahead == 0 && stat.IsClean():
+		result.Action = PullActionFastForward
+		if err = wt.Reset(&git.ResetOptions{Commit: remote.Hash(), Mode: git.MergeReset}); err != nil {
+			return ers.Wrapf(err, "fast-forwarding %q to %s", conf.Name, remote.Hash())
+		}
+	default:
+		result.Backend = "shell"
+		if ahead == 0 {
+			result.Action = PullActionFastForward
+		} else {
+			result.Action = PullActionRebase
+		}
+
+		err = transportJob(id, conf.Path, procbuf, conf.pullArgs()...).Run(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if head, err = repo.Head(); err != nil {
+		return err
+	}
+	result.NewRef = head.Hash().String()
+
+	return nil
+}
+
+func (conf *GitRepository) nativeClone(ctx context.Context, sender send.Sender) error {
+	progress := send.MakeWriterSender(sender)
+	defer util.DropErrorOnDefer(progress.Close)
+
+	_, err := git.PlainCloneContext(ctx, conf.Path, false, &git.CloneOptions{
+		URL:           conf.Remote,
+		RemoteName:    conf.RemoteName,
+		ReferenceName: plumbing.NewBranchReferenceName(conf.Branch),
+		Progress:      progress,
+	})
+	if err != nil {
+		return ers.Wrapf(asTransportError(err, ""), "cloning %q into %q", conf.Remote, conf.Path)
+	}
+
+	return conf.cloneHooksJob(conf.Name, sender).
+		Join(conf.configureRemotesJob(conf.Name, sender)).
+		Join(conf.configureGitConfigJob(conf.Name, sender)).
+		Run(ctx)
+}
+
+// cloneHooksJob runs the post hooks after a clone, in the parent
+// directory of the new checkout.
+func (conf *GitRepository) cloneHooksJob(id string, sender send.Sender) fnx.Worker {
+	return func(ctx context.Context) error {
+		return conf.runHooksIn(ctx, id, sender, filepath.Dir(conf.Path), conf.Post)
+	}
+}
+
+func (conf *GitRepository) runHooksJob(id string, sender send.Sender, hooks []string) fnx.Worker {
+	return func(ctx context.Context) error { return conf.runHooks(ctx, id, sender, hooks) }
+}
+
+func (conf *GitRepository) runHooks(ctx context.Context, id string, sender send.Sender, hooks []string) error {
+	return conf.runHooksIn(ctx, id, sender, conf.Path, hooks)
+}
+
+func (conf *GitRepository) runHooksIn(ctx context.Context, id string, sender send.Sender, dir string, hooks []string) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	return jasper.Context(ctx).
+		CreateCommand(ctx).
+		ID(id).
+		SetOutputSender(level.Info, sender).
+		SetErrorSender(level.Info, sender).
+		Directory(dir).
+		Append(hooks...).
+		Run(ctx)
+}
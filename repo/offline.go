@@ -0,0 +1,325 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/level"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/grip/send"
+	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/retry"
+	"github.com/tychoish/sardis/util"
+)
+
+const ErrNetworkUnavailable ers.Error = "network unavailable"
+
+// probeTimeout bounds each connectivity probe.
+const probeTimeout = 5 * time.Second
+
+// networkErrorPatterns are fragments of the messages that git, ssh,
+// and curl produce when the network (rather than the remote) is the
+// problem.
+var networkErrorPatterns = []string{
+	"could not resolve host",
+	"could not resolve hostname",
+	"temporary failure in name resolution",
+	"name or service not known",
+	"network is unreachable",
+	"no route to host",
+	"connection timed out",
+	"operation timed out",
+	"connection refused",
+	"connection reset by peer",
+	"failed to connect to",
+}
+
+// transportError is the error of a command that talks to a remote
+// (git clone, fetch, pull, and push, and ssh to mirror hosts), with
+// the standard error of the command. Only transport errors are
+// classified as network errors: the output of hooks and of local git
+// commands (e.g. rebases) never is.
+type transportError struct {
+	err    error
+	stderr string
+}
+
+func (e *transportError) Error() string { return e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+func asTransportError(err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	return &transportError{err: err, stderr: stderr}
+}
+
+// transportJob runs a command that talks to a remote, sending its
+// output to the sender. Failures are transport errors, which carry
+// the standard error of the command alone.
+func transportJob(id, dir string, sender send.Sender, args ...string) fnx.Worker {
+	return func(ctx context.Context) error {
+		stderr := &bytes.Buffer{}
+		err := jasper.Context(ctx).
+			CreateCommand(ctx).
+			ID(id).
+			SetOutputSender(level.Info, sender).
+			SetErrorSender(level.Info, send.MakeMulti(sender, send.MakeBytesBuffer(stderr))).
+			Directory(dir).
+			AppendArgs(args...).
+			Run(ctx)
+		return asTransportError(err, stderr.String())
+	}
+}
+
+// isNetworkError reports if the error is a transport error caused by
+// the network. Cancellations and timeouts of the context are never
+// network errors, even though net.Error matches deadlines.
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var terr *transportError
+	if !errors.As(err, &terr) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(terr.err, &netErr) {
+		return true
+	}
+
+	text := strings.ToLower(terr.err.Error() + "\n" + terr.stderr)
+	return slices.ContainsFunc(networkErrorPatterns, func(pattern string) bool { return strings.Contains(text, pattern) })
+}
+
+// probeAddress returns the address to probe to check that the host is
+// reachable: the ssh port for mirror hosts, and the port for the
+// transport of the remote otherwise. Remotes on the local filesystem
+// have no address.
+func (conf *GitRepository) probeAddress(ctx context.Context, host string) string {
+	if host != "" {
+		return sshProbeAddress(ctx, host)
+	}
+
+	remote, err := ParseRemote(conf.Remote)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case strings.HasPrefix(remote.URL, "https://"):
+		return net.JoinHostPort(remote.Host, "443")
+	case strings.HasPrefix(remote.URL, "http://"):
+		return net.JoinHostPort(remote.Host, "80")
+	default:
+		return sshProbeAddress(ctx, remote.Host)
+	}
+}
+
+// sshProbeAddress resolves the address that ssh connects to for the
+// host with `ssh -G`, so that host aliases and ports from the ssh
+// configuration apply. When ssh cannot resolve the host, there is no
+// address, and the host's reachability is unknown.
+func sshProbeAddress(ctx context.Context, host string) string {
+	stdout := &bytes.Buffer{}
+	err := jasper.Context(ctx).
+		CreateCommand(ctx).
+		ID(fmt.Sprintf("probe.HOST(%s)", host)).
+		Priority(level.Debug).
+		SetOutputWriter(util.NopWriteCloser(stdout)).
+		AppendArgs("ssh", "-G", host).
+		Run(ctx)
+	if err != nil {
+		return ""
+	}
+
+	return parseSSHProbeAddress(host, stdout.String())
+}
+
+// parseSSHProbeAddress returns the address from the output of `ssh
+// -G`. Hosts that ssh reaches through a proxy cannot be probed
+// directly, and have no address.
+func parseSSHProbeAddress(host, config string) string {
+	hostname, port := host, "22"
+	for line := range strings.Lines(config) {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToLower(key) {
+		case "hostname":
+			hostname = value
+		case "port":
+			port = value
+		case "proxycommand", "proxyjump":
+			if value != "none" {
+				return ""
+			}
+		}
+	}
+
+	return net.JoinHostPort(hostname, port)
+}
+
+// Reachable reports if the remote of the repository (or the mirror
+// host, when specified) accepts connections. Remotes that cannot be
+// probed are assumed to be reachable.
+func (conf *GitRepository) Reachable(ctx context.Context, host string) bool {
+	addr := conf.probeAddress(ctx, host)
+	if addr == "" {
+		return true
+	}
+
+	dialer := &net.Dialer{Timeout: probeTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// deferOnNetworkError classifies the error from a network operation.
+// Transport errors that look like network failures, when a probe
+// confirms that the remote does not accept connections, wrap
+// ErrNetworkUnavailable, and the operation is added to the retry
+// queue in the context.
+func (conf *GitRepository) deferOnNetworkError(ctx context.Context, op, host string, err error) error {
+	if err == nil || ctx.Err() != nil || errors.Is(err, ErrNetworkUnavailable) {
+		return err
+	}
+
+	if !isNetworkError(err) || conf.Reachable(ctx, host) {
+		return err
+	}
+
+	if retry.Defer(ctx, retry.NewItem(op, conf.Name, host, err)) {
+		grip.Warning(message.NewKV().
+			KV("op", "repo-"+op).
+			KV("state", "DEFERRED").
+			KV("repo", conf.Name).
+			KV("host", host).
+			KV("err", err))
+	}
+
+	return fmt.Errorf("%w: %w", ErrNetworkUnavailable, err)
+}
+
+// RetryWorker returns the worker that retries a deferred operation,
+// or nil if the operation is not recognized.
+func (conf *GitRepository) RetryWorker(item retry.Item) fnx.Worker {
+	switch item.Op {
+	case "fetch":
+		return conf.FetchJob()
+	case "clone":
+		return conf.CloneJob()
+	case "sync":
+		return conf.SyncRemoteJob(util.Default(item.Host, "LOCAL"))
+	default:
+		return nil
+	}
+}
+
+// RetryJob retries the due items in the retry queue in the context,
+// if there is one. Items whose remote is still unreachable are rescheduled without
+// running, items that fail because of the network again are
+// rescheduled with a longer backoff, and items that fail for any
+// other reason are marked as failed.
+func RetryJob(repos []GitRepository) fnx.Worker {
+	const opName = "repo-retry"
+
+	return func(ctx context.Context) error {
+		q := retry.Context(ctx)
+		if q == nil {
+			return nil
+		}
+
+		items, err := q.Read()
+		if err != nil {
+			return err
+		}
+
+		// retried operations must not add themselves to the
+		// queue again: the outcome is recorded here.
+		rctx := retry.WithQueue(ctx, nil)
+
+		now := time.Now()
+		outcomes := map[string]func(*retry.Item) bool{}
+		for _, item := range items {
+			if !item.Due(now) {
+				continue
+			}
+
+			idx := slices.IndexFunc(repos, func(rp GitRepository) bool { return rp.Name == item.Target })
+			if idx < 0 {
+				outcomes[item.ID] = failItem(fmt.Errorf("repository %q is not configured", item.Target))
+				continue
+			}
+			rp := repos[idx]
+
+			wf := rp.RetryWorker(item)
+			switch {
+			case wf == nil:
+				outcomes[item.ID] = failItem(fmt.Errorf("cannot retry %q operations", item.Op))
+				continue
+			case !rp.Reachable(ctx, item.Host):
+				outcomes[item.ID] = retryItem(ErrNetworkUnavailable)
+				continue
+			}
+
+			err := wf.Run(rctx)
+			switch {
+			case err == nil:
+				outcomes[item.ID] = func(*retry.Item) bool { return false }
+			case errors.Is(err, ErrNetworkUnavailable):
+				outcomes[item.ID] = retryItem(err)
+			default:
+				outcomes[item.ID] = failItem(err)
+			}
+
+			grip.Info(message.NewKV().
+				KV("op", opName).
+				KV("id", item.ID).
+				KV("repo", item.Target).
+				KV("retried", item.Op).
+				KV("host", item.Host).
+				KV("attempts", item.Attempts+1).
+				KV("err", err))
+
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		if len(outcomes) == 0 {
+			return nil
+		}
+
+		return q.Update(func(items []retry.Item) []retry.Item {
+			out := items[:0]
+			for _, item := range items {
+				if outcome, ok := outcomes[item.ID]; ok && !outcome(&item) {
+					continue
+				}
+				out = append(out, item)
+			}
+			return out
+		})
+	}
+}
+
+func retryItem(err error) func(*retry.Item) bool {
+	return func(item *retry.Item) bool { item.Retry(err); return true }
+}
+
+func failItem(err error) func(*retry.Item) bool {
+	return func(item *retry.Item) bool { item.Fail(err); return true }
+}
@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestIsNetworkError(t *testing.T) {
+	errExit := errors.New("exit status 128")
+
+	for _, tt := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "TransportOutput",
+			err:  asTransportError(errExit, "fatal: unable to access 'https://github.com/x/y/': Could not resolve host: github.com"),
+			want: true,
+		},
+		{
+			name: "SSH",
+			err:  asTransportError(errors.New("exit status 255"), "ssh: connect to host mirror port 22: No route to host"),
+			want: true,
+		},
+		{
+			name: "NetError",
+			err:  fmt.Errorf("fetching: %w", asTransportError(&net.OpError{Op: "dial", Err: errors.New("refused")}, "")),
+			want: true,
+		},
+		{
+			name: "WrappedTransportError",
+			err:  fmt.Errorf("push origin for %q: %w", "notes", asTransportError(errExit, "Connection timed out")),
+			want: true,
+		},
+		{
+			name: "RemoteRejected",
+			err:  asTransportError(errExit, "! [rejected] main -> main (non-fast-forward)"),
+		},
+		{
+			name: "NotATransportError",
+			err:  errors.New("hook failed: could not resolve host in test fixture"),
+		},
+		{
+			name: "Canceled",
+			err:  asTransportError(context.Canceled, "connection reset by peer"),
+		},
+		{
+			name: "Deadline",
+			err:  asTransportError(fmt.Errorf("dial: %w", context.DeadlineExceeded), ""),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNetworkError(tt.err); got != tt.want {
+				t.Errorf("isNetworkError(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeferOnNetworkError(t *testing.T) {
+	conf := &GitRepository{Name: "notes", Remote: "/srv/git/notes.git"}
+	err := asTransportError(errors.New("exit status 128"), "Could not resolve host: example.com")
+
+	// local remotes are always reachable, so the error stands.
+	if got := conf.deferOnNetworkError(t.Context(), "fetch", "", err); errors.Is(got, ErrNetworkUnavailable) {
+		t.Errorf("deferred an error for a reachable remote: %v", got)
+	}
+
+	other := errors.New("rebase conflict")
+	if got := conf.deferOnNetworkError(t.Context(), "fetch", "", other); got != other {
+		t.Errorf("unexpected error %v", got)
+	}
+}
+
+func TestParseSSHProbeAddress(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+		addr   string
+	}{
+		{name: "Defaults", config: "", addr: "mirror:22"},
+		{name: "Alias", config: "user tycho\nhostname desktop.example.com\nport 2222\nproxyusefdpass no\n", addr: "desktop.example.com:2222"},
+		{name: "NoProxy", config: "hostname 10.0.0.2\nport 22\nproxycommand none\n", addr: "10.0.0.2:22"},
+		{name: "ProxyJump", config: "hostname 10.0.0.2\nport 22\nproxyjump bastion\n", addr: ""},
+		{name: "ProxyCommand", config: "hostname 10.0.0.2\nproxycommand ssh -W %h:%p bastion\n", addr: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseSSHProbeAddress("mirror", tc.config); got != tc.addr {
+				t.Errorf("got %q, want %q", got, tc.addr)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package repo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/level"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/grip/send"
+	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/util"
+)
+
+// ContentPolicy describes which files automatic syncs may commit. Files
+// that violate the policy are unstaged before the commit and reported,
+// rather than pushed to every mirror.
+//
+// Deny patterns use the syntax of path.Match: "*" does not match "/",
+// and "**" is not supported. Patterns without a "/" match the name of
+// a file in any directory; patterns with a "/" match the path of the
+// file relative to the root of the repository.
+type ContentPolicy struct {
+	MaxFileSize    int64    `bson:"max_file_size" json:"max_file_size" yaml:"max_file_size"`
+	Deny           []string `bson:"deny" json:"deny" yaml:"deny"`
+	SkipSecretScan bool     `bson:"skip_secret_scan" json:"skip_secret_scan" yaml:"skip_secret_scan"`
+}
+
+func (p *ContentPolicy) Validate() error {
+	ec := &erc.Collector{}
+
+	ec.Whenf(p.MaxFileSize < 0, "max file size %d cannot be negative", p.MaxFileSize)
+	for _, pattern := range p.Deny {
+		if _, err := path.Match(pattern, ""); err != nil {
+			ec.Wrapf(err, "invalid deny pattern %q", pattern)
+		}
+		ec.Whenf(strings.Contains(pattern, "**"), "deny pattern %q cannot contain '**'", pattern)
+	}
+
+	return ec.Resolve()
+}
+
+// Violation records a single file that was held back from a sync
+// and the reason for it. Host is the mirror host that held the file
+// back, for files held back on mirror hosts.
+type Violation struct {
+	Path   string `bson:"path" json:"path" yaml:"path"`
+	Reason string `bson:"reason" json:"reason" yaml:"reason"`
+	Host   string `bson:"host,omitempty" json:"host,omitempty" yaml:"host,omitempty"`
+}
+
+func (v Violation) String() string {
+	if v.Host != "" {
+		return fmt.Sprintf("%s:%s (%s)", v.Host, v.Path, v.Reason)
+	}
+	return fmt.Sprintf("%s (%s)", v.Path, v.Reason)
+}
+
+// SyncResult describes the outcome of a sync. HeldBack lists the
+// files that the content policy prevented from being committed.
+type SyncResult struct {
+	Repo     string         `bson:"repo" json:"repo" yaml:"repo"`
+	Host     string         `bson:"host" json:"host" yaml:"host"`
+	HeldBack []Violation    `bson:"held_back" json:"held_back" yaml:"held_back"`
+	Remotes  []RemoteResult `bson:"remotes" json:"remotes" yaml:"remotes"`
+}
+
+func (sr *SyncResult) Message() *message.KV {
+	held := make([]string, 0, len(sr.HeldBack))
+	for _, v := range sr.HeldBack {
+		held = append(held, v.String())
+	}
+
+	return message.NewKV().
+		KV("repo", sr.Repo).
+		KV("host", sr.Host).
+		KV("held", len(sr.HeldBack)).
+		KV("files", strings.Join(held, ", ")).
+		KV("remotes", renderRemoteResults(sr.Remotes))
+}
+
+// secretScanLimit bounds how much of each file the secret scan reads.
+const secretScanLimit = 1024 * 1024
+
+var secretPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`)},
+	{"aws access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})\b`)},
+	{"gitlab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+	{"slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"api key", regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{32,}\b`)},
+}
+
+// check returns a violation for the file at the path (relative to the
+// root of the repository) if it does not satisfy the policy.
+func (p *ContentPolicy) check(root, name string) (*Violation, error) {
+	for _, pattern := range p.Deny {
+		if p.denies(pattern, name) {
+			return &Violation{Path: name, Reason: fmt.Sprintf("matches %q", pattern)}, nil
+		}
+	}
+
+	fn := filepath.Join(root, filepath.FromSlash(name))
+	stat, err := os.Lstat(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !stat.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	if p.MaxFileSize > 0 && stat.Size() > p.MaxFileSize {
+		return &Violation{Path: name, Reason: fmt.Sprintf("%d bytes exceeds limit of %d", stat.Size(), p.MaxFileSize)}, nil
+	}
+
+	if p.SkipSecretScan {
+		return nil, nil
+	}
+
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer util.DropErrorOnDefer(file.Close)
+
+	scanner := bufio.NewScanner(io.LimitReader(file, secretScanLimit))
+	scanner.Buffer(make([]byte, 0, 64*1024), secretScanLimit)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		for _, sp := range secretPatterns {
+			if sp.pattern.Match(line) {
+				return &Violation{Path: name, Reason: fmt.Sprintf("contains %s", sp.name)}, nil
+			}
+		}
+	}
+
+	return nil, scanner.Err()
+}
+
+// stagedViolations returns the sorted set of staged files that
+// violate the repository's content policy.
+func (conf *GitRepository) stagedViolations() ([]Violation, error) {
+	repo, err := git.PlainOpen(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []Violation{}
+	for name, fs := range stat {
+		switch fs.Staging {
+		case git.Added, git.Modified, git.Renamed, git.Copied:
+		default:
+			continue
+		}
+
+		v, err := conf.Policy.check(conf.Path, name)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			out = append(out, *v)
+		}
+	}
+
+	slices.SortFunc(out, func(a, b Violation) int { return strings.Compare(a.Path, b.Path) })
+
+	return out, nil
+}
+
+// enforcePolicyJob unstages every staged file that violates the
+// content policy, and records them in the result.
+func (conf *GitRepository) enforcePolicyJob(id string, sender send.Sender, result *SyncResult) fnx.Worker {
+	return func(ctx context.Context) error {
+		held, err := conf.stagedViolations()
+		if err != nil {
+			return err
+		}
+
+		if len(held) == 0 {
+			return nil
+		}
+
+		result.HeldBack = append(result.HeldBack, held...)
+
+		paths := make([]string, 0, len(held))
+		for _, v := range held {
+			paths = append(paths, v.Path)
+		}
+
+		grip.Warning(result.Message().
+			KV("id", id).
+			KV("path", conf.Path).
+			KV("msg", "holding back files that violate the content policy"))
+
+		return jasper.Context(ctx).
+			CreateCommand(ctx).
+			ID(id).
+			SetOutputSender(level.Info, sender).
+			SetErrorSender(level.Info, sender).
+			Directory(conf.Path).
+			AppendArgs(append([]string{"git", "reset", "--quiet", "--"}, paths...)...).
+			Run(ctx)
+	}
+}
+
+func (*ContentPolicy) denies(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// excludePathspecs renders the deny patterns as git pathspecs so that
+// commands running on remote hosts do not stage denied files. The pathspecs match the same files
+// as the local check: git's glob magic matches "*" within a single
+// path component, like path.Match.
+func (p *ContentPolicy) excludePathspecs() string {
+	if len(p.Deny) == 0 {
+		return ""
+	}
+
+	specs := make([]string, 0, len(p.Deny)+1)
+	specs = append(specs, "-- .")
+	for _, pattern := range p.Deny {
+		if !strings.Contains(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		specs = append(specs, shellQuote(":(exclude,glob)"+pattern))
+	}
+
+	return strings.Join(specs, " ")
+}
+
+// remoteHeldBack is the prefix of the lines that remoteCheckCmd
+// writes to standard error for each file that it holds back.
+const remoteHeldBack = "sardis: held back: "
+
+// remoteCheckCmd is a shell snippet that runs the policy check on a
+// mirror host, after the changes are staged. Denied files are never
+// staged (see excludePathspecs), and are only reported; staged files
+// that exceed the size limit or contain secrets are unstaged. Each
+// file is reported on standard error for parseHeldBack. The snippet
+// is empty when the policy is empty.
+func (p *ContentPolicy) remoteCheckCmd() string {
+	var checks []string
+	for _, pattern := range p.Deny {
+		spec := pattern
+		if !strings.Contains(spec, "/") {
+			spec = "**/" + spec
+		}
+		checks = append(checks, fmt.Sprintf(
+			"git ls-files -m -o --exclude-standard -- %s | while IFS= read -r f; do printf '%s%%s (matches %%s)\\n' \"$f\" %s >&2; done",
+			shellQuote(":(glob)"+spec), remoteHeldBack, shellQuote(fmt.Sprintf("%q", pattern))))
+	}
+
+	var conds []string
+	if p.MaxFileSize > 0 {
+		conds = append(conds, fmt.Sprintf(
+			"if [ \"$(wc -c < \"$f\" | tr -d ' ')\" -gt %d ]; then r=\"$(wc -c < \"$f\" | tr -d ' ') bytes exceeds limit of %d\"",
+			p.MaxFileSize, p.MaxFileSize))
+	}
+	if !p.SkipSecretScan {
+		for _, sp := range secretPatterns {
+			conds = append(conds, fmt.Sprintf("if head -c %d \"$f\" | grep -qE -e %s; then r=%s",
+				secretScanLimit, shellQuote(posixRegexp(sp.pattern.String())), shellQuote("contains "+sp.name)))
+		}
+	}
+
+	if len(conds) > 0 {
+		checks = append(checks, fmt.Sprintf(
+			"git diff --cached --name-only --diff-filter=AMRC | while IFS= read -r f; do "+
+				"[ -f \"$f\" ] && [ ! -L \"$f\" ] || continue; r=''; %s; fi; "+
+				"if [ -n \"$r\" ]; then git reset --quiet -- \"$f\"; printf '%s%%s (%%s)\\n' \"$f\" \"$r\" >&2; fi; done",
+			strings.Join(conds, "; el"), remoteHeldBack))
+	}
+
+	if len(checks) == 0 {
+		return ""
+	}
+	return "{ " + strings.Join(checks, "; ") + "; }"
+}
+
+// posixRegexp rewrites the word boundaries of a secret pattern, which
+// POSIX extended regular expressions do not have, as the equivalent
+// character classes.
+func posixRegexp(pattern string) string {
+	if rest, ok := strings.CutPrefix(pattern, `\b`); ok {
+		pattern = "(^|[^0-9A-Za-z_])" + rest
+	}
+	if rest, ok := strings.CutSuffix(pattern, `\b`); ok {
+		pattern = rest + "([^0-9A-Za-z_]|$)"
+	}
+	return pattern
+}
+
+// parseHeldBack returns the files that remoteCheckCmd reported in the
+// output of a remote sync.
+func parseHeldBack(output string) []Violation {
+	var out []Violation
+	for line := range strings.Lines(output) {
+		entry, ok := strings.CutPrefix(strings.TrimSpace(line), remoteHeldBack)
+		if !ok {
+			continue
+		}
+		// the reason follows the last parenthesis: file names may
+		// contain parentheses.
+		idx := strings.LastIndex(entry, " (")
+		if idx < 0 {
+			continue
+		}
+		out = append(out, Violation{Path: entry[:idx], Reason: strings.TrimSuffix(entry[idx+2:], ")")})
+	}
+	return out
+}
+
+// shellQuote quotes the value as a single word for the shell commands
+// that run on remote hosts.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/tychoish/sardis/util"
+)
+
+// DefaultLayout is the path template used to place new checkouts when
+// the configuration does not specify a layout.
+const DefaultLayout = "~/src/{{name}}"
+
+// Remote is a parsed remote URL.
+type Remote struct {
+	URL   string
+	Host  string
+	Owner string
+	Name  string
+}
+
+// ParseRemote resolves a remote URL, in scp (git@host:owner/name),
+// ssh, or https form, or a shorthand for one of the default forges
+// (owner/name or gh:owner/name), into its components.
+func ParseRemote(spec string) (*Remote, error) { return Forges(nil).ParseRemote(spec) }
+
+// ParseRemote resolves a remote URL or a forge shorthand, using the
+// forges (and the default forges), into its components. Bare
+// owner/name shorthands resolve to the DefaultForge.
+func (fs Forges) ParseRemote(spec string) (*Remote, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("remote must not be empty")
+	}
+
+	out := &Remote{URL: spec}
+	var repoPath string
+
+	forge, rest, isShorthand := fs.splitForgeShorthand(spec)
+
+	switch {
+	case strings.Contains(spec, "://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("remote %q: %w", spec, err)
+		}
+		out.Host = u.Hostname()
+		repoPath = u.Path
+	case strings.Contains(spec, "@") && strings.Contains(spec, ":"):
+		host, rest, _ := strings.Cut(spec, ":")
+		_, out.Host, _ = strings.Cut(host, "@")
+		repoPath = rest
+	case strings.ContainsRune("/.~", rune(spec[0])):
+		return nil, fmt.Errorf("remote %q is a local path", spec)
+	case !isShorthand && strings.Contains(spec, ":"):
+		// scp-style remotes without a user (e.g.
+		// git.example.com:src/notes.git).
+		out.Host, repoPath, _ = strings.Cut(spec, ":")
+	default:
+		if !isShorthand {
+			forge, rest = DefaultForge, spec
+		}
+
+		expanded, err := fs.expand(spec, forge, rest)
+		if err != nil {
+			return nil, err
+		}
+
+		out, err = fs.ParseRemote(expanded)
+		if err != nil {
+			return nil, err
+		}
+
+		if account, _, ok := strings.Cut(strings.Trim(rest, "/"), "/"); ok {
+			out.Owner = account
+		} else if f, ok := fs.withDefaults().Find(forge); ok {
+			out.Owner = f.Account
+		}
+
+		return out, nil
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	out.Owner, out.Name = path.Split(repoPath)
+	out.Owner = strings.Trim(out.Owner, "/")
+
+	if out.Host == "" || out.Name == "" {
+		return nil, fmt.Errorf("could not determine host and repository name from remote %q", spec)
+	}
+
+	return out, nil
+}
+
+// Path renders the checkout path for the remote from a layout
+// template. Layouts may use the {{host}}, {{owner}}, and {{name}}
+// placeholders.
+func (r *Remote) Path(layout string) string {
+	layout = util.Default(layout, DefaultLayout)
+	layout = strings.ReplaceAll(layout, "{{host}}", r.Host)
+	layout = strings.ReplaceAll(layout, "{{owner}}", r.Owner)
+	layout = strings.ReplaceAll(layout, "{{name}}", r.Name)
+	return path.Clean(layout)
+}
@@ -0,0 +1,241 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/grip/level"
+	"github.com/tychoish/grip/send"
+	"github.com/tychoish/jasper"
+)
+
+type RemoteRole string
+
+const (
+	// RemoteRoleFetch remotes are fetched from, and never pushed to.
+	RemoteRoleFetch RemoteRole = "fetch"
+	// RemoteRolePush remotes are fetched from, and the branch is
+	// pushed to them during syncs.
+	RemoteRolePush RemoteRole = "push"
+	// RemoteRoleMirror remotes receive all refs (git push
+	// --mirror) during syncs, and are never fetched from.
+	RemoteRoleMirror RemoteRole = "mirror"
+)
+
+// GitRemote is an additional git remote for a repository. Remotes
+// without a role are both fetched from and pushed to. A remote with
+// the same name as the repository's primary remote (remote_name) sets
+// the role of the primary remote.
+type GitRemote struct {
+	Name string     `bson:"name" json:"name" yaml:"name"`
+	URL  string     `bson:"url" json:"url" yaml:"url"`
+	Role RemoteRole `bson:"role" json:"role" yaml:"role"`
+}
+
+func (r GitRemote) Fetches() bool { return r.Role != RemoteRoleMirror }
+func (r GitRemote) Pushes() bool  { return r.Role != RemoteRoleFetch }
+
+// fetchArgs is the command that fetches the remote.
+func (r GitRemote) fetchArgs() []string { return []string{"git", "fetch", "--prune", r.Name} }
+
+// RemoteResult is the outcome of a fetch or push for a single remote.
+type RemoteResult struct {
+	Remote string `bson:"remote" json:"remote" yaml:"remote"`
+	Op     string `bson:"op" json:"op" yaml:"op"`
+	Error  string `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func (rr RemoteResult) String() string {
+	if rr.Error != "" {
+		return fmt.Sprintf("%s:%s:failed(%s)", rr.Op, rr.Remote, rr.Error)
+	}
+	return fmt.Sprintf("%s:%s:ok", rr.Op, rr.Remote)
+}
+
+func renderRemoteResults(results []RemoteResult) string {
+	out := make([]string, 0, len(results))
+	for _, rr := range results {
+		out = append(out, rr.String())
+	}
+	return strings.Join(out, ", ")
+}
+
+func (conf *GitRepository) validateRemotes() error {
+	ec := &erc.Collector{}
+	seen := map[string]bool{}
+
+	for _, rm := range conf.Remotes {
+		ec.Whenf(rm.Name == "", "remote for %q must have a name", conf.Name)
+		ec.Whenf(seen[rm.Name], "remote %q for %q is defined more than once", rm.Name, conf.Name)
+		ec.Whenf(rm.URL == "" && rm.Name != conf.RemoteName, "remote %q for %q does not specify a url", rm.Name, conf.Name)
+		seen[rm.Name] = true
+
+		switch rm.Role {
+		case "", RemoteRoleFetch, RemoteRolePush, RemoteRoleMirror:
+		default:
+			ec.Errorf("remote %q for %q has invalid role %q", rm.Name, conf.Name, rm.Role)
+		}
+	}
+
+	return ec.Resolve()
+}
+
+// AllRemotes returns the primary remote followed by the additional
+// remotes.
+func (conf *GitRepository) AllRemotes() []GitRemote {
+	primary := GitRemote{Name: conf.RemoteName, URL: conf.Remote}
+	extra := make([]GitRemote, 0, len(conf.Remotes))
+
+	for _, rm := range conf.Remotes {
+		if rm.Name == conf.RemoteName {
+			primary.Role = rm.Role
+			continue
+		}
+		extra = append(extra, rm)
+	}
+
+	return append([]GitRemote{primary}, extra...)
+}
+
+// primaryRemote returns the primary remote, with its role.
+func (conf *GitRepository) primaryRemote() GitRemote { return conf.AllRemotes()[0] }
+
+// extraRemotes returns the remotes other than the primary remote.
+func (conf *GitRepository) extraRemotes() []GitRemote { return conf.AllRemotes()[1:] }
+
+// fetchRemotesJob fetches every additional remote that is not a
+// mirror. Every remote is fetched even if some fail.
+func (conf *GitRepository) fetchRemotesJob(id string, sender send.Sender, results *[]RemoteResult) fnx.Worker {
+	return func(ctx context.Context) error {
+		ec := &erc.Collector{}
+		for _, rm := range conf.extraRemotes() {
+			if !rm.Fetches() {
+				continue
+			}
+			ec.Push(conf.remoteOp(ctx, id, sender, results, rm, "fetch", rm.fetchArgs()...))
+		}
+		return ec.Resolve()
+	}
+}
+
+// remoteCommand is a git command for one of the remotes.
+type remoteCommand struct {
+	remote GitRemote
+	args   []string
+}
+
+// pushCommands are the commands that push the branch to every push
+// remote, and all refs to every mirror remote. Repositories without
+// additional remotes, or a role for the primary remote, keep using a
+// bare `git push`.
+func (conf *GitRepository) pushCommands() []remoteCommand {
+	if primary := conf.primaryRemote(); len(conf.extraRemotes()) == 0 && primary.Role == "" {
+		return []remoteCommand{{remote: primary, args: []string{"git", "push"}}}
+	}
+
+	var out []remoteCommand
+	for _, rm := range conf.AllRemotes() {
+		switch {
+		case !rm.Pushes():
+			continue
+		case rm.Role == RemoteRoleMirror:
+			out = append(out, remoteCommand{remote: rm, args: []string{"git", "push", "--mirror", rm.Name}})
+		default:
+			out = append(out, remoteCommand{remote: rm, args: []string{"git", "push", rm.Name, conf.Branch}})
+		}
+	}
+	return out
+}
+
+// remotePushCmd renders the pushCommands as a shell command for
+// mirror hosts. Like pushRemotesJob, it pushes to every remote even if
+// some fail.
+func (conf *GitRepository) remotePushCmd() string {
+	cmds := conf.pushCommands()
+	out := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		args := make([]string, 0, len(cmd.args))
+		for _, arg := range cmd.args {
+			args = append(args, shellQuote(arg))
+		}
+		out = append(out, strings.Join(args, " "))
+	}
+
+	switch len(out) {
+	case 0:
+		return ""
+	case 1:
+		return out[0]
+	default:
+		return "{ rc=0; " + strings.Join(out, " || rc=$?; ") + " || rc=$?; [ $rc -eq 0 ]; }"
+	}
+}
+
+// pushRemotesJob runs the pushCommands. Every remote is pushed even
+// if some fail.
+func (conf *GitRepository) pushRemotesJob(id string, sender send.Sender, results *[]RemoteResult) fnx.Worker {
+	return func(ctx context.Context) error {
+		ec := &erc.Collector{}
+		for _, cmd := range conf.pushCommands() {
+			ec.Push(conf.remoteOp(ctx, id, sender, results, cmd.remote, "push", cmd.args...))
+		}
+		return ec.Resolve()
+	}
+}
+
+// configureRemotesJob adds (or updates the url of) every additional
+// remote in a checkout.
+func (conf *GitRepository) configureRemotesJob(id string, sender send.Sender) fnx.Worker {
+	return func(ctx context.Context) error {
+		ec := &erc.Collector{}
+		for _, rm := range conf.extraRemotes() {
+			op := "add"
+			if conf.hasRemote(rm.Name) {
+				op = "set-url"
+			}
+
+			ec.Push(jasper.Context(ctx).
+				CreateCommand(ctx).
+				ID(id).
+				SetOutputSender(level.Info, sender).
+				SetErrorSender(level.Info, sender).
+				Directory(conf.Path).
+				AppendArgs("git", "remote", op, rm.Name, rm.URL).
+				Run(ctx))
+		}
+		return ec.Resolve()
+	}
+}
+
+func (conf *GitRepository) hasRemote(name string) bool {
+	repo, err := openRepo(conf.Path)
+	if err != nil {
+		return false
+	}
+	_, err = repo.Remote(name)
+	return err == nil
+}
+
+func (conf *GitRepository) remoteOp(
+	ctx context.Context,
+	id string,
+	sender send.Sender,
+	results *[]RemoteResult,
+	rm GitRemote,
+	op string,
+	args ...string,
+) error {
+	err := transportJob(id, conf.Path, sender, args...).Run(ctx)
+
+	rr := RemoteResult{Remote: rm.Name, Op: op}
+	if err != nil {
+		rr.Error = err.Error()
+		err = fmt.Errorf("%s %s for %q: %w", op, rm.Name, conf.Name, err)
+	}
+	*results = append(*results, rr)
+
+	return err
+}
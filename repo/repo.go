@@ -4,28 +4,61 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/fnx"
 	"github.com/tychoish/sardis/subexec"
 	"github.com/tychoish/sardis/util"
 )
 
 type GitRepository struct {
-	Name       string          `bson:"name" json:"name" yaml:"name"`
-	Path       string          `bson:"path" json:"path" yaml:"path"`
-	Remote     string          `bson:"remote" json:"remote" yaml:"remote"`
-	RemoteName string          `bson:"remote_name" json:"remote_name" yaml:"remote_name"`
-	Branch     string          `bson:"branch" json:"branch" yaml:"branch"`
-	LocalSync  bool            `bson:"sync" json:"sync" yaml:"sync"`
-	Fetch      bool            `bson:"fetch" json:"fetch" yaml:"fetch"`
-	Notify     bool            `bson:"notify" json:"notify" yaml:"notify"`
-	Disabled   bool            `bson:"disabled" json:"disabled" yaml:"disabled"`
-	Logs       subexec.Logging `bson:"logs" json:"logs" yaml:"logs"`
-	Pre        []string        `bson:"pre" json:"pre" yaml:"pre"`
-	Post       []string        `bson:"post" json:"post" yaml:"post"`
-	Mirrors    []string        `bson:"mirrors" json:"mirrors" yaml:"mirrors"`
-	Tags       []string        `bson:"tags" json:"tags" yaml:"tags"`
+	Name       string            `bson:"name" json:"name" yaml:"name"`
+	Path       string            `bson:"path" json:"path" yaml:"path"`
+	Remote     string            `bson:"remote" json:"remote" yaml:"remote"`
+	RemoteName string            `bson:"remote_name" json:"remote_name" yaml:"remote_name"`
+	Branch     string            `bson:"branch" json:"branch" yaml:"branch"`
+	LocalSync  bool              `bson:"sync" json:"sync" yaml:"sync"`
+	Fetch      bool              `bson:"fetch" json:"fetch" yaml:"fetch"`
+	Notify     bool              `bson:"notify" json:"notify" yaml:"notify"`
+	Native     bool              `bson:"native" json:"native" yaml:"native"`
+	Disabled   bool              `bson:"disabled" json:"disabled" yaml:"disabled"`
+	Logs       subexec.Logging   `bson:"logs" json:"logs" yaml:"logs"`
+	Pre        []string          `bson:"pre" json:"pre" yaml:"pre"`
+	Post       []string          `bson:"post" json:"post" yaml:"post"`
+	Mirrors    []string          `bson:"mirrors" json:"mirrors" yaml:"mirrors"`
+	Tags       []string          `bson:"tags" json:"tags" yaml:"tags"`
+	Policy     ContentPolicy     `bson:"policy" json:"policy" yaml:"policy"`
+	Schedule   map[string]string `bson:"schedule" json:"schedule" yaml:"schedule"`
+	DependsOn  []string          `bson:"depends_on" json:"depends_on" yaml:"depends_on"`
+	Remotes    []GitRemote       `bson:"remotes" json:"remotes" yaml:"remotes"`
+	Lock       LockSettings      `bson:"lock" json:"lock" yaml:"lock"`
+	Cleanup    CleanupSettings   `bson:"cleanup" json:"cleanup" yaml:"cleanup"`
+	GitConfig  map[string]string `bson:"git_config" json:"git_config" yaml:"git_config"`
+}
+
+// ScheduledOperations are the names of the jobs that can be
+// scheduled for a repository.
+var ScheduledOperations = []string{"fetch", "sync", "update", "cleanup", "status"}
+
+// Job returns the worker for one of the ScheduledOperations, or nil
+// if the operation is not recognized.
+func (conf *GitRepository) Job(op string) fnx.Worker {
+	switch op {
+	case "fetch":
+		return conf.FetchJob()
+	case "sync":
+		return conf.SyncRemoteJob("LOCAL")
+	case "update":
+		return conf.UpdateJob()
+	case "cleanup":
+		return conf.CleanupJob()
+	case "status":
+		return conf.StatusJob()
+	default:
+		return nil
+	}
 }
 
 func (conf *GitRepository) Validate() error {
@@ -44,6 +77,14 @@ func (conf *GitRepository) Validate() error {
 
 	ec := &erc.Collector{}
 	ec.Push(conf.Logs.Validate())
+	ec.Wrapf(conf.Policy.Validate(), "content policy for %q", conf.Name)
+	ec.Push(conf.validateRemotes())
+	ec.Wrapf(conf.Lock.Validate(), "lock timeout for %q", conf.Name)
+	ec.Wrapf(conf.Cleanup.Validate(), "cleanup for %q", conf.Name)
+
+	var err error
+	conf.GitConfig, err = normalizeGitConfig(conf.GitConfig)
+	ec.Wrapf(err, "git config for %q", conf.Name)
 
 	if conf.Remote == "" {
 		ec.Push(fmt.Errorf("'%s' does not specify a remote", conf.Name))
@@ -53,6 +94,13 @@ func (conf *GitRepository) Validate() error {
 		ec.Push(errors.New("cannot specify sync and fetch"))
 	}
 
+	for op, interval := range conf.Schedule {
+		ec.Whenf(!slices.Contains(ScheduledOperations, op), "cannot schedule unknown operation %q for %q", op, conf.Name)
+		if _, err := util.ParseInterval(interval); err != nil {
+			ec.Wrapf(err, "schedule for %q of %q", op, conf.Name)
+		}
+	}
+
 	return ec.Resolve()
 }
 
@@ -0,0 +1,406 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tychoish/fun/dt"
+	"github.com/tychoish/fun/irt"
+	"github.com/tychoish/fun/stw"
+)
+
+// Selector expressions choose repositories by name, tag, tag group,
+// or named selector, combined with operators. From the tightest
+// binding to the loosest:
+//
+//	!a        repositories not matching a
+//	a & b     repositories matching both a and b
+//	a | b     repositories matching either a or b
+//	a, b, !c  repositories matching a or b, except those matching c
+//
+// Parentheses group sub-expressions. A comma separated list with only
+// negated items selects all repositories except those.
+type Selector struct {
+	expr string
+	root selectorNode
+}
+
+// SelectorError reports an invalid selector expression, and the
+// position of the offending token.
+type SelectorError struct {
+	Expr  string
+	Pos   int
+	Token string
+	Msg   string
+}
+
+func (e *SelectorError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("selector %q: %s at end of expression", e.Expr, e.Msg)
+	}
+	return fmt.Sprintf("selector %q: %s at position %d (%q)\n\t%s\n\t%s^",
+		e.Expr, e.Msg, e.Pos+1, e.Token, e.Expr, strings.Repeat(" ", e.Pos))
+}
+
+// ParseSelector parses a selector expression.
+func ParseSelector(expr string) (*Selector, error) {
+	p := &selectorParser{expr: expr, tokens: tokenizeSelector(expr)}
+
+	root, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected token")
+	}
+
+	return &Selector{expr: expr, root: root}, nil
+}
+
+func (s *Selector) String() string { return s.expr }
+
+// Select returns the repositories that match any of the selector
+// expressions, in configuration order.
+func (conf *Configuration) Select(exprs ...string) (stw.Slice[GitRepository], error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+
+	if err := conf.rebuildIndexes(); err != nil {
+		return nil, err
+	}
+
+	matched := dt.Set[string]{}
+	for _, expr := range exprs {
+		sel, err := ParseSelector(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		names, err := conf.evaluate(sel, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		matched.Extend(names.Iterator())
+	}
+
+	out := stw.Slice[GitRepository]{}
+	for _, rp := range conf.GitRepos {
+		if matched.Check(rp.Name) {
+			out.Push(rp)
+		}
+	}
+
+	return out, nil
+}
+
+func (conf *Configuration) evaluate(sel *Selector, resolving map[string]bool) (*dt.Set[string], error) {
+	return sel.root.eval(&selectorEnv{conf: conf, expr: sel.expr, resolving: resolving})
+}
+
+type selectorEnv struct {
+	conf      *Configuration
+	expr      string
+	resolving map[string]bool
+}
+
+func (env *selectorEnv) all() *dt.Set[string] {
+	out := &dt.Set[string]{}
+	for _, rp := range env.conf.GitRepos {
+		out.Add(rp.Name)
+	}
+	return out
+}
+
+func (env *selectorEnv) resolve(tok selectorToken) (*dt.Set[string], error) {
+	out := &dt.Set[string]{}
+
+	if env.conf.caches.lookup.Check(tok.text) {
+		out.Add(tok.text)
+		return out, nil
+	}
+
+	if names, ok := env.conf.caches.tags.Load(tok.text); ok {
+		out.Extend(irt.Slice(names))
+		return out, nil
+	}
+
+	if expr, ok := env.conf.Selectors[tok.text]; ok {
+		if env.resolving[tok.text] {
+			return nil, &SelectorError{Expr: env.expr, Pos: tok.pos, Token: tok.text, Msg: "selector refers to itself"}
+		}
+		env.resolving[tok.text] = true
+		defer delete(env.resolving, tok.text)
+
+		sel, err := ParseSelector(expr)
+		if err != nil {
+			return nil, fmt.Errorf("named selector %q: %w", tok.text, err)
+		}
+		return env.conf.evaluate(sel, env.resolving)
+	}
+
+	return nil, &SelectorError{Expr: env.expr, Pos: tok.pos, Token: tok.text, Msg: "unknown repository, tag, or selector"}
+}
+
+type selectorNode interface {
+	eval(*selectorEnv) (*dt.Set[string], error)
+}
+
+type (
+	selectorIdent struct{ tok selectorToken }
+	selectorNot   struct{ node selectorNode }
+	selectorAnd   struct{ nodes []selectorNode }
+	selectorOr    struct{ nodes []selectorNode }
+	selectorList  struct{ include, exclude []selectorNode }
+)
+
+func (n selectorIdent) eval(env *selectorEnv) (*dt.Set[string], error) { return env.resolve(n.tok) }
+
+func (n selectorNot) eval(env *selectorEnv) (*dt.Set[string], error) {
+	inner, err := n.node.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	out := env.all()
+	removeAll(out, inner)
+	return out, nil
+}
+
+func (n selectorAnd) eval(env *selectorEnv) (*dt.Set[string], error) {
+	var out *dt.Set[string]
+	for _, node := range n.nodes {
+		set, err := node.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if out == nil {
+			out = set
+			continue
+		}
+		for _, name := range irt.Collect(out.Iterator()) {
+			if !set.Check(name) {
+				out.Delete(name)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (n selectorOr) eval(env *selectorEnv) (*dt.Set[string], error) {
+	out := &dt.Set[string]{}
+	for _, node := range n.nodes {
+		set, err := node.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		out.Extend(set.Iterator())
+	}
+	return out, nil
+}
+
+func (n selectorList) eval(env *selectorEnv) (*dt.Set[string], error) {
+	out := &dt.Set[string]{}
+	if len(n.include) == 0 {
+		out = env.all()
+	}
+
+	for _, node := range n.include {
+		set, err := node.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		out.Extend(set.Iterator())
+	}
+
+	for _, node := range n.exclude {
+		set, err := node.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		removeAll(out, set)
+	}
+
+	return out, nil
+}
+
+func removeAll(set, remove *dt.Set[string]) {
+	for name := range remove.Iterator() {
+		set.Delete(name)
+	}
+}
+
+type selectorTokenKind int
+
+const (
+	tokEOF selectorTokenKind = iota
+	tokIdent
+	tokComma
+	tokOr
+	tokAnd
+	tokNot
+	tokOpen
+	tokClose
+)
+
+type selectorToken struct {
+	kind selectorTokenKind
+	text string
+	pos  int
+}
+
+func tokenizeSelector(expr string) []selectorToken {
+	var out []selectorToken
+
+	for idx := 0; idx < len(expr); {
+		ch := expr[idx]
+		switch ch {
+		case ' ', '\t', '\n':
+			idx++
+			continue
+		case ',':
+			out = append(out, selectorToken{kind: tokComma, text: ",", pos: idx})
+		case '|':
+			out = append(out, selectorToken{kind: tokOr, text: "|", pos: idx})
+		case '&':
+			out = append(out, selectorToken{kind: tokAnd, text: "&", pos: idx})
+		case '!':
+			out = append(out, selectorToken{kind: tokNot, text: "!", pos: idx})
+		case '(':
+			out = append(out, selectorToken{kind: tokOpen, text: "(", pos: idx})
+		case ')':
+			out = append(out, selectorToken{kind: tokClose, text: ")", pos: idx})
+		default:
+			end := idx
+			for end < len(expr) && !strings.ContainsRune(" \t\n,|&!()", rune(expr[end])) {
+				end++
+			}
+			out = append(out, selectorToken{kind: tokIdent, text: expr[idx:end], pos: idx})
+			idx = end
+			continue
+		}
+		idx++
+	}
+
+	return append(out, selectorToken{kind: tokEOF, pos: len(expr)})
+}
+
+type selectorParser struct {
+	expr   string
+	tokens []selectorToken
+	pos    int
+}
+
+func (p *selectorParser) peek() selectorToken { return p.tokens[p.pos] }
+func (p *selectorParser) next() selectorToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *selectorParser) errorf(tok selectorToken, msg string) error {
+	return &SelectorError{Expr: p.expr, Pos: tok.pos, Token: tok.text, Msg: msg}
+}
+
+// parseList handles comma separated lists, where negated items are
+// exclusions rather than complements.
+func (p *selectorParser) parseList() (selectorNode, error) {
+	list := selectorList{}
+
+	for {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if not, ok := node.(selectorNot); ok {
+			list.exclude = append(list.exclude, not.node)
+		} else {
+			list.include = append(list.include, node)
+		}
+
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+
+	if len(list.include) == 1 && len(list.exclude) == 0 {
+		return list.include[0], nil
+	}
+	return list, nil
+}
+
+func (p *selectorParser) parseOr() (selectorNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []selectorNode{node}
+	for p.peek().kind == tokOr {
+		p.next()
+		if node, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return selectorOr{nodes: nodes}, nil
+}
+
+func (p *selectorParser) parseAnd() (selectorNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []selectorNode{node}
+	for p.peek().kind == tokAnd {
+		p.next()
+		if node, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return selectorAnd{nodes: nodes}, nil
+}
+
+func (p *selectorParser) parseUnary() (selectorNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNot:
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return selectorNot{node: node}, nil
+	case tokOpen:
+		node, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokClose {
+			if closing.kind == tokEOF {
+				return nil, p.errorf(tok, "unclosed parenthesis")
+			}
+			return nil, p.errorf(closing, "expected ')'")
+		}
+		return node, nil
+	case tokIdent:
+		return selectorIdent{tok: tok}, nil
+	case tokEOF:
+		return nil, p.errorf(tok, "expected a repository, tag, or '('")
+	default:
+		return nil, p.errorf(tok, "expected a repository, tag, or '('")
+	}
+}
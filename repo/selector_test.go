@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/tychoish/fun/stw"
+)
+
+func selectorTestConfig() *Configuration {
+	return &Configuration{
+		GitRepos: []GitRepository{
+			{Name: "dotfiles", Tags: []string{"config", "sync"}},
+			{Name: "notes", Tags: []string{"sync", "docs"}},
+			{Name: "sardis", Tags: []string{"code"}},
+			{Name: "fun", Tags: []string{"code", "library"}},
+			{Name: "archive"},
+		},
+		TagGroups: stw.Map[string, stw.Slice[string]]{"personal": {"config", "docs"}},
+		Selectors: map[string]string{
+			"libraries": "library",
+			"work":      "code & !libraries",
+			"loop":      "loop | sync",
+		},
+	}
+}
+
+func repoNames(repos []GitRepository) []string {
+	out := make([]string, 0, len(repos))
+	for _, rp := range repos {
+		out = append(out, rp.Name)
+	}
+	return out
+}
+
+func TestSelect(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		exprs []string
+		want  []string
+	}{
+		{name: "Name", exprs: []string{"notes"}, want: []string{"notes"}},
+		{name: "Tag", exprs: []string{"sync"}, want: []string{"dotfiles", "notes"}},
+		{name: "TagGroup", exprs: []string{"personal"}, want: []string{"dotfiles", "notes"}},
+		{name: "NamedSelector", exprs: []string{"work"}, want: []string{"sardis"}},
+		{name: "Not", exprs: []string{"!code"}, want: []string{"dotfiles", "notes", "archive"}},
+		{name: "And", exprs: []string{"sync & docs"}, want: []string{"notes"}},
+		{name: "Or", exprs: []string{"config | library"}, want: []string{"dotfiles", "fun"}},
+		{name: "AndBindsTighterThanOr", exprs: []string{"config | code & library"}, want: []string{"dotfiles", "fun"}},
+		{name: "Parentheses", exprs: []string{"(config | code) & !library"}, want: []string{"dotfiles", "sardis"}},
+		{name: "ListExcludes", exprs: []string{"sync, code, !fun"}, want: []string{"dotfiles", "notes", "sardis"}},
+		{name: "OnlyExclusions", exprs: []string{"!sync, !code"}, want: []string{"archive"}},
+		{name: "MultipleExpressions", exprs: []string{"notes", "fun"}, want: []string{"notes", "fun"}},
+		{name: "ConfigurationOrder", exprs: []string{"archive, dotfiles"}, want: []string{"dotfiles", "archive"}},
+		{name: "NoExpressions", exprs: nil, want: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repos, err := selectorTestConfig().Select(tt.exprs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := repoNames(repos); !slices.Equal(got, tt.want) && (len(got) != 0 || len(tt.want) != 0) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		expr string
+		pos  int
+	}{
+		{name: "Unknown", expr: "sync | nothing", pos: 7},
+		{name: "TrailingOperator", expr: "sync &", pos: 6},
+		{name: "Unclosed", expr: "(sync | code", pos: 0},
+		{name: "UnexpectedClose", expr: "sync)", pos: 4},
+		{name: "SelfReference", expr: "loop", pos: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := selectorTestConfig().Select(tt.expr)
+			var serr *SelectorError
+			if !errors.As(err, &serr) {
+				t.Fatalf("expected a selector error, got %v", err)
+			}
+			if serr.Pos != tt.pos {
+				t.Errorf("error at position %d, want %d: %v", serr.Pos, tt.pos, err)
+			}
+		})
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	conf := selectorTestConfig()
+
+	if got := repoNames(conf.FindAll("fun", "nothing", "sync", "notes")); !slices.Equal(got, []string{"fun", "dotfiles", "notes"}) {
+		t.Errorf("unexpected repositories %v", got)
+	}
+
+	if got := conf.FindAll(); len(got) != 0 {
+		t.Errorf("expected no repositories, got %v", repoNames(got))
+	}
+}
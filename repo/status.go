@@ -0,0 +1,274 @@
+package repo
+
+import (
+	"bufio"
+	"container/heap"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/tychoish/sardis/util"
+)
+
+// Status is a point-in-time summary of the state of a repository's
+// checkout, as compared to the remote branch it tracks.
+type Status struct {
+	Name       string    `bson:"name" json:"name" yaml:"name"`
+	Path       string    `bson:"path" json:"path" yaml:"path"`
+	Branch     string    `bson:"branch" json:"branch" yaml:"branch"`
+	Tracking   string    `bson:"tracking" json:"tracking" yaml:"tracking"`
+	Ahead      int       `bson:"ahead" json:"ahead" yaml:"ahead"`
+	Behind     int       `bson:"behind" json:"behind" yaml:"behind"`
+	Dirty      int       `bson:"dirty" json:"dirty" yaml:"dirty"`
+	Untracked  int       `bson:"untracked" json:"untracked" yaml:"untracked"`
+	Stashes    int       `bson:"stashes" json:"stashes" yaml:"stashes"`
+	LastCommit time.Time `bson:"last_commit" json:"last_commit" yaml:"last_commit"`
+	Missing    bool      `bson:"missing" json:"missing" yaml:"missing"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func (s *Status) IsDirty() bool  { return s.Dirty > 0 || s.Untracked > 0 }
+func (s *Status) IsBehind() bool { return s.Behind > 0 }
+func (s *Status) IsAhead() bool  { return s.Ahead > 0 }
+
+func (s *Status) LastCommitAge() time.Duration {
+	if s.LastCommit.IsZero() {
+		return 0
+	}
+	return time.Since(s.LastCommit)
+}
+
+// Status collects the state of the repository using go-git. Missing
+// checkouts are not an error, but are reported in the Missing field.
+func (conf *GitRepository) Status() (*Status, error) {
+	out := &Status{
+		Name:     conf.Name,
+		Path:     conf.Path,
+		Tracking: plumbing.NewRemoteReferenceName(conf.RemoteName, conf.Branch).Short(),
+	}
+
+	if !util.FileExists(conf.Path) {
+		out.Missing = true
+		return out, nil
+	}
+
+	repo, err := openRepo(conf.Path)
+	if err != nil {
+		return out, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return out, err
+	}
+
+	if head.Name().IsBranch() {
+		out.Branch = head.Name().Short()
+	} else {
+		out.Branch = plumbing.HEAD.String()
+	}
+
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return out, err
+	}
+	out.LastCommit = headCommit.Committer.When
+
+	remote, err := repo.Reference(plumbing.NewRemoteReferenceName(conf.RemoteName, conf.Branch), true)
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		out.Tracking = ""
+	case err != nil:
+		return out, err
+	case remote.Hash() != head.Hash():
+		remoteCommit, err := repo.CommitObject(remote.Hash())
+		if err != nil {
+			return out, err
+		}
+
+		if out.Ahead, out.Behind, err = countDivergence(headCommit, remoteCommit); err != nil {
+			return out, err
+		}
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return out, err
+	}
+
+	stat, err := wt.Status()
+	if err != nil {
+		return out, err
+	}
+
+	for _, fs := range stat {
+		switch {
+		case fs.Worktree == git.Untracked:
+			out.Untracked++
+		case fs.Worktree != git.Unmodified || fs.Staging != git.Unmodified:
+			out.Dirty++
+		}
+	}
+
+	if out.Stashes, err = conf.countStashes(); err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
+
+// countDivergence returns the number of commits reachable from local
+// and not from remote (ahead) and the number reachable from remote
+// and not from local (behind), as in git rev-list --count.
+func countDivergence(local, remote *object.Commit) (ahead int, behind int, err error) {
+	if ahead, err = countCommits(local, remote); err != nil {
+		return 0, 0, err
+	}
+
+	if behind, err = countCommits(remote, local); err != nil {
+		return 0, 0, err
+	}
+
+	return ahead, behind, nil
+}
+
+// mergeBases returns the hashes of the best common ancestors of the
+// commits, as in git merge-base.
+func mergeBases(a, b *object.Commit) ([]plumbing.Hash, error) {
+	bases, err := a.MergeBase(b)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]plumbing.Hash, 0, len(bases))
+	for _, c := range bases {
+		out = append(out, c.Hash)
+	}
+	return out, nil
+}
+
+// walkSince calls fn, newest first, for every commit reachable from
+// head and not from any of the excluded commits, as in git rev-list
+// head ^excluded. Both sides are walked together in commit date
+// order, marking the ancestors of the excluded commits, and the walk
+// stops once only excluded commits remain, so it does not visit the
+// shared history even when merges reach it by other paths. As in git,
+// commits with committer dates far older than their children may be
+// reported.
+func walkSince(head *object.Commit, excluded []*object.Commit, fn func(*object.Commit) error) error {
+	seen := map[plumbing.Hash]bool{}
+	queued := map[plumbing.Hash]bool{}
+	uninteresting := map[plumbing.Hash]bool{}
+	queue := &commitQueue{}
+
+	// commits that turn out to be excluded after they were walked
+	// are walked again, to mark their ancestors.
+	push := func(c *object.Commit, exclude bool) {
+		switch {
+		case exclude && uninteresting[c.Hash]:
+			return
+		case exclude:
+			uninteresting[c.Hash] = true
+			if queued[c.Hash] {
+				return
+			}
+		case seen[c.Hash]:
+			return
+		}
+		seen[c.Hash] = true
+		queued[c.Hash] = true
+		heap.Push(queue, c)
+	}
+
+	for _, c := range excluded {
+		push(c, true)
+	}
+	push(head, false)
+
+	var found []*object.Commit
+	for queue.Len() > 0 && slices.ContainsFunc(*queue, func(c *object.Commit) bool { return !uninteresting[c.Hash] }) {
+		c := heap.Pop(queue).(*object.Commit)
+		queued[c.Hash] = false
+		exclude := uninteresting[c.Hash]
+		if !exclude {
+			found = append(found, c)
+		}
+
+		if err := c.Parents().ForEach(func(parent *object.Commit) error {
+			push(parent, exclude)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range found {
+		if uninteresting[c.Hash] {
+			continue
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// commitQueue is a heap of commits, newest committer date first.
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int           { return len(q) }
+func (q commitQueue) Less(i, j int) bool { return q[i].Committer.When.After(q[j].Committer.When) }
+func (q commitQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)        { *q = append(*q, x.(*object.Commit)) }
+func (q *commitQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+func countCommits(head, excluded *object.Commit) (count int, err error) {
+	err = walkSince(head, []*object.Commit{excluded}, func(*object.Commit) error { count++; return nil })
+	return count, err
+}
+
+// isMerged reports if the commit is an ancestor of (or the same as)
+// the target commit.
+func isMerged(commit, target *object.Commit) (bool, error) {
+	bases, err := mergeBases(commit, target)
+	if err != nil {
+		return false, err
+	}
+	return len(bases) == 1 && bases[0] == commit.Hash, nil
+}
+
+// go-git does not read reflogs, so the stash count comes from the
+// number of entries in the stash reflog directly. Linked worktrees
+// share the stash of the main checkout, and report none of their own.
+func (conf *GitRepository) countStashes() (int, error) {
+	if stat, err := os.Stat(filepath.Join(conf.Path, ".git")); err == nil && !stat.IsDir() {
+		return 0, nil
+	}
+
+	file, err := os.Open(filepath.Join(conf.Path, ".git", "logs", "refs", "stash"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer util.DropErrorOnDefer(file.Close)
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		count++
+	}
+
+	return count, scanner.Err()
+}
@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+type testHistory struct {
+	t     *testing.T
+	st    *memory.Storage
+	clock time.Time
+}
+
+func newTestHistory(t *testing.T) *testHistory {
+	return &testHistory{t: t, st: memory.NewStorage(), clock: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (h *testHistory) commit(msg string, parents ...*object.Commit) *object.Commit {
+	h.t.Helper()
+	h.clock = h.clock.Add(time.Minute)
+	sig := object.Signature{Name: "test", Email: "test@example.com", When: h.clock}
+
+	c := &object.Commit{Author: sig, Committer: sig, Message: msg}
+	for _, p := range parents {
+		c.ParentHashes = append(c.ParentHashes, p.Hash)
+	}
+
+	obj := h.st.NewEncodedObject()
+	if err := c.Encode(obj); err != nil {
+		h.t.Fatal(err)
+	}
+	hash, err := h.st.SetEncodedObject(obj)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	out, err := object.GetCommit(h.st, hash)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return out
+}
+
+func (h *testHistory) chain(n int, from *object.Commit) *object.Commit {
+	for range n {
+		from = h.commit("chain", from)
+	}
+	return from
+}
+
+func TestCountDivergence(t *testing.T) {
+	t.Run("Linear", func(t *testing.T) {
+		h := newTestHistory(t)
+		base := h.chain(10, h.commit("root"))
+		local := h.chain(2, base)
+		remote := h.chain(3, base)
+
+		ahead, behind, err := countDivergence(local, remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ahead != 2 || behind != 3 {
+			t.Errorf("ahead %d, behind %d; want 2 and 3", ahead, behind)
+		}
+	})
+	t.Run("MergeOfOldHistory", func(t *testing.T) {
+		// a topic branch from early in the history, merged into
+		// the local branch: the merge reaches the old history
+		// through the topic without passing the base.
+		h := newTestHistory(t)
+		root := h.commit("root")
+		early := h.chain(2, root)
+		base := h.chain(20, early)
+		topic := h.commit("topic", early)
+		local := h.commit("merge", base, topic)
+		remote := h.chain(1, base)
+
+		ahead, behind, err := countDivergence(local, remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ahead != 2 || behind != 1 {
+			t.Errorf("ahead %d, behind %d; want 2 and 1", ahead, behind)
+		}
+	})
+	t.Run("MergedRemote", func(t *testing.T) {
+		h := newTestHistory(t)
+		base := h.chain(5, h.commit("root"))
+		remote := h.chain(3, base)
+		local := h.commit("merge", h.chain(1, base), remote)
+
+		ahead, behind, err := countDivergence(local, remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ahead != 2 || behind != 0 {
+			t.Errorf("ahead %d, behind %d; want 2 and 0", ahead, behind)
+		}
+	})
+}
+
+func TestWalkSince(t *testing.T) {
+	h := newTestHistory(t)
+	root := h.commit("root")
+	early := h.chain(3, root)
+	base := h.chain(50, early)
+	topic := h.commit("topic", early)
+	head := h.commit("merge", base, topic)
+
+	var walked []plumbing.Hash
+	if err := walkSince(head, []*object.Commit{base}, func(c *object.Commit) error {
+		walked = append(walked, c.Hash)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(walked) != 2 || walked[0] != head.Hash || walked[1] != topic.Hash {
+		t.Errorf("walked %v, want the merge and the topic commit", walked)
+	}
+}
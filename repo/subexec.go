@@ -1,10 +1,10 @@
 package repo
 
 import (
+	"slices"
+
 	"github.com/tychoish/fun/fnx"
-	"github.com/tychoish/fun/irt"
 	"github.com/tychoish/fun/stw"
-	"github.com/tychoish/fun/wpa"
 	"github.com/tychoish/sardis/subexec"
 )
 
@@ -33,18 +33,20 @@ func (conf *Configuration) ConcreteTaskGroups() stw.Slice[subexec.Group] {
 		}
 
 		pull.Commands = append(pull.Commands, subexec.Command{
-			Name:             repo.Name,
-			WorkerDefinition: repo.FetchJob(),
-			Notify:           stw.Ptr(repo.Notify),
-			SortHint:         -4,
+			Name:              repo.Name,
+			WorkerDefinition:  repo.FetchJob(),
+			WorkerDescription: repo.describe("fetch", nil),
+			Notify:            stw.Ptr(repo.Notify),
+			SortHint:          -4,
 		})
 
 		if repo.LocalSync {
 			update.Commands = append(update.Commands, subexec.Command{
-				Name:             repo.Name,
-				WorkerDefinition: repo.UpdateJob(),
-				Notify:           stw.Ptr(repo.Notify),
-				SortHint:         16,
+				Name:              repo.Name,
+				WorkerDefinition:  repo.UpdateJob(),
+				WorkerDescription: repo.describe("update", nil),
+				Notify:            stw.Ptr(repo.Notify),
+				SortHint:          16,
 			})
 		}
 
@@ -84,59 +86,47 @@ func (conf *Configuration) SyntheticTaskGroups() stw.Slice[subexec.Group] {
 
 	conf.rebuildIndexes()
 
+	batches := map[string]stw.Slice[GitRepository]{}
 	for tag, repos := range conf.caches.tags {
-		var anyActive bool
-		for _, rn := range repos {
-			r, ok := conf.caches.lookup[rn]
-			if !ok || r.Disabled || (!r.Fetch && !r.LocalSync) {
-				continue
+		batch := stw.Slice[GitRepository]{}
+		for _, name := range repos {
+			if repo, ok := conf.caches.lookup[name]; ok {
+				batch.Push(repo)
 			}
-			anyActive = true
-			break
 		}
-		if !anyActive {
+		batches[tag] = batch
+	}
+
+	for name, expr := range conf.Selectors {
+		batch, err := conf.Select(expr)
+		if err != nil {
+			// invalid selectors are reported during validation
 			continue
 		}
+		batches[name] = batch
+	}
 
-		batch := stw.Slice[GitRepository]{}
-
-		for _, name := range repos {
-			repo, ok := conf.caches.lookup[name]
-			if !ok {
-				continue
-			}
-
-			batch.Push(repo)
+	for tag, batch := range batches {
+		if !slices.ContainsFunc(batch, func(r GitRepository) bool { return !r.Disabled && (r.Fetch || r.LocalSync) }) {
+			continue
 		}
 
 		pull.Commands = append(pull.Commands, subexec.Command{
 			Name:     tag,
 			SortHint: -4,
-			WorkerDefinition: wpa.RunWithPool(
-				irt.Convert(
-					irt.Slice(batch),
-					func(r GitRepository) fnx.Worker {
-						return r.FetchJob()
-					},
-				),
-				wpa.WorkerGroupConfContinueOnError(),
-				wpa.WorkerGroupConfWorkerPerCPU(),
-			),
+			WorkerDefinition: withDigest(BatchJob(batch, func(r GitRepository) fnx.Worker {
+				return r.FetchJob()
+			})),
+			WorkerDescription: describeBatch("fetch", batch),
 		})
 
 		update.Commands = append(update.Commands, subexec.Command{
 			Name:     tag,
 			SortHint: 8,
-			WorkerDefinition: wpa.RunWithPool(
-				irt.Convert(
-					irt.Slice(batch),
-					func(r GitRepository) fnx.Worker {
-						return r.UpdateJob()
-					},
-				),
-				wpa.WorkerGroupConfContinueOnError(),
-				wpa.WorkerGroupConfWorkerPerCPU(),
-			),
+			WorkerDefinition: withDigest(BatchJob(batch, func(r GitRepository) fnx.Worker {
+				return r.UpdateJob()
+			})),
+			WorkerDescription: describeBatch("update", batch),
 		})
 	}
 
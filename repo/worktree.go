@@ -0,0 +1,339 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/level"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/util"
+)
+
+// DefaultWorktreeLayout is the path template used to place new
+// worktrees when the configuration does not specify one.
+const DefaultWorktreeLayout = "{{path}}.worktrees/{{branch}}"
+
+// Worktree is a linked git worktree of a configured repository.
+type Worktree struct {
+	Repo     string `bson:"repo" json:"repo" yaml:"repo"`
+	Path     string `bson:"path" json:"path" yaml:"path"`
+	Branch   string `bson:"branch" json:"branch" yaml:"branch"`
+	Head     string `bson:"head" json:"head" yaml:"head"`
+	Dirty    bool   `bson:"dirty" json:"dirty" yaml:"dirty"`
+	Locked   bool   `bson:"locked" json:"locked" yaml:"locked"`
+	Prunable bool   `bson:"prunable" json:"prunable" yaml:"prunable"`
+	Error    string `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Detached reports if the worktree does not have a branch checked
+// out.
+func (wt *Worktree) Detached() bool { return wt.Branch == "" }
+
+// Name is the identifier for the worktree in commands and reports:
+// the repository name and the branch, separated by an @.
+func (wt *Worktree) Name() string {
+	return fmt.Sprintf("%s@%s", wt.Repo, util.Default(wt.Branch, shortRef(wt.Head)))
+}
+
+// WorktreeResult is the outcome of pruning a single worktree.
+type WorktreeResult struct {
+	Worktree
+	Reason  string `bson:"reason" json:"reason" yaml:"reason"`
+	Skipped bool   `bson:"skipped" json:"skipped" yaml:"skipped"`
+	Removed bool   `bson:"removed" json:"removed" yaml:"removed"`
+}
+
+// openRepo opens a checkout or a linked worktree; the objects and
+// refs for linked worktrees live in the main repository.
+func openRepo(path string) (*git.Repository, error) {
+	return git.PlainOpenWithOptions(path, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+}
+
+// WorktreePath renders the path for a worktree of the branch from the
+// layout template. Layouts may use the {{name}}, {{path}}, and
+// {{branch}} placeholders; slashes in branch names become dashes.
+func (conf *GitRepository) WorktreePath(layout, branch string) string {
+	layout = util.Default(layout, DefaultWorktreeLayout)
+	layout = strings.ReplaceAll(layout, "{{name}}", conf.Name)
+	layout = strings.ReplaceAll(layout, "{{path}}", conf.Path)
+	layout = strings.ReplaceAll(layout, "{{branch}}", strings.ReplaceAll(branch, "/", "-"))
+	return filepath.Clean(util.TryExpandHomeDir(layout))
+}
+
+// Worktrees returns the linked worktrees of the repository, read from
+// git's administrative files rather than by running git.
+func (conf *GitRepository) Worktrees() ([]Worktree, error) {
+	admin := filepath.Join(conf.Path, ".git", "worktrees")
+	entries, err := os.ReadDir(admin)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	out := make([]Worktree, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(admin, entry.Name())
+
+		gitdir, err := os.ReadFile(filepath.Join(dir, "gitdir"))
+		if err != nil {
+			return nil, err
+		}
+		head, err := os.ReadFile(filepath.Join(dir, "HEAD"))
+		if err != nil {
+			return nil, err
+		}
+
+		wt := Worktree{
+			Repo:   conf.Name,
+			Path:   filepath.Dir(strings.TrimSpace(string(gitdir))),
+			Locked: util.FileExists(filepath.Join(dir, "locked")),
+		}
+
+		if ref, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: "); ok {
+			wt.Branch = plumbing.ReferenceName(ref).Short()
+			wt.Head = conf.resolveRef(ref)
+		} else {
+			wt.Head = strings.TrimSpace(string(head))
+		}
+
+		if !util.FileExists(wt.Path) {
+			wt.Prunable = true
+		} else if wt.Dirty, err = worktreeIsDirty(wt.Path); err != nil {
+			wt.Error = err.Error()
+		}
+
+		out = append(out, wt)
+	}
+
+	return out, nil
+}
+
+func (conf *GitRepository) resolveRef(name string) string {
+	repo, err := git.PlainOpen(conf.Path)
+	if err != nil {
+		return ""
+	}
+	ref, err := repo.Reference(plumbing.ReferenceName(name), true)
+	if err != nil {
+		return ""
+	}
+	return ref.Hash().String()
+}
+
+func worktreeIsDirty(path string) (bool, error) {
+	repo, err := openRepo(path)
+	if err != nil {
+		return false, err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	stat, err := wt.Status()
+	if err != nil {
+		return false, err
+	}
+	return !stat.IsClean(), nil
+}
+
+// WorktreeRepository returns a copy of the repository definition that
+// refers to the worktree, for use with status reporting and jobs.
+func (conf *GitRepository) WorktreeRepository(wt Worktree) GitRepository {
+	out := *conf
+	out.Name = wt.Name()
+	out.Path = wt.Path
+	out.Branch = util.Default(wt.Branch, conf.Branch)
+	out.Pre = nil
+	out.Post = nil
+	out.Mirrors = nil
+	return out
+}
+
+// AddWorktree creates a worktree for the branch at the path given by
+// the layout. When the branch does not exist yet, it is created from
+// base, which defaults to the repository's remote branch.
+func (conf *GitRepository) AddWorktree(ctx context.Context, layout, branch, base string) (*Worktree, error) {
+	if branch == "" {
+		return nil, errors.New("worktrees must have a branch")
+	}
+
+	path := conf.WorktreePath(layout, branch)
+	if util.FileExists(path) {
+		return nil, fmt.Errorf("worktree path %q for %s already exists", path, branch)
+	}
+
+	args := []string{"git", "worktree", "add"}
+	if conf.resolveRef(plumbing.NewBranchReferenceName(branch).String()) != "" {
+		args = append(args, path, branch)
+	} else {
+		base = util.Default(base, fmt.Sprintf("%s/%s", conf.RemoteName, conf.Branch))
+		args = append(args, "-b", branch, path, base)
+	}
+
+	if err := conf.worktreeCommand(ctx, args...); err != nil {
+		return nil, err
+	}
+
+	grip.Info(message.NewKV().
+		KV("op", "repo-worktree").
+		KV("state", "ADDED").
+		KV("repo", conf.Name).
+		KV("branch", branch).
+		KV("path", path))
+
+	return &Worktree{Repo: conf.Name, Path: path, Branch: branch, Head: conf.resolveRef(plumbing.NewBranchReferenceName(branch).String())}, nil
+}
+
+// PruneWorktrees removes worktrees whose branches have been deleted or
+// merged into the repository's branch, and cleans up the
+// administrative files of worktrees that no longer exist on disk.
+// Dirty, locked, and detached worktrees are never removed, nor are
+// worktrees whose branches have no commits of their own yet: a
+// branch that points at the tip of the local or remote branch was
+// just created, not merged. Worktrees whose branches were deleted
+// may hold the only copy of their commits, so like dirty worktrees
+// they are reported and skipped, unless force is set. With dryRun,
+// the worktrees are reported but not removed.
+func (conf *GitRepository) PruneWorktrees(ctx context.Context, dryRun, force bool) ([]WorktreeResult, error) {
+	worktrees, err := conf.Worktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := git.PlainOpen(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *object.Commit
+	if ref, err := repo.Reference(plumbing.NewBranchReferenceName(conf.Branch), true); err == nil {
+		if target, err = repo.CommitObject(ref.Hash()); err != nil {
+			return nil, err
+		}
+	}
+
+	tips := map[string]bool{}
+	if target != nil {
+		tips[target.Hash.String()] = true
+	}
+	if ref, err := repo.Reference(plumbing.NewRemoteReferenceName(conf.RemoteName, conf.Branch), true); err == nil {
+		tips[ref.Hash().String()] = true
+	}
+
+	merged := func(head string) bool {
+		if target == nil || tips[head] {
+			return false
+		}
+		commit, err := repo.CommitObject(plumbing.NewHash(head))
+		if err != nil {
+			return false
+		}
+		ok, err := isMerged(commit, target)
+		return err == nil && ok
+	}
+
+	var out []WorktreeResult
+	for _, wt := range worktrees {
+		res := WorktreeResult{Worktree: wt}
+		switch {
+		case wt.Prunable:
+			res.Reason = "missing"
+		case wt.Detached() || wt.Locked:
+			continue
+		case wt.Branch == conf.Branch:
+			continue
+		case wt.Head == "":
+			res.Reason = "branch deleted"
+		case merged(wt.Head):
+			res.Reason = fmt.Sprintf("merged into %s", conf.Branch)
+		default:
+			continue
+		}
+
+		switch {
+		case wt.Dirty || wt.Error != "":
+			res.Reason = fmt.Sprintf("%s, but has local changes", res.Reason)
+			res.Skipped = true
+		case wt.Head == "" && !wt.Prunable && !force:
+			res.Reason = fmt.Sprintf("%s, but its commits may not be merged", res.Reason)
+			res.Skipped = true
+		}
+		if res.Skipped {
+			out = append(out, res)
+			continue
+		}
+
+		if !dryRun {
+			if wt.Prunable {
+				err = conf.worktreeCommand(ctx, "git", "worktree", "prune")
+			} else {
+				err = conf.worktreeCommand(ctx, "git", "worktree", "remove", wt.Path)
+			}
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Removed = true
+			}
+		}
+
+		out = append(out, res)
+	}
+
+	return out, nil
+}
+
+func (conf *GitRepository) worktreeCommand(ctx context.Context, args ...string) error {
+	buf := &bytes.Buffer{}
+	err := jasper.Context(ctx).
+		CreateCommand(ctx).
+		ID(fmt.Sprintf("worktree.REPO(%s)", conf.Name)).
+		Priority(level.Debug).
+		Directory(conf.Path).
+		SetCombinedWriter(util.NopWriteCloser(buf)).
+		AppendArgs(args...).
+		Run(ctx)
+	if err != nil {
+		return fmt.Errorf("%s for %q: %w: %s", strings.Join(args, " "), conf.Name, err, strings.TrimSpace(buf.String()))
+	}
+	return nil
+}
+
+// ResolveDirectory resolves references to repositories in command
+// directories: "repo:<name>" is the checkout of the repository and
+// "repo:<name>@<branch>" is the path of the worktree for the branch.
+// Other directories are returned unchanged.
+func (conf *Configuration) ResolveDirectory(dir string) (string, error) {
+	spec, ok := strings.CutPrefix(dir, "repo:")
+	if !ok {
+		return dir, nil
+	}
+
+	name, branch, isWorktree := strings.Cut(spec, "@")
+
+	if err := conf.rebuildIndexes(); err != nil {
+		return "", err
+	}
+	rp, ok := conf.caches.lookup.Load(name)
+	if !ok {
+		return "", fmt.Errorf("directory %q refers to unknown repository %q", dir, name)
+	}
+
+	if !isWorktree {
+		return rp.Path, nil
+	}
+	return rp.WorktreePath(conf.WorktreeLayout, branch), nil
+}
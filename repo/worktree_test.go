@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPruneWorktreesDeletedBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	rc := GitRepository{Name: "notes", Path: filepath.Join(dir, "notes"), RemoteName: "origin", Branch: "main"}
+	wtPath := filepath.Join(dir, "notes.worktrees", "topic")
+
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", rc.Path}, args...)...)
+		cmd.Env = append(cmd.Environ(), "GIT_AUTHOR_NAME=sardis", "GIT_AUTHOR_EMAIL=sardis@example.com",
+			"GIT_COMMITTER_NAME=sardis", "GIT_COMMITTER_EMAIL=sardis@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	if out, err := exec.Command("git", "init", "--quiet", "--initial-branch", "main", rc.Path).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	git("commit", "--quiet", "--allow-empty", "-m", "initial")
+	git("worktree", "add", "--quiet", "-b", "topic", wtPath)
+	git("-C", wtPath, "commit", "--quiet", "--allow-empty", "-m", "unmerged")
+	git("update-ref", "-d", "refs/heads/topic")
+
+	for _, force := range []bool{false, true} {
+		results, err := rc.PruneWorktrees(t.Context(), true, force)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("expected one worktree, got %+v", results)
+		}
+
+		res := results[0]
+		if res.Path != wtPath || res.Removed || res.Skipped == force {
+			t.Errorf("force=%t: unexpected result %+v", force, res)
+		}
+	}
+}
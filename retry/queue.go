@@ -0,0 +1,274 @@
+// package retry is an on-disk queue of network operations (repository
+// fetches, clones, and syncs) that failed because the network was
+// unavailable, so that they can be retried once connectivity returns.
+package retry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/sardis/global"
+	"github.com/tychoish/sardis/util"
+)
+
+const (
+	// MaxAttempts is the number of times an item is retried before it
+	// is marked as failed.
+	MaxAttempts = 12
+	// BaseBackoff is the delay before the first retry; every later
+	// retry waits twice as long as the one before, up to MaxBackoff.
+	BaseBackoff = time.Minute
+	MaxBackoff  = 6 * time.Hour
+)
+
+type State string
+
+const (
+	StatePending State = "pending"
+	StateFailed  State = "failed"
+)
+
+type Item struct {
+	ID            string    `bson:"id" json:"id" yaml:"id"`
+	Op            string    `bson:"op" json:"op" yaml:"op"`
+	Target        string    `bson:"target" json:"target" yaml:"target"`
+	Host          string    `bson:"host,omitempty" json:"host,omitempty" yaml:"host,omitempty"`
+	State         State     `bson:"state" json:"state" yaml:"state"`
+	Attempts      int       `bson:"attempts" json:"attempts" yaml:"attempts"`
+	Error         string    `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+	DeferredAt    time.Time `bson:"deferred_at" json:"deferred_at" yaml:"deferred_at"`
+	LastAttemptAt time.Time `bson:"last_attempt_at" json:"last_attempt_at" yaml:"last_attempt_at"`
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at" yaml:"next_attempt_at"`
+}
+
+// NewItem constructs a pending item for an operation that failed
+// because the network was unavailable.
+func NewItem(op, target, host string, err error) Item {
+	now := time.Now()
+	item := Item{
+		ID:            strings.ToLower(rand.Text())[:7],
+		Op:            op,
+		Target:        target,
+		Host:          host,
+		State:         StatePending,
+		DeferredAt:    now,
+		LastAttemptAt: now,
+		NextAttemptAt: now.Add(Backoff(0)),
+	}
+	if err != nil {
+		item.Error = err.Error()
+	}
+	return item
+}
+
+// Key identifies the operation: the queue holds at most one item for
+// each key.
+func (it *Item) Key() string { return util.DotJoin(it.Op, it.Target, it.Host) }
+
+// Due reports if a pending item should be retried.
+func (it *Item) Due(now time.Time) bool {
+	return it.State == StatePending && !it.NextAttemptAt.After(now)
+}
+
+// Retry records another attempt that failed because the network was
+// unavailable, and either schedules the next attempt or, after
+// MaxAttempts, marks the item as failed.
+func (it *Item) Retry(err error) {
+	it.Attempts++
+	it.LastAttemptAt = time.Now()
+	it.NextAttemptAt = it.LastAttemptAt.Add(Backoff(it.Attempts))
+	if err != nil {
+		it.Error = err.Error()
+	}
+	if it.Attempts >= MaxAttempts {
+		it.State = StateFailed
+	}
+}
+
+// Fail marks the item as failed, for errors that retrying will not
+// resolve.
+func (it *Item) Fail(err error) {
+	it.Attempts++
+	it.LastAttemptAt = time.Now()
+	it.State = StateFailed
+	if err != nil {
+		it.Error = err.Error()
+	}
+}
+
+// Backoff returns the delay before the next attempt, after the given
+// number of attempts.
+func Backoff(attempts int) time.Duration {
+	dur := BaseBackoff
+	for range attempts {
+		if dur *= 2; dur >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	return dur
+}
+
+type Queue struct {
+	path string
+	mtx  sync.Mutex
+}
+
+func NewQueue(path string) *Queue { return &Queue{path: path} }
+
+// DefaultPath returns the location of the queue file inside of the
+// XDG state directory.
+func DefaultPath() string {
+	return filepath.Join(util.GetStateDir(global.ApplicationName), "retry.json")
+}
+
+func (q *Queue) Path() string { return q.path }
+
+// Read returns all items, ordered by their next attempt. A missing
+// queue file is not an error.
+func (q *Queue) Read() ([]Item, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.read()
+}
+
+// Push adds an item to the queue. If there is already an item for the
+// same operation, that item is retried (and revived, if it had
+// failed) rather than adding a second one.
+func (q *Queue) Push(item Item) error {
+	return q.Update(func(items []Item) []Item {
+		idx := slices.IndexFunc(items, func(it Item) bool { return it.Key() == item.Key() })
+		if idx < 0 {
+			return append(items, item)
+		}
+
+		if items[idx].State == StateFailed {
+			items[idx].State = StatePending
+			items[idx].Attempts = 0
+		}
+		items[idx].Retry(nil)
+		items[idx].Error = item.Error
+		return items
+	})
+}
+
+// Update replaces the contents of the queue with the output of the
+// function, which receives the current items. Updates hold an flock
+// on a file next to the queue, so that processes that share the queue
+// (e.g. the daemon and commands) do not lose each other's changes.
+func (q *Queue) Update(fn func([]Item) []Item) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	release, err := q.lock()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	items, err := q.read()
+	if err != nil {
+		return err
+	}
+
+	return q.write(fn(items))
+}
+
+func (q *Queue) lock() (release func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(q.path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		util.DropErrorOnDefer(file.Close)
+		return nil, err
+	}
+
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		util.DropErrorOnDefer(file.Close)
+	}, nil
+}
+
+func (q *Queue) read() ([]Item, error) {
+	payload, err := os.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var out []Item
+	if err := json.Unmarshal(payload, &out); err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(out, func(a, b Item) int { return a.NextAttemptAt.Compare(b.NextAttemptAt) })
+	return out, nil
+}
+
+func (q *Queue) write(items []Item) error {
+	payload, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, payload, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, q.path)
+}
+
+type ctxKey struct{}
+
+func WithQueue(ctx context.Context, q *Queue) context.Context {
+	return context.WithValue(ctx, ctxKey{}, q)
+}
+
+// Context returns the queue attached to the context, or nil.
+func Context(ctx context.Context) *Queue {
+	q, _ := ctx.Value(ctxKey{}).(*Queue)
+	return q
+}
+
+// Defer adds the item to the queue in the context, and reports if it
+// was queued. Without a queue this is a noop, and errors are logged
+// rather than returned, so that the queue never causes a job to fail.
+func Defer(ctx context.Context, item Item) bool {
+	q := Context(ctx)
+	if q == nil {
+		return false
+	}
+
+	err := q.Push(item)
+	grip.Warning(message.WrapError(err, message.Fields{
+		"op":     item.Op,
+		"target": item.Target,
+		"host":   item.Host,
+		"path":   q.path,
+		"msg":    "problem adding item to the retry queue",
+	}))
+
+	return err == nil
+}
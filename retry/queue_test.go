@@ -0,0 +1,87 @@
+package retry
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: BaseBackoff},
+		{attempts: 1, want: 2 * BaseBackoff},
+		{attempts: 3, want: 8 * BaseBackoff},
+		{attempts: 8, want: 256 * BaseBackoff},
+		{attempts: 9, want: MaxBackoff},
+		{attempts: MaxAttempts, want: MaxBackoff},
+	} {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestItemRetry(t *testing.T) {
+	item := NewItem("fetch", "notes", "", errors.New("offline"))
+	for range MaxAttempts - 1 {
+		item.Retry(nil)
+	}
+	if item.State != StatePending {
+		t.Fatalf("item failed after %d attempts", item.Attempts)
+	}
+
+	item.Retry(errors.New("still offline"))
+	if item.State != StateFailed {
+		t.Errorf("item is %s after %d attempts", item.State, item.Attempts)
+	}
+	if item.Error != "still offline" {
+		t.Errorf("unexpected error %q", item.Error)
+	}
+}
+
+func TestQueuePush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retry.json")
+
+	// separate queues for the same file stand in for separate
+	// processes: every push must survive.
+	wg := &sync.WaitGroup{}
+	for _, target := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := NewQueue(path).Push(NewItem("fetch", target, "", nil)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	q := NewQueue(path)
+	items, err := q.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 8 {
+		t.Fatalf("queue has %d items, want 8", len(items))
+	}
+
+	if err := q.Push(NewItem("fetch", "a", "", errors.New("again"))); err != nil {
+		t.Fatal(err)
+	}
+	if items, err = q.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 8 {
+		t.Errorf("pushing the same operation added an item: %d items", len(items))
+	}
+	for _, item := range items {
+		if item.Target == "a" && (item.Attempts != 1 || item.Error != "again") {
+			t.Errorf("unexpected item %+v", item)
+		}
+	}
+}
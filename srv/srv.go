@@ -8,6 +8,8 @@ import (
 	"github.com/tychoish/fun/irt"
 	"github.com/tychoish/godmenu"
 	"github.com/tychoish/grip/x/telegram"
+	"github.com/tychoish/sardis/history"
+	"github.com/tychoish/sardis/retry"
 	"github.com/tychoish/sardis/util"
 )
 
@@ -19,7 +21,15 @@ type Configuration struct {
 	Network     Network          `bson:"network" json:"network" yaml:"network"`
 	ConfigPaths []string         `bson:"config_files" json:"config_files" yaml:"config_files"`
 	DMenuFlags  godmenu.Flags    `bson:"dmenu" json:"dmenu" yaml:"dmenu"`
-	Runtime     struct {
+	History     struct {
+		Path     string `bson:"path" json:"path" yaml:"path"`
+		Disabled bool   `bson:"disabled" json:"disabled" yaml:"disabled"`
+	} `bson:"history" json:"history" yaml:"history"`
+	RetryQueue struct {
+		Path     string `bson:"path" json:"path" yaml:"path"`
+		Disabled bool   `bson:"disabled" json:"disabled" yaml:"disabled"`
+	} `bson:"retry_queue" json:"retry_queue" yaml:"retry_queue"`
+	Runtime struct {
 		WithAnnotations     bool   `bson:"annotate" json:"annotate" yaml:"annotate"`
 		AnnotationSeparator string `bson:"annotation_separator" json:"annotation_separator" yaml:"annotation_separator"`
 	} `bson:"runtime" json:"runtime" yaml:"runtime"`
@@ -52,6 +62,12 @@ func (conf *Configuration) Join(mc *Configuration) {
 	conf.DMenuFlags.Monitor = util.Default(mc.DMenuFlags.Monitor, conf.DMenuFlags.Monitor)
 	conf.DMenuFlags.WindowID = util.Default(mc.DMenuFlags.WindowID, conf.DMenuFlags.WindowID)
 
+	conf.History.Path = util.Default(mc.History.Path, conf.History.Path)
+	conf.History.Disabled = conf.History.Disabled || mc.History.Disabled
+
+	conf.RetryQueue.Path = util.Default(mc.RetryQueue.Path, conf.RetryQueue.Path)
+	conf.RetryQueue.Disabled = conf.RetryQueue.Disabled || mc.RetryQueue.Disabled
+
 	conf.Telegram.Name = util.Default(mc.Telegram.Name, conf.Telegram.Name)
 	conf.Telegram.Target = util.Default(mc.Telegram.Target, conf.Telegram.Target)
 	conf.Telegram.Token = util.Default(mc.Telegram.Token, conf.Telegram.Token)
@@ -94,6 +110,9 @@ func (conf *Configuration) Validate() error {
 		ec.Push(conf.Telegram.Validate())
 	}
 
+	conf.History.Path = util.TryExpandHomeDir(util.Default(conf.History.Path, history.DefaultPath()))
+	conf.RetryQueue.Path = util.TryExpandHomeDir(util.Default(conf.RetryQueue.Path, retry.DefaultPath()))
+
 	for idx := range conf.ConfigPaths {
 		conf.ConfigPaths[idx] = util.TryExpandHomeDir(conf.ConfigPaths[idx])
 	}
@@ -3,6 +3,7 @@ package subexec
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -15,6 +16,7 @@ import (
 	"github.com/tychoish/grip/message"
 	"github.com/tychoish/jasper"
 	"github.com/tychoish/sardis/global"
+	"github.com/tychoish/sardis/history"
 	"github.com/tychoish/sardis/util"
 )
 
@@ -31,15 +33,41 @@ type Command struct {
 	Notify          *bool                   `bson:"notify,omitempty" json:"notify,omitempty" yaml:"notify,omitempty"`
 	Background      *bool                   `bson:"background,omitempty" json:"background,omitempty" yaml:"background,omitempty"`
 	SortHint        int                     `bson:"sort_hint,omitempty" json:"sort_hint,omitempty" yaml:"sort_hint,omitempty"`
+	Schedule        string                  `bson:"schedule,omitempty" json:"schedule,omitempty" yaml:"schedule,omitempty"`
 	Logs            Logging                 `bson:"logs" json:"logs" yaml:"logs"`
+	Params          []Param                 `bson:"params,omitempty" json:"params,omitempty" yaml:"params,omitempty"`
+	// Requires and After are the fully qualified names
+	// (category.group.name) of other commands. Required commands
+	// run (and must succeed) before the command; the command runs
+	// after the After commands only when they run as well.
+	Requires []string `bson:"requires,omitempty" json:"requires,omitempty" yaml:"requires,omitempty"`
+	After    []string `bson:"after,omitempty" json:"after,omitempty" yaml:"after,omitempty"`
+	// Timeout and Backoff are durations (e.g. "90s"). Failed
+	// commands are retried up to Retries times, waiting Backoff
+	// (doubling) between attempts; when RetryOn lists exit
+	// codes, only failures with those exit codes are retried.
+	Timeout string `bson:"timeout,omitempty" json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries *int   `bson:"retries,omitempty" json:"retries,omitempty" yaml:"retries,omitempty"`
+	Backoff string `bson:"backoff,omitempty" json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	RetryOn []int  `bson:"retry_on,omitempty" json:"retry_on,omitempty" yaml:"retry_on,omitempty"`
 	// if possible call the operation rather
 	// than execing the commands
 	WorkerDefinition fnx.Worker `bson:"-" json:"-" yaml:"-"`
-	unaliasedName    string
+	// WorkerDescription describes the operation of the
+	// WorkerDefinition, for dry runs.
+	WorkerDescription string `bson:"-" json:"-" yaml:"-"`
+	unaliasedName     string
+	fqn               string
+	// render produces the command and commands from parameter
+	// values, for commands with parameters.
+	render func(map[string]string) (string, []string, error)
 }
 
 func (conf *Command) NamePrime() string { return util.Default(conf.unaliasedName, conf.Name) }
 func (conf *Command) FQN() string {
+	if conf.fqn != "" {
+		return conf.fqn
+	}
 	return util.DotJoin(conf.GroupCategory, conf.GroupName, conf.NamePrime())
 }
 
@@ -48,79 +76,148 @@ func (conf *Command) Worker() fnx.Worker {
 		return conf.WorkerDefinition
 	}
 
+	policy, err := conf.retryPolicy()
+	if err != nil {
+		return fnx.MakeWorker(func() error { return fmt.Errorf("command %q: %w", conf.Name, err) })
+	}
+
 	hn := util.GetHostname()
-	nonce := strings.ToLower(rand.Text())[:7]
 	jobID := fmt.Sprintf("CMD(%s).HOST(%s).NUM(%d)", conf.Name, hn, 1+len(conf.Commands))
-	ec := &erc.Collector{}
 
 	return func(ctx context.Context) error {
-		proclog, buf := NewOutputBuf(fmt.Sprint(jobID, ".", nonce))
-		startAt := time.Now()
-		return jasper.Context(ctx).CreateCommand(ctx).
-			ID(jobID).
-			Directory(conf.Directory).
-			Environment(conf.Environment).
-			AddEnv(global.EnvVarSardisLogQuietStdOut, "true").
-			SetOutputSender(level.Info, buf).
-			SetErrorSender(level.Error, buf).
-			Background(stw.DerefZ(conf.Background)).
-			Append(conf.Command).
-			Append(conf.Commands...).
-			Prerequisite(func() bool {
-				msg := message.NewKV().
-					KV("op", conf.Name).
-					KV("state", "STARTED").
-					KV("host", hn).
-					KV("dir", conf.Directory).
-					KV("cmd", conf.Command)
-
-				if len(conf.Commands) > 0 {
-					msg.KV("cmds", conf.Commands)
-				}
+		for attempt := 1; ; attempt++ {
+			err := conf.attempt(ctx, jobID, hn, attempt, policy)
+			if !policy.shouldRetry(ctx, attempt, err) {
+				return err
+			}
 
-				grip.Info(msg)
-
-				return true
-			}).
-			// END jasper command definition
-			PostHook(func(err error) error {
-				ec.Push(err)
-				err = ec.Resolve()
-
-				defer util.DropErrorOnDefer(buf.Close)
-				msg := message.NewKV().
-					KV("op", conf.Name).
-					KV("state", "COMPLETED").
-					KV("dur", time.Since(startAt)).
-					KV("err", err != nil).
-					KV("host", hn).
-					KV("dir", conf.Directory).
-					KV("cmd", conf.Command)
-
-				if len(conf.Commands) > 0 {
-					msg.KV("cmds", conf.Commands)
-				}
+			delay := policy.delay(attempt)
+			grip.Notice(message.NewKV().
+				KV("op", conf.Name).
+				KV("state", "RETRYING").
+				KV("attempt", attempt).
+				KV("retries", policy.retries).
+				KV("delay", delay).
+				KV("err", err.Error()))
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return erc.Join(err, ctx.Err())
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+func (conf *Command) retryPolicy() (*retryPolicy, error) {
+	return parseRetryPolicy(conf.Timeout, conf.Retries, conf.Backoff, conf.RetryOn)
+}
+
+// attempt runs the command once. The command is killed if it runs
+// longer than the timeout, except for background commands which
+// outlive the attempt. Failures are only reported to the desktop
+// logger when the attempt is the last one.
+func (conf *Command) attempt(ctx context.Context, jobID, hn string, attempt int, policy *retryPolicy) error {
+	nonce := strings.ToLower(rand.Text())[:7]
+	proclog, buf := NewOutputBuf(fmt.Sprint(jobID, ".", nonce))
+	startAt := time.Now()
+	background := stw.DerefZ(conf.Background)
+
+	timed := policy.timeout > 0 && !background
+
+	runCtx := ctx
+	if timed {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, policy.timeout)
+		defer cancel()
+
+		// kill the process groups as soon as the timeout expires:
+		// jasper only kills the process it started, and the attempt
+		// does not complete while its children hold the output open.
+		stop := context.AfterFunc(runCtx, func() {
+			if ctx.Err() == nil {
+				killProcessGroups(ctx, nonce)
+			}
+		})
+		defer stop()
+	}
+
+	return jasper.Context(ctx).CreateCommand(runCtx).
+		ID(jobID).
+		Tag(nonce).
+		Directory(conf.Directory).
+		Environment(conf.Environment).
+		AddEnv(global.EnvVarSardisLogQuietStdOut, "true").
+		SetOutputSender(level.Info, buf).
+		SetErrorSender(level.Error, buf).
+		Background(background).
+		PreHook(processGroupPreHook(timed)).
+		Append(conf.Command).
+		Append(conf.Commands...).
+		Prerequisite(func() bool {
+			msg := message.NewKV().
+				KV("op", conf.Name).
+				KV("state", "STARTED").
+				KV("attempt", attempt).
+				KV("host", hn).
+				KV("dir", conf.Directory).
+				KV("cmd", conf.Command)
 
-				defer grip.Notice(msg)
+			if len(conf.Commands) > 0 {
+				msg.KV("cmds", conf.Commands)
+			}
 
-				desktop := grip.ContextLogger(ctx, global.ContextDesktopLogger)
-				proclog.Info(grip.MPrintln("<---------------", nonce, "---", jobID, "----"))
-				if err != nil {
-					m := message.WrapError(err, conf.Name)
-					desktop.Error(m)
-					grip.Critical(err)
+			grip.Info(msg)
 
-					grip.Error(buf.String())
+			return true
+		}).
+		// END jasper command definition
+		PostHook(func(err error) error {
+			if runCtx.Err() != nil && ctx.Err() == nil {
+				err = erc.Join(timeoutError(conf.Name, policy.timeout, attempt), err)
+			}
+
+			defer util.DropErrorOnDefer(buf.Close)
+			history.Add(ctx, history.NewRecord("command", conf.Name, nonce, startAt, err, buf.String()))
+			msg := message.NewKV().
+				KV("op", conf.Name).
+				KV("state", "COMPLETED").
+				KV("attempt", attempt).
+				KV("dur", time.Since(startAt)).
+				KV("err", err != nil).
+				KV("timeout", errors.Is(err, ErrCommandTimeout)).
+				KV("host", hn).
+				KV("dir", conf.Directory).
+				KV("cmd", conf.Command)
+
+			if len(conf.Commands) > 0 {
+				msg.KV("cmds", conf.Commands)
+			}
+
+			defer grip.Notice(msg)
+
+			desktop := grip.ContextLogger(ctx, global.ContextDesktopLogger)
+			proclog.Info(grip.MPrintln("<---------------", nonce, "---", jobID, "----"))
+			if err != nil {
+				grip.Error(buf.String())
+				if policy.shouldRetry(ctx, attempt, err) {
 					return err
-				} else if conf.Logs.Full() {
-					grip.Info(buf.String())
 				}
-				desktop.Notice(message.Whenln(stw.DerefZ(conf.Notify), conf.Name, "completed"))
-				return nil
-			}).
-			Worker().
-			PreHook(func(context.Context) {
-				proclog.Info(grip.MPrintln("----------------", nonce, "---", jobID, "--->"))
-			}).Run(ctx)
-	}
+
+				m := message.WrapError(err, conf.Name)
+				desktop.Error(m)
+				grip.Critical(err)
+				return err
+			} else if conf.Logs.Full() {
+				grip.Info(buf.String())
+			}
+			desktop.Notice(message.Whenln(stw.DerefZ(conf.Notify), conf.Name, "completed"))
+			return nil
+		}).
+		Worker().
+		PreHook(func(context.Context) {
+			proclog.Info(grip.MPrintln("----------------", nonce, "---", jobID, "--->"))
+		}).Run(runCtx)
 }
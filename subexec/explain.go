@@ -0,0 +1,102 @@
+package subexec
+
+import (
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/tychoish/fun/stw"
+	"github.com/tychoish/sardis/global"
+)
+
+// Explanation describes what running a command does, after template
+// expansion, group defaults, and environment merging, for dry runs.
+// Commands implemented by built-in operations (WorkerDefinition) have
+// a description of the operation rather than shell lines.
+type Explanation struct {
+	Name       string      `bson:"name" json:"name" yaml:"name"`
+	Layer      int         `bson:"layer" json:"layer" yaml:"layer"`
+	Directory  string      `bson:"directory,omitempty" json:"directory,omitempty" yaml:"directory,omitempty"`
+	Env        []EnvChange `bson:"env,omitempty" json:"env,omitempty" yaml:"env,omitempty"`
+	Lines      []string    `bson:"lines,omitempty" json:"lines,omitempty" yaml:"lines,omitempty"`
+	Operation  string      `bson:"operation,omitempty" json:"operation,omitempty" yaml:"operation,omitempty"`
+	Background bool        `bson:"background" json:"background" yaml:"background"`
+	Notify     bool        `bson:"notify" json:"notify" yaml:"notify"`
+	Timeout    string      `bson:"timeout,omitempty" json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries    int         `bson:"retries,omitempty" json:"retries,omitempty" yaml:"retries,omitempty"`
+	Requires   []string    `bson:"requires,omitempty" json:"requires,omitempty" yaml:"requires,omitempty"`
+}
+
+// EnvChange is an environment variable that the command sets, and
+// its value in the current environment, if any.
+type EnvChange struct {
+	Name     string `bson:"name" json:"name" yaml:"name"`
+	Value    string `bson:"value" json:"value" yaml:"value"`
+	Previous string `bson:"previous,omitempty" json:"previous,omitempty" yaml:"previous,omitempty"`
+	Defined  bool   `bson:"defined" json:"defined" yaml:"defined"`
+}
+
+// ExplainOperation describes a built-in operation that is not a
+// command, for the dry runs of operations that run jobs directly.
+func ExplainOperation(name, dir, operation string) Explanation {
+	return Explanation{Name: name, Directory: dir, Operation: operation}
+}
+
+// Explain describes the command, without running it.
+func (conf *Command) Explain() Explanation {
+	if conf.WorkerDefinition != nil {
+		return Explanation{
+			Name:      conf.Name,
+			Directory: conf.Directory,
+			Operation: conf.WorkerDescription,
+			Notify:    stw.DerefZ(conf.Notify),
+			Requires:  conf.Requires,
+		}
+	}
+
+	env := maps.Clone(conf.Environment)
+	if env == nil {
+		env = map[string]string{}
+	}
+	env[global.EnvVarSardisLogQuietStdOut] = "true"
+
+	out := Explanation{
+		Name:       conf.Name,
+		Directory:  conf.Directory,
+		Lines:      slices.DeleteFunc(append([]string{conf.Command}, conf.Commands...), func(line string) bool { return line == "" }),
+		Background: stw.DerefZ(conf.Background),
+		Notify:     stw.DerefZ(conf.Notify),
+		Timeout:    conf.Timeout,
+		Retries:    stw.DerefZ(conf.Retries),
+		Requires:   conf.Requires,
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		prev, defined := os.LookupEnv(name)
+		if defined && prev == env[name] {
+			continue
+		}
+		out.Env = append(out.Env, EnvChange{Name: name, Value: env[name], Previous: prev, Defined: defined})
+	}
+
+	return out
+}
+
+// Explain describes the commands and the commands they require, in
+// the order that RunCommands would run them, without running them.
+func (conf *Configuration) Explain(cmds stw.Slice[Command]) ([]Explanation, error) {
+	layers, err := conf.Plan(cmds)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Explanation
+	for idx, layer := range layers {
+		for _, cmd := range layer {
+			exp := cmd.Explain()
+			exp.Layer = idx
+			out = append(out, exp)
+		}
+	}
+	return out, nil
+}
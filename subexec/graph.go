@@ -0,0 +1,268 @@
+package subexec
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/fun/fnx"
+	"github.com/tychoish/fun/irt"
+	"github.com/tychoish/fun/stw"
+	"github.com/tychoish/fun/wpa"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+)
+
+const ErrPrerequisiteFailed ers.Error = "prerequisite command failed"
+
+// commandGraph indexes commands by their fully qualified name, for
+// resolving the requires and after edges between commands. Commands
+// in alias groups have the same FQN as the command in the group they
+// alias, and are only indexed once.
+type commandGraph struct {
+	commands map[string]Command
+	order    []string
+}
+
+func newCommandGraph(cmds iter.Seq[Command]) *commandGraph {
+	g := &commandGraph{commands: map[string]Command{}}
+	for cmd := range cmds {
+		fqn := cmd.FQN()
+		if _, ok := g.commands[fqn]; ok {
+			continue
+		}
+		g.commands[fqn] = cmd
+		g.order = append(g.order, fqn)
+	}
+	return g
+}
+
+func (g *commandGraph) edges(cmd *Command) []string {
+	return append(slices.Clone(cmd.Requires), cmd.After...)
+}
+
+// validate checks that the targets of every edge exist, that
+// required commands can run without parameter values, and that
+// there are no cycles.
+func (g *commandGraph) validate() error {
+	ec := &erc.Collector{}
+
+	for _, fqn := range g.order {
+		cmd := g.commands[fqn]
+		for _, target := range g.edges(&cmd) {
+			dep, ok := g.commands[target]
+			switch {
+			case !ok:
+				ec.Errorf("command %q depends on %q, which does not exist", fqn, target)
+			case target == fqn:
+				ec.Errorf("command %q cannot depend on itself", fqn)
+			case slices.Contains(cmd.Requires, target) && slices.ContainsFunc(dep.Params, func(p Param) bool { return p.Required() }):
+				ec.Errorf("command %q requires %q, which has required parameters", fqn, target)
+			}
+		}
+	}
+
+	if !ec.Ok() {
+		return ec.Resolve()
+	}
+
+	// depth first search, reporting each cycle once by the path
+	// from the first command in the cycle.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(g.commands))
+	var path []string
+	var visit func(string)
+	visit = func(fqn string) {
+		switch state[fqn] {
+		case visited:
+			return
+		case visiting:
+			start := slices.Index(path, fqn)
+			ec.Errorf("commands have a dependency cycle: %s", strings.Join(append(slices.Clone(path[start:]), fqn), " -> "))
+			return
+		}
+
+		state[fqn] = visiting
+		path = append(path, fqn)
+		cmd := g.commands[fqn]
+		for _, target := range g.edges(&cmd) {
+			visit(target)
+		}
+		path = path[:len(path)-1]
+		state[fqn] = visited
+	}
+
+	for _, fqn := range g.order {
+		if state[fqn] == unvisited {
+			visit(fqn)
+		}
+	}
+
+	return ec.Resolve()
+}
+
+// plan expands the commands to include their transitive
+// requirements, and orders them in layers: every command runs after
+// the commands it requires, and after the commands it runs after when
+// they are also in the plan. The selected commands are used as given
+// (e.g. with bound parameters), the requirements from the graph.
+func (g *commandGraph) plan(cmds []Command) ([][]Command, error) {
+	set := map[string]Command{}
+	var order []string
+
+	var add func(cmd Command) error
+	add = func(cmd Command) error {
+		fqn := cmd.FQN()
+		if _, ok := set[fqn]; ok {
+			return nil
+		}
+		set[fqn] = cmd
+		order = append(order, fqn)
+
+		for _, target := range cmd.Requires {
+			dep, ok := g.commands[target]
+			if !ok {
+				return fmt.Errorf("command %q requires %q, which is not available on this host", fqn, target)
+			}
+			if err := add(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, cmd := range cmds {
+		if err := add(cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	// Kahn's algorithm, keeping the order of selection and
+	// discovery within layers.
+	pending := make(map[string]int, len(set))
+	dependents := map[string][]string{}
+	for _, fqn := range order {
+		cmd := set[fqn]
+		for _, target := range g.edges(&cmd) {
+			if _, ok := set[target]; !ok {
+				continue
+			}
+			pending[fqn]++
+			dependents[target] = append(dependents[target], fqn)
+		}
+	}
+
+	var layers [][]Command
+	done := 0
+	current := slices.DeleteFunc(slices.Clone(order), func(fqn string) bool { return pending[fqn] > 0 })
+	for len(current) > 0 {
+		layer := make([]Command, 0, len(current))
+		var next []string
+		for _, fqn := range current {
+			layer = append(layer, set[fqn])
+			for _, dep := range dependents[fqn] {
+				if pending[dep]--; pending[dep] == 0 {
+					next = append(next, dep)
+				}
+			}
+		}
+		done += len(current)
+		layers = append(layers, layer)
+		slices.SortStableFunc(next, func(a, b string) int { return slices.Index(order, a) - slices.Index(order, b) })
+		current = next
+	}
+
+	if done != len(order) {
+		return nil, fmt.Errorf("commands %s have a dependency cycle", order)
+	}
+
+	return layers, nil
+}
+
+func (conf *Configuration) validateDependencies() error {
+	return newCommandGraph(func(yield func(Command) bool) {
+		for _, grp := range conf.Commands {
+			for _, cmd := range grp.Commands {
+				if !yield(cmd) {
+					return
+				}
+			}
+		}
+	}).validate()
+}
+
+// Plan returns the commands, and the commands they require, in the
+// order they run: the commands in each layer run in parallel after
+// the commands in the previous layers.
+func (conf *Configuration) Plan(cmds stw.Slice[Command]) ([][]Command, error) {
+	return newCommandGraph(irt.Slice(conf.ExportAllCommands())).plan(cmds)
+}
+
+// RunCommands runs the commands and their requirements in dependency
+// order. Commands whose prerequisites fail are skipped, and their
+// failures are reported as ErrPrerequisiteFailed; independent
+// commands continue to run.
+func (conf *Configuration) RunCommands(ctx context.Context, cmds stw.Slice[Command]) error {
+	layers, err := conf.Plan(cmds)
+	if err != nil {
+		return err
+	}
+
+	if len(layers) == 1 {
+		return RunCommands(ctx, layers[0])
+	}
+
+	ec := &erc.Collector{}
+	mtx := &sync.Mutex{}
+	failed := map[string]bool{}
+
+	for _, layer := range layers {
+		workers := make([]fnx.Worker, 0, len(layer))
+		for idx := range layer {
+			cmd := layer[idx]
+			fqn := cmd.FQN()
+
+			if idx := slices.IndexFunc(cmd.Requires, func(target string) bool { return failed[target] }); idx >= 0 {
+				failed[fqn] = true
+				grip.Notice(message.NewKV().
+					KV("op", "run-commands").
+					KV("state", "SKIPPED").
+					KV("command", fqn).
+					KV("prerequisite", cmd.Requires[idx]))
+				ec.Push(fmt.Errorf("%w: skipped %q because %q failed", ErrPrerequisiteFailed, fqn, cmd.Requires[idx]))
+				continue
+			}
+
+			workers = append(workers, func(ctx context.Context) error {
+				if err := cmd.Worker().Run(ctx); err != nil {
+					mtx.Lock()
+					defer mtx.Unlock()
+					failed[fqn] = true
+					return fmt.Errorf("running command %q: %w", fqn, err)
+				}
+				return nil
+			})
+		}
+
+		ec.Push(TOOLS.WorkerPool(irt.Slice(workers),
+			wpa.WorkerGroupConfNumWorkers(min(max(len(workers), 1), runtime.NumCPU())),
+			wpa.WorkerGroupConfContinueOnError(),
+		).Run(ctx))
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return ec.Resolve()
+}
@@ -0,0 +1,121 @@
+package subexec
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func graphTestCommands() []Command {
+	return []Command{
+		{fqn: "dev.build", Requires: []string{"dev.deps"}},
+		{fqn: "dev.deps"},
+		{fqn: "dev.lint", After: []string{"dev.build"}},
+		{fqn: "dev.test", Requires: []string{"dev.build"}, After: []string{"dev.lint"}},
+		{fqn: "dev.docs"},
+	}
+}
+
+func commandFQNs(layers [][]Command) [][]string {
+	out := make([][]string, 0, len(layers))
+	for _, layer := range layers {
+		names := make([]string, 0, len(layer))
+		for _, cmd := range layer {
+			names = append(names, cmd.FQN())
+		}
+		out = append(out, names)
+	}
+	return out
+}
+
+func TestGraphValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cmds []Command
+		err  string
+	}{
+		{name: "Valid", cmds: graphTestCommands()},
+		{name: "Missing", cmds: []Command{{fqn: "a", Requires: []string{"b"}}}, err: `depends on "b", which does not exist`},
+		{name: "Self", cmds: []Command{{fqn: "a", After: []string{"a"}}}, err: "cannot depend on itself"},
+		{
+			name: "RequiredParams",
+			cmds: []Command{{fqn: "a", Requires: []string{"b"}}, {fqn: "b", Params: []Param{{Name: "tag"}}}},
+			err:  "which has required parameters",
+		},
+		{
+			name: "AfterParams",
+			cmds: []Command{{fqn: "a", After: []string{"b"}}, {fqn: "b", Params: []Param{{Name: "tag"}}}},
+		},
+		{
+			name: "Cycle",
+			cmds: []Command{{fqn: "a", Requires: []string{"b"}}, {fqn: "b", After: []string{"c"}}, {fqn: "c", Requires: []string{"a"}}},
+			err:  "dependency cycle: a -> b -> c -> a",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newCommandGraph(slices.Values(tt.cmds)).validate()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatal(err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestGraphPlan(t *testing.T) {
+	graph := newCommandGraph(slices.Values(graphTestCommands()))
+
+	for _, tt := range []struct {
+		name     string
+		selected []string
+		want     [][]string
+	}{
+		{name: "Single", selected: []string{"dev.docs"}, want: [][]string{{"dev.docs"}}},
+		{name: "Requirements", selected: []string{"dev.test"}, want: [][]string{{"dev.deps"}, {"dev.build"}, {"dev.test"}}},
+		{name: "AfterWithoutTarget", selected: []string{"dev.lint"}, want: [][]string{{"dev.lint"}}},
+		{
+			name:     "AfterInPlan",
+			selected: []string{"dev.lint", "dev.test", "dev.docs"},
+			want:     [][]string{{"dev.deps", "dev.docs"}, {"dev.build"}, {"dev.lint"}, {"dev.test"}},
+		},
+		{name: "Duplicates", selected: []string{"dev.build", "dev.deps", "dev.build"}, want: [][]string{{"dev.deps"}, {"dev.build"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmds []Command
+			for _, fqn := range tt.selected {
+				cmds = append(cmds, graph.commands[fqn])
+			}
+
+			layers, err := graph.plan(cmds)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := commandFQNs(layers)
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("SelectedCommandsAsGiven", func(t *testing.T) {
+		bound := graph.commands["dev.build"]
+		bound.Command = "make build TAG=v1"
+
+		layers, err := graph.plan([]Command{bound})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := layers[len(layers)-1][0].Command; got != bound.Command {
+			t.Errorf("planned command is %q, not the bound command", got)
+		}
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		if _, err := graph.plan([]Command{{fqn: "dev.release", Requires: []string{"dev.sign"}}}); err == nil {
+			t.Error("expected an error for an unavailable requirement")
+		}
+	})
+}
@@ -32,6 +32,11 @@ type Group struct {
 	Commands       stw.Slice[Command]      `bson:"commands" json:"commands" yaml:"commands"`
 	MenuSelections []string                `bson:"menu" json:"menu" yaml:"menu"`
 	SortHint       int                     `bson:"sort_hint" json:"sort_hint" yaml:"sort_hint"`
+	Schedule       string                  `bson:"schedule" json:"schedule" yaml:"schedule"`
+	Timeout        string                  `bson:"timeout,omitempty" json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries        *int                    `bson:"retries,omitempty" json:"retries,omitempty" yaml:"retries,omitempty"`
+	Backoff        string                  `bson:"backoff,omitempty" json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	RetryOn        []int                   `bson:"retry_on,omitempty" json:"retry_on,omitempty" yaml:"retry_on,omitempty"`
 	Synthetic      bool                    `bson:"-" json:"-" yaml:"-"`
 }
 
@@ -65,7 +70,9 @@ func (cg *Group) Selectors() []string {
 	return irt.Collect(set.Iterator())
 }
 
-func (cg *Group) Validate() error {
+func (cg *Group) Validate() error { return cg.validate(newTemplateRenderer(nil, false, nil)) }
+
+func (cg *Group) validate(tmpl *templateRenderer) error {
 	home := util.GetHomeDir()
 
 	ec := &erc.Collector{}
@@ -98,10 +105,25 @@ func (cg *Group) Validate() error {
 		cmd.GroupName = cg.Name
 		cmd.Notify = util.Default(cmd.Notify, cg.Notify)
 		cmd.Background = util.Default(cmd.Background, cg.Background)
+		cmd.Schedule = util.Default(cmd.Schedule, cg.Schedule)
+		cmd.Timeout = util.Default(cmd.Timeout, cg.Timeout)
+		cmd.Retries = util.Default(cmd.Retries, cg.Retries)
+		cmd.Backoff = util.Default(cmd.Backoff, cg.Backoff)
+		if cmd.RetryOn == nil {
+			cmd.RetryOn = cg.RetryOn
+		}
 		cmd.Directory = jutil.TryExpandHomedir(util.Default(cmd.Directory, home))
 
 		ec.Whenf(cmd.Name == "", "command in group [%s](%d) must have a name", cg.Name, idx)
 		ec.Whenf(cmd.Command == "" && cmd.OverrideDefault, "cannot override default without an override, in group [%s] command [%s] at index (%d)", cg.Name, cmd.Name, idx)
+		if cmd.Schedule != "" {
+			_, err := util.ParseInterval(cmd.Schedule)
+			ec.Wrapf(err, "schedule for command in group [%s] command [%s]", cg.Name, cmd.Name)
+		}
+		{
+			_, err := cmd.retryPolicy()
+			ec.Wrapf(err, "retry policy for command in group [%s] command [%s]", cg.Name, cmd.Name)
+		}
 
 		if cg.Environment != nil || cmd.Environment != nil {
 			env := stw.Map[string, string]{}
@@ -116,32 +138,23 @@ func (cg *Group) Validate() error {
 			cmd.Environment = env
 		}
 
-		if !cmd.OverrideDefault {
-			cmd.Command = util.Default(cmd.Command, cg.Command)
-			cmd.Command = util.Default(cmd.Command, cmd.Name)
-			cmd.Command = util.Default(strings.ReplaceAll(cg.Command, "{{command}}", cmd.Command), cmd.Command)
+		for pidx := range cmd.Params {
+			ec.Wrapf(cmd.Params[pidx].Validate(), "parameter in group [%s] command [%s]", cg.Name, cmd.Name)
 		}
 
-		if cc := cmd.Command; strings.Contains(cc, "{{") && strings.Contains(cc, "}}") {
-			cmd.Command = strings.ReplaceAll(cmd.Command, "{{name}}", cmd.Name)
-			cmd.Command = strings.ReplaceAll(cmd.Command, "{{group.category}}", cg.Category)
-			cmd.Command = strings.ReplaceAll(cmd.Command, "{{group.name}}", cg.Name)
-			cmd.Command = strings.ReplaceAll(cmd.Command, "{{host}}", stw.DerefZ(cg.Host))
-			cmd.Command = strings.ReplaceAll(cmd.Command, "{{prefix}}", cg.CmdNamePrefix)
-			cmd.Command = strings.ReplaceAll(cmd.Command, "{{arg}}", cmd.Arg)
+		render := tmpl.commandRenderer(cg, &cmd)
+		if cmd.HasParams() {
+			// commands with parameters render when they're bound
+			// to values; render the defaults here to check the
+			// templates and for display.
+			cmd.render = render
+			ec.Whenf(cmd.Schedule != "" && slices.ContainsFunc(cmd.Params, func(p Param) bool { return p.Required() }),
+				"scheduled command in group [%s] command [%s] cannot have required parameters", cg.Name, cmd.Name)
 		}
 
-		for idx := range cmd.Commands {
-			if cc := cmd.Commands[idx]; strings.Contains(cc, "{{") && strings.Contains(cc, "}}") {
-				cmd.Commands[idx] = strings.ReplaceAll(cmd.Commands[idx], "{{command}}", cmd.Command)
-				cmd.Commands[idx] = strings.ReplaceAll(cmd.Commands[idx], "{{name}}", cmd.Name)
-				cmd.Commands[idx] = strings.ReplaceAll(cmd.Commands[idx], "{{host}}", stw.DerefZ(cg.Host))
-				cmd.Commands[idx] = strings.ReplaceAll(cmd.Commands[idx], "{{group.name}}", cg.Name)
-				cmd.Commands[idx] = strings.ReplaceAll(cmd.Commands[idx], "{{group.category}}", cg.Category)
-				cmd.Commands[idx] = strings.ReplaceAll(cmd.Commands[idx], "{{prefix}}", cg.Name)
-				cmd.Commands[idx] = strings.ReplaceAll(cmd.Commands[idx], "{{arg}}", cmd.Arg)
-			}
-		}
+		var err error
+		cmd.Command, cmd.Commands, err = render(cmd.defaultParams())
+		ec.Wrapf(err, "rendering group [%s] command [%s]", cg.Name, cmd.Name)
 
 		cmd.Name = util.DotJoin(cg.CmdNamePrefix, cmd.Name)
 
@@ -0,0 +1,201 @@
+package subexec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/grip/level"
+	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/util"
+)
+
+type ParamType string
+
+const (
+	ParamString ParamType = "string"
+	ParamEnum   ParamType = "enum"
+	ParamInt    ParamType = "int"
+	ParamPath   ParamType = "path"
+	ParamRepo   ParamType = "repo"
+)
+
+// Param is a named parameter of a command, available to the command's
+// templates as {{.Params.<name>}}. Values come from name=value
+// arguments, from prompts when commands run from menus, or from the
+// default. Parameters without a default are required.
+//
+// Choices are offered when prompting; enum parameters only accept one
+// of their choices. ChoicesFrom is a shell command, run in the
+// command's directory, whose output lines are the choices. Repo
+// parameters are the name of a configured repository, and offer all
+// repositories unless they specify choices.
+type Param struct {
+	Name        string    `bson:"name" json:"name" yaml:"name"`
+	Type        ParamType `bson:"type" json:"type" yaml:"type"`
+	Default     string    `bson:"default" json:"default" yaml:"default"`
+	Choices     []string  `bson:"choices" json:"choices" yaml:"choices"`
+	ChoicesFrom string    `bson:"choices_from" json:"choices_from" yaml:"choices_from"`
+	Prompt      string    `bson:"prompt" json:"prompt" yaml:"prompt"`
+}
+
+var paramNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (p *Param) Validate() error {
+	p.Type = util.Default(p.Type, ParamString)
+
+	ec := &erc.Collector{}
+	ec.Whenf(!paramNameRegex.MatchString(p.Name), "parameter name %q must be an identifier", p.Name)
+
+	switch p.Type {
+	case ParamString, ParamPath, ParamRepo:
+	case ParamEnum:
+		ec.Whenf(len(p.Choices) == 0 && p.ChoicesFrom == "", "enum parameter %q must have choices", p.Name)
+	case ParamInt:
+	default:
+		ec.Errorf("parameter %q has invalid type %q", p.Name, p.Type)
+	}
+
+	if p.Default != "" {
+		_, err := p.Parse(p.Default)
+		ec.Wrapf(err, "default for parameter %q", p.Name)
+	}
+
+	return ec.Resolve()
+}
+
+func (p *Param) Required() bool { return p.Default == "" }
+
+func (p *Param) Label() string { return util.Default(p.Prompt, p.Name) }
+
+// Parse checks the value against the type of the parameter, and
+// returns the value to render.
+func (p *Param) Parse(value string) (string, error) {
+	switch p.Type {
+	case ParamInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", fmt.Errorf("parameter %q must be an integer, not %q", p.Name, value)
+		}
+	case ParamEnum:
+		if len(p.Choices) > 0 && !slices.Contains(p.Choices, value) {
+			return "", fmt.Errorf("parameter %q must be one of %s, not %q", p.Name, p.Choices, value)
+		}
+	case ParamPath:
+		return util.TryExpandHomeDir(value), nil
+	}
+	return value, nil
+}
+
+// ListChoices returns the choices for the parameter, running the
+// choices_from command in the directory when specified.
+func (p *Param) ListChoices(ctx context.Context, dir string) ([]string, error) {
+	if p.ChoicesFrom == "" {
+		return p.Choices, nil
+	}
+
+	out := &bytes.Buffer{}
+	err := jasper.Context(ctx).
+		CreateCommand(ctx).
+		ID(util.DotJoin("choices", p.Name)).
+		Priority(level.Debug).
+		Directory(dir).
+		SetOutputWriter(util.NopWriteCloser(out)).
+		Bash(p.ChoicesFrom).
+		Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing choices for parameter %q: %w", p.Name, err)
+	}
+
+	choices := slices.Clone(p.Choices)
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !slices.Contains(choices, line) {
+			choices = append(choices, line)
+		}
+	}
+
+	return choices, scanner.Err()
+}
+
+// SplitParamArgs separates name=value arguments from the other
+// (command name) arguments.
+func SplitParamArgs(args []string) (names []string, params map[string]string) {
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || !paramNameRegex.MatchString(name) {
+			names = append(names, arg)
+			continue
+		}
+
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[name] = value
+	}
+	return names, params
+}
+
+func (conf *Command) HasParams() bool { return len(conf.Params) > 0 }
+
+// Bind returns a copy of the command with its templates rendered with
+// the values of the parameters, and the defaults of the parameters
+// without values. Values that are given but empty (name=) are used as
+// is, rather than replaced by the default. Values for parameters the
+// command does not declare are ignored.
+func (conf *Command) Bind(values map[string]string) (*Command, error) {
+	out := *conf
+	if conf.render == nil {
+		return &out, nil
+	}
+
+	params := make(map[string]string, len(conf.Params))
+	ec := &erc.Collector{}
+	for idx := range conf.Params {
+		p := &conf.Params[idx]
+
+		value, ok := values[p.Name]
+		if !ok {
+			if p.Required() {
+				ec.Errorf("command %q requires a value for parameter %q", conf.Name, p.Name)
+				continue
+			}
+			value = p.Default
+		}
+
+		parsed, err := p.Parse(value)
+		if err != nil {
+			ec.Push(err)
+			continue
+		}
+		params[p.Name] = parsed
+	}
+
+	if !ec.Ok() {
+		return nil, ec.Resolve()
+	}
+
+	var err error
+	if out.Command, out.Commands, err = conf.render(params); err != nil {
+		return nil, fmt.Errorf("rendering command %q: %w", conf.Name, err)
+	}
+
+	out.render = nil
+	return &out, nil
+}
+
+// defaultParams returns the defaults of the parameters, which are
+// used to render (and check) the templates of parameterized commands
+// during validation.
+func (conf *Command) defaultParams() map[string]string {
+	out := make(map[string]string, len(conf.Params))
+	for _, p := range conf.Params {
+		out[p.Name] = p.Default
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+package subexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tychoish/fun/erc"
+	"github.com/tychoish/fun/ers"
+	"github.com/tychoish/fun/stw"
+	"github.com/tychoish/grip"
+	"github.com/tychoish/grip/message"
+	"github.com/tychoish/jasper"
+	"github.com/tychoish/jasper/options"
+)
+
+const ErrCommandTimeout ers.Error = "command timed out"
+
+const (
+	// DefaultBackoff is the delay before the first retry of a
+	// command without a backoff; every later retry waits twice as
+	// long as the one before, up to MaxBackoff.
+	DefaultBackoff = time.Second
+	MaxBackoff     = 5 * time.Minute
+)
+
+// retryPolicy is the parsed form of the timeout, retries, backoff,
+// and retry_on settings of a command.
+type retryPolicy struct {
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	retryOn []int
+}
+
+func parseRetryPolicy(timeout string, retries *int, backoff string, retryOn []int) (*retryPolicy, error) {
+	ec := &erc.Collector{}
+	policy := &retryPolicy{
+		retries: stw.DerefZ(retries),
+		backoff: DefaultBackoff,
+		retryOn: retryOn,
+	}
+
+	if timeout != "" {
+		dur, err := time.ParseDuration(timeout)
+		ec.Wrapf(err, "invalid timeout %q", timeout)
+		ec.Whenf(err == nil && dur <= 0, "timeout %q must be positive", timeout)
+		policy.timeout = dur
+	}
+
+	if backoff != "" {
+		dur, err := time.ParseDuration(backoff)
+		ec.Wrapf(err, "invalid backoff %q", backoff)
+		ec.Whenf(err == nil && dur < 0, "backoff %q must not be negative", backoff)
+		policy.backoff = dur
+	}
+
+	ec.Whenf(policy.retries < 0, "retries (%d) must not be negative", policy.retries)
+	for _, code := range retryOn {
+		ec.Whenf(code <= 0 || code > 255, "retry_on exit code %d must be between 1 and 255", code)
+	}
+
+	if !ec.Ok() {
+		return nil, ec.Resolve()
+	}
+
+	return policy, nil
+}
+
+// delay returns the wait before the next attempt, after the given
+// (1-indexed) attempt failed.
+func (rp *retryPolicy) delay(attempt int) time.Duration {
+	dur := rp.backoff
+	for range attempt - 1 {
+		if dur *= 2; dur >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	return dur
+}
+
+// shouldRetry reports if the error of the given (1-indexed) attempt
+// should be retried. Timeouts are always retried; other failures are
+// retried if there is no retry_on filter, or if the command's exit
+// code is in the filter.
+func (rp *retryPolicy) shouldRetry(ctx context.Context, attempt int, err error) bool {
+	switch {
+	case err == nil || attempt > rp.retries || ctx.Err() != nil:
+		return false
+	case errors.Is(err, ErrCommandTimeout) || len(rp.retryOn) == 0:
+		return true
+	default:
+		code, ok := exitCode(err)
+		return ok && slices.Contains(rp.retryOn, code)
+	}
+}
+
+var exitStatusRegex = regexp.MustCompile(`exit status (\d+)`)
+
+// exitCode returns the exit code of the process that caused the
+// error, if any.
+func exitCode(err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+
+	// jasper does not always wrap the underlying error.
+	if match := exitStatusRegex.FindStringSubmatch(err.Error()); match != nil {
+		if code, err := strconv.Atoi(match[1]); err == nil {
+			return code, true
+		}
+	}
+
+	return 0, false
+}
+
+// setsidPath is the path to setsid(1), or empty when it is not
+// installed.
+var setsidPath = sync.OnceValue(func() string {
+	path, _ := exec.LookPath("setsid")
+	return path
+})
+
+// processGroupPreHook starts commands with a timeout in a new
+// session, and therefore in their own process group, so that
+// killProcessGroups can kill everything a shell script started along
+// with the script. jasper constructs the exec.Cmd itself, so
+// setsid(1) does the work of SysProcAttr.Setpgid. Without setsid,
+// only the process that jasper started is killed on timeout.
+func processGroupPreHook(timed bool) options.CommandPreHook {
+	return func(_ *options.Command, opts *options.Create) {
+		if path := setsidPath(); timed && path != "" && len(opts.Args) > 0 {
+			opts.Args = append([]string{path, "--wait"}, opts.Args...)
+		}
+	}
+}
+
+// killProcessGroups kills the processes that jasper started with the
+// tag, and their process groups, so that commands started by shell
+// scripts do not outlive the timeout. The group is killed even when
+// jasper has already reaped the process that leads it.
+func killProcessGroups(ctx context.Context, tag string) {
+	procs, err := jasper.Context(ctx).Group(ctx, tag)
+	if err != nil {
+		grip.Warning(message.WrapError(err, message.Fields{"op": "kill-process-group", "tag": tag}))
+		return
+	}
+
+	for _, proc := range procs {
+		pid := proc.Info(ctx).PID
+		if pid > 0 {
+			// the process group only exists when the process leads it.
+			_ = syscall.Kill(-pid, syscall.SIGKILL)
+		}
+
+		if proc.Complete(ctx) {
+			continue
+		}
+
+		grip.Warning(message.WrapError(proc.Signal(ctx, syscall.SIGKILL), message.Fields{
+			"op":  "kill-process-group",
+			"tag": tag,
+			"pid": pid,
+		}))
+	}
+}
+
+func timeoutError(name string, timeout time.Duration, attempt int) error {
+	return fmt.Errorf("%w: %q did not complete within %s (attempt %d)", ErrCommandTimeout, name, timeout, attempt)
+}
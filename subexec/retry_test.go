@@ -0,0 +1,97 @@
+package subexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		backoff time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{name: "First", backoff: time.Second, attempt: 1, want: time.Second},
+		{name: "Doubles", backoff: time.Second, attempt: 4, want: 8 * time.Second},
+		{name: "Capped", backoff: time.Minute, attempt: 4, want: MaxBackoff},
+		{name: "ManyAttempts", backoff: time.Second, attempt: 100, want: MaxBackoff},
+		{name: "Zero", backoff: 0, attempt: 3, want: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := &retryPolicy{backoff: tt.backoff}
+			if got := rp.delay(tt.attempt); got != tt.want {
+				t.Errorf("delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	exit3 := errors.New("exit status 3")
+	timeout := timeoutError("build", time.Second, 1)
+
+	canceled, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	for _, tt := range []struct {
+		name    string
+		ctx     context.Context
+		retryOn []int
+		attempt int
+		err     error
+		want    bool
+	}{
+		{name: "NoError", attempt: 1, want: false},
+		{name: "Unfiltered", attempt: 1, err: exit3, want: true},
+		{name: "LastAttempt", attempt: 2, err: exit3, want: true},
+		{name: "Exhausted", attempt: 3, err: exit3, want: false},
+		{name: "Canceled", ctx: canceled, attempt: 1, err: exit3, want: false},
+		{name: "Filtered", retryOn: []int{3}, attempt: 1, err: exit3, want: true},
+		{name: "NotInFilter", retryOn: []int{1, 2}, attempt: 1, err: exit3, want: false},
+		{name: "NoExitCode", retryOn: []int{3}, attempt: 1, err: errors.New("failed"), want: false},
+		{name: "TimeoutIgnoresFilter", retryOn: []int{3}, attempt: 1, err: timeout, want: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = t.Context()
+			}
+
+			rp := &retryPolicy{retries: 2, retryOn: tt.retryOn}
+			if got := rp.shouldRetry(ctx, tt.attempt, tt.err); got != tt.want {
+				t.Errorf("shouldRetry(%d, %v) = %t, want %t", tt.attempt, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 7").Run()
+	if exitErr == nil {
+		t.Fatal("expected the command to fail")
+	}
+
+	for _, tt := range []struct {
+		name string
+		err  error
+		code int
+		ok   bool
+	}{
+		{name: "ExitError", err: exitErr, code: 7, ok: true},
+		{name: "WrappedExitError", err: fmt.Errorf("running build: %w", exitErr), code: 7, ok: true},
+		{name: "Message", err: errors.New("process 'make' failed: exit status 2"), code: 2, ok: true},
+		{name: "NoExitStatus", err: errors.New("file not found"), ok: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			code, ok := exitCode(tt.err)
+			if code != tt.code || ok != tt.ok {
+				t.Errorf("exitCode(%v) = (%d, %t), want (%d, %t)", tt.err, code, ok, tt.code, tt.ok)
+			}
+		})
+	}
+}
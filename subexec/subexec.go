@@ -16,13 +16,19 @@ import (
 type Configuration struct {
 	Commands stw.Slice[Group] `bson:"groups" json:"groups" yaml:"groups"`
 
+	// Vars are available to command templates as {{.Vars.<name>}}.
+	Vars map[string]string `bson:"vars" json:"vars" yaml:"vars"`
+
 	Settings struct {
 		SSHAgentSocketPath    string `bson:"ssh_agent_socket_path" json:"ssh_agent_socket_path" yaml:"ssh_agent_socket_path"`
 		AlacrittySocketPath   string `bson:"alacritty_socket_path" json:"alacritty_socket_path" yaml:"alacritty_socket_path"`
 		IncludeLocalSHH       *bool  `bson:"include_local_ssh" json:"include_local_ssh" yaml:"include_local_ssh"`
 		AllowUndefinedSockets *bool  `bson:"allow_undefined_sockets" json:"allow_undefined_sockets" yaml:"allow_undefined_sockets"`
+		StrictTemplates       *bool  `bson:"strict_templates" json:"strict_templates" yaml:"strict_templates"`
 	} `bson:"settings" json:"settings" yaml:"settings"`
 
+	repoPath func(string) (string, error)
+
 	caches struct {
 		commandGroups       adt.Once[map[string]Group]
 		allCommdands        adt.Once[stw.Slice[Command]]
@@ -41,18 +47,35 @@ func (conf *Configuration) Join(mcf *Configuration) {
 	conf.Settings.SSHAgentSocketPath = util.Default(mcf.Settings.SSHAgentSocketPath, conf.Settings.SSHAgentSocketPath)
 	conf.Settings.IncludeLocalSHH = util.Default(mcf.Settings.IncludeLocalSHH, conf.Settings.IncludeLocalSHH)
 	conf.Settings.AllowUndefinedSockets = util.Default(mcf.Settings.AllowUndefinedSockets, conf.Settings.AllowUndefinedSockets)
+	conf.Settings.StrictTemplates = util.Default(mcf.Settings.StrictTemplates, conf.Settings.StrictTemplates)
+
+	for name, value := range mcf.Vars {
+		if conf.Vars == nil {
+			conf.Vars = map[string]string{}
+		}
+		conf.Vars[name] = value
+	}
 
 	conf.Commands = append(conf.Commands, mcf.Commands...)
 }
 
+// SetRepositoryResolver provides the lookup for the repo function in
+// command templates, which returns the path of a repository by name.
+// It must be called before validation.
+func (conf *Configuration) SetRepositoryResolver(fn func(name string) (string, error)) {
+	conf.repoPath = fn
+}
+
 func (conf *Configuration) Validate() error { return conf.caches.validation.Do(conf.doValidate) }
 func (conf *Configuration) doValidate() error {
 	ec := &erc.Collector{}
 
+	tmpl := newTemplateRenderer(conf.Vars, stw.DerefZ(conf.Settings.StrictTemplates), conf.repoPath)
 	for idx := range conf.Commands {
-		ec.Wrapf(conf.Commands[idx].Validate(), "%d of %T is not valid", idx, conf.Commands[idx])
+		ec.Wrapf(conf.Commands[idx].validate(tmpl), "%d of %T is not valid", idx, conf.Commands[idx])
 	}
 	ec.Push(conf.resolveAliasesAndMergeGroups())
+	ec.Wrap(conf.validateDependencies(), "command dependencies")
 
 	conf.caches.alacrittySocketPath.Set(func() string {
 		if conf.Settings.AlacrittySocketPath != "" {
@@ -214,6 +237,7 @@ func (conf *Configuration) doExportAllCommands() stw.Slice[Command] {
 
 		for cidx := range grp.Commands {
 			cmd := grp.Commands[cidx]
+			cmd.fqn = cmd.FQN()
 			cmd.Name = util.DotJoin(grp.Category, grp.Name, cmd.Name)
 			out = append(out, cmd)
 		}
@@ -0,0 +1,331 @@
+package subexec
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/tychoish/fun/stw"
+	"github.com/tychoish/sardis/util"
+)
+
+// TemplateData is the context for rendering commands. The command,
+// the commands, and the default_command of a group are text/template
+// templates, which can use:
+//
+//	{{.Name}}            the name of the command, without the prefix
+//	{{.Command}}         the command, in default_command and commands
+//	{{.Arg}}             the arg of the command
+//	{{.Host}}            the host of the group
+//	{{.Hostname}}        the name of the local host
+//	{{.Prefix}}          the command_name_prefix of the group
+//	{{.Group.Name}}      the name of the group
+//	{{.Group.Category}}  the category of the group
+//	{{.Env.NAME}}        the environment, with the env of the group and command
+//	{{.Vars.name}}       the vars defined in the configuration
+//	{{.Params.name}}     the values of the parameters of the command
+//
+// and the functions:
+//
+//	default  {{.Arg | default "main"}}   the value, or the default if it's empty
+//	quote    {{quote .Arg}}              the value quoted for the shell
+//	join     {{join "," .Vars.a .Arg}}   the values joined by the separator
+//	repo     {{repo "sardis"}}           the path of a configured repository
+//
+// In strict mode, references to vars and environment variables that
+// are not defined are errors; otherwise they render as empty
+// strings. Use index (e.g. {{index .Env "EDITOR" | default "vi"}}) to
+// reference optional values in strict mode. Actions that do not refer
+// to the data, variables, or functions, such as the {{.Names}} in
+// `docker ps --format '{{.Names}}'`, are left in the command as is.
+type TemplateData struct {
+	Name     string
+	Command  string
+	Arg      string
+	Host     string
+	Hostname string
+	Prefix   string
+	Group    TemplateGroup
+	Env      map[string]string
+	Vars     map[string]string
+	Params   map[string]string
+}
+
+type TemplateGroup struct {
+	Name     string
+	Category string
+}
+
+// the placeholders that commands used before templates, and their
+// replacements. In commands lists {{prefix}} has always been the name
+// of the group, rather than the command name prefix.
+var (
+	legacyCommandPlaceholders = strings.NewReplacer(
+		"{{name}}", "{{.Name}}",
+		"{{command}}", "{{.Command}}",
+		"{{arg}}", "{{.Arg}}",
+		"{{host}}", "{{.Host}}",
+		"{{prefix}}", "{{.Prefix}}",
+		"{{group.name}}", "{{.Group.Name}}",
+		"{{group.category}}", "{{.Group.Category}}",
+	)
+	legacyCommandsPlaceholders = strings.NewReplacer(
+		"{{name}}", "{{.Name}}",
+		"{{command}}", "{{.Command}}",
+		"{{arg}}", "{{.Arg}}",
+		"{{host}}", "{{.Host}}",
+		"{{prefix}}", "{{.Group.Name}}",
+		"{{group.name}}", "{{.Group.Name}}",
+		"{{group.category}}", "{{.Group.Category}}",
+	)
+)
+
+type templateRenderer struct {
+	vars     map[string]string
+	strict   bool
+	repoPath func(string) (string, error)
+	env      map[string]string
+	hostname string
+}
+
+func newTemplateRenderer(vars map[string]string, strict bool, repoPath func(string) (string, error)) *templateRenderer {
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			env[key] = value
+		}
+	}
+
+	return &templateRenderer{
+		vars:     vars,
+		strict:   strict,
+		repoPath: repoPath,
+		env:      env,
+		hostname: util.GetHostname(),
+	}
+}
+
+func (tr *templateRenderer) data(cg *Group, cmd *Command) *TemplateData {
+	env := maps.Clone(tr.env)
+	maps.Copy(env, cmd.Environment)
+
+	return &TemplateData{
+		Name:     cmd.Name,
+		Arg:      cmd.Arg,
+		Host:     stw.DerefZ(cg.Host),
+		Hostname: tr.hostname,
+		Prefix:   cg.CmdNamePrefix,
+		Group:    TemplateGroup{Name: cg.Name, Category: cg.Category},
+		Env:      env,
+		Vars:     tr.vars,
+	}
+}
+
+// commandRenderer returns a function that renders the command, the
+// group's default command, and the commands of the command with the
+// values of its parameters.
+func (tr *templateRenderer) commandRenderer(cg *Group, cmd *Command) func(map[string]string) (string, []string, error) {
+	data := *tr.data(cg, cmd)
+	id := util.DotJoin(cg.Category, cg.Name, cmd.Name)
+	command := util.Default(cmd.Command, cmd.Name)
+	commands := slices.Clone(cmd.Commands)
+	params := slices.Clone(cmd.Params)
+
+	var groupCommand string
+	if !cmd.OverrideDefault {
+		groupCommand = cg.Command
+	}
+
+	return func(values map[string]string) (string, []string, error) {
+		for _, p := range params {
+			if p.Type != ParamRepo || tr.repoPath == nil || values[p.Name] == "" {
+				continue
+			}
+			if _, err := tr.repoPath(values[p.Name]); err != nil {
+				return "", nil, fmt.Errorf("parameter %q: %w", p.Name, err)
+			}
+		}
+
+		data := data
+		data.Params = values
+
+		base, err := tr.render(id, command, legacyCommandPlaceholders, &data)
+		if err != nil {
+			return "", nil, fmt.Errorf("rendering command: %w", err)
+		}
+
+		// a group's default command applies to every command,
+		// either as the command or wrapped around it (via
+		// {{.Command}}), unless the command overrides it.
+		if groupCommand != "" {
+			data.Command = base
+			if base, err = tr.render(id, groupCommand, legacyCommandPlaceholders, &data); err != nil {
+				return "", nil, fmt.Errorf("rendering default command of group: %w", err)
+			}
+		}
+
+		data.Command = base
+		var out []string
+		if commands != nil {
+			out = make([]string, len(commands))
+		}
+		for idx := range commands {
+			if out[idx], err = tr.render(id, commands[idx], legacyCommandsPlaceholders, &data); err != nil {
+				return "", nil, fmt.Errorf("rendering commands[%d]: %w", idx, err)
+			}
+		}
+
+		return base, out, nil
+	}
+}
+
+func (tr *templateRenderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"default": func(def, value string) string { return util.Default(value, def) },
+		"quote":   func(value string) string { return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'" },
+		"join": func(sep string, values ...any) string {
+			out := make([]string, 0, len(values))
+			for _, value := range values {
+				switch val := value.(type) {
+				case []string:
+					out = append(out, val...)
+				default:
+					out = append(out, fmt.Sprint(val))
+				}
+			}
+			return strings.Join(out, sep)
+		},
+		"repo": func(name string) (string, error) {
+			if tr.repoPath == nil {
+				return "", fmt.Errorf("cannot resolve repository %q, no repositories are configured", name)
+			}
+			return tr.repoPath(name)
+		},
+	}
+}
+
+// render executes the text as a template, after replacing legacy
+// placeholders. Text without actions is returned unchanged, as are
+// actions that do not refer to the template data or functions (e.g.
+// the templates in `docker ps --format '{{.Names}}'`).
+func (tr *templateRenderer) render(name, text string, legacy *strings.Replacer, data *TemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	missing := "missingkey=zero"
+	if tr.strict {
+		missing = "missingkey=error"
+	}
+
+	funcs := tr.funcs()
+	tmpl, err := template.New(name).Option(missing).Funcs(funcs).Parse(escapeForeignActions(legacy.Replace(text), funcs))
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+var (
+	templateActionRegex = regexp.MustCompile(`(?s){{(.*?)}}`)
+
+	// templateBuiltins are the keywords and functions that text/template
+	// provides.
+	templateBuiltins = []string{
+		"if", "else", "end", "range", "with", "define", "template", "block", "break", "continue", "nil",
+		"and", "or", "not", "len", "index", "slice", "print", "printf", "println", "call",
+		"eq", "ne", "lt", "le", "gt", "ge", "html", "js", "urlquery",
+	}
+)
+
+// escapeForeignActions replaces the actions in the text that do not
+// refer to the template data, variables, or functions with actions
+// that print them literally, so that commands can pass templates to
+// other programs. Blocks (if, range, and with) belong to the template
+// when their argument does, and their else and end actions belong to
+// the block that they close. Inside of range and with blocks, dot is
+// the value of the block, so all references to dot belong to the
+// template.
+func escapeForeignActions(text string, funcs template.FuncMap) string {
+	type block struct{ ours, rebinds bool }
+	var blocks []block
+
+	rebound := func() bool {
+		return slices.ContainsFunc(blocks, func(b block) bool { return b.ours && b.rebinds })
+	}
+
+	return templateActionRegex.ReplaceAllStringFunc(text, func(action string) string {
+		body := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(action[2:len(action)-2], "-"), "-"))
+		token, rest := templateToken(body)
+
+		var ours bool
+		switch token {
+		case "if", "range", "with":
+			arg, _ := templateToken(rest)
+			ours = isTemplateReference(arg, funcs, rebound())
+			blocks = append(blocks, block{ours: ours, rebinds: token != "if"})
+		case "else", "end":
+			ours = len(blocks) == 0 || blocks[len(blocks)-1].ours
+			if token == "end" && len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		default:
+			ours = isTemplateReference(token, funcs, rebound())
+		}
+
+		if ours {
+			return action
+		}
+		return "{{" + strconv.Quote(action) + "}}"
+	})
+}
+
+// templateToken splits the first token (a field, variable, keyword,
+// function, or an opening parenthesis) from the rest of an action.
+func templateToken(body string) (string, string) {
+	idx := strings.IndexAny(body, " \t\n|()")
+	switch {
+	case idx < 0:
+		return body, ""
+	case idx == 0:
+		return body[:1], strings.TrimSpace(body[1:])
+	default:
+		return body[:idx], strings.TrimSpace(body[idx:])
+	}
+}
+
+// isTemplateReference reports if the token refers to TemplateData (or,
+// when dot is rebound, to dot), a variable, a function, or is a
+// literal, a comment, or a parenthesized pipeline.
+func isTemplateReference(token string, funcs template.FuncMap, rebound bool) bool {
+	switch {
+	case token == "" || token == "(" || strings.ContainsAny(token[:1], "$\"'`/-0123456789"):
+		return true
+	case strings.HasPrefix(token, "."):
+		if rebound {
+			return true
+		}
+		field, _, _ := strings.Cut(token[1:], ".")
+		_, ok := reflect.TypeFor[TemplateData]().FieldByName(field)
+		return ok && field != ""
+	default:
+		_, ok := funcs[token]
+		return ok || slices.Contains(templateBuiltins, token)
+	}
+}
@@ -0,0 +1,62 @@
+package subexec
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplateRender(t *testing.T) {
+	data := &TemplateData{
+		Name:  "ps",
+		Arg:   "web",
+		Group: TemplateGroup{Name: "docker", Category: "ops"},
+		Vars:  map[string]string{"registry": "registry.example.com"},
+	}
+
+	for _, tt := range []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "Plain", text: "docker ps", want: "docker ps"},
+		{name: "Field", text: "docker logs {{.Arg}}", want: "docker logs web"},
+		{name: "Legacy", text: "echo {{name}} {{group.name}}", want: "echo ps docker"},
+		{name: "Function", text: "docker logs {{quote .Arg}}", want: "docker logs 'web'"},
+		{name: "Vars", text: "docker pull {{.Vars.registry}}/{{.Arg}}", want: "docker pull registry.example.com/web"},
+		{name: "ForeignField", text: "docker ps --format '{{.Names}}'", want: "docker ps --format '{{.Names}}'"},
+		{name: "ForeignTable", text: `docker ps --format 'table {{.ID}}\t{{ .Image }}'`, want: `docker ps --format 'table {{.ID}}\t{{ .Image }}'`},
+		{name: "ForeignFunction", text: "docker inspect --format '{{json .Config}}' {{.Arg}}", want: "docker inspect --format '{{json .Config}}' web"},
+		{name: "ForeignBlock", text: "docker inspect -f '{{range .Mounts}}{{.Source}} {{end}}'", want: "docker inspect -f '{{range .Mounts}}{{.Source}} {{end}}'"},
+		{name: "Block", text: "{{range $k, $v := .Vars}}{{$k}}={{.}}{{end}}", want: "registry=registry.example.com"},
+		{name: "Conditional", text: "{{if .Arg}}up {{.Arg}}{{else}}up{{end}}", want: "up web"},
+		{name: "Mixed", text: "{{if .Arg}}docker ps -f name={{.Arg}} --format '{{.Names}}'{{end}}", want: "docker ps -f name=web --format '{{.Names}}'"},
+		{name: "UnknownPlaceholder", text: "echo {{unknown}}", want: "echo {{unknown}}"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTemplateRenderer(nil, false, nil).render(tt.name, tt.text, legacyCommandPlaceholders, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateRenderStrict(t *testing.T) {
+	data := &TemplateData{Vars: map[string]string{}, Env: map[string]string{}}
+
+	_, err := newTemplateRenderer(nil, true, nil).render("strict", "echo {{.Vars.missing}}", legacyCommandPlaceholders, data)
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected an error for the missing var, got %v", err)
+	}
+
+	got, err := newTemplateRenderer(nil, true, nil).render("strict", `echo {{index .Vars "missing" | default "none"}}`, legacyCommandPlaceholders, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "echo none" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
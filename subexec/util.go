@@ -24,15 +24,17 @@ type Utilities struct{}
 
 var TOOLS Utilities = struct{}{}
 
-func (Utilities) WorkerPool(st iter.Seq[fnx.Worker]) fnx.Worker { return wpa.RunWithPool(st) }
-func (Utilities) ToWorker(cmd Command) fnx.Worker               { return cmd.Worker() }
-func (Utilities) Converter() fn.Converter[Command, fnx.Worker]  { return TOOLS.ToWorker }
+func (Utilities) WorkerPool(st iter.Seq[fnx.Worker], opts ...opt.Provider[*wpa.WorkerGroupConf]) fnx.Worker {
+	return wpa.RunWithPool(st, opts...)
+}
+func (Utilities) ToWorker(cmd Command) fnx.Worker              { return cmd.Worker() }
+func (Utilities) Converter() fn.Converter[Command, fnx.Worker] { return TOOLS.ToWorker }
 func (Utilities) Handler() fnx.Handler[Command] {
 	return func(ctx context.Context, cmd Command) error { return cmd.Worker().Run(ctx) }
 }
 
 func (Utilities) CommandPool(st iter.Seq[Command], opts ...opt.Provider[*wpa.WorkerGroupConf]) fnx.Worker {
-	return wpa.RunWithPool(irt.Convert(st, TOOLS.ToWorker))
+	return wpa.RunWithPool(irt.Convert(st, TOOLS.ToWorker), opts...)
 }
 
 type Logging string
@@ -0,0 +1,72 @@
+package sysmgmt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tychoish/sardis/subexec"
+	"github.com/tychoish/sardis/util"
+)
+
+// Explain describes the setup of the service, without running it.
+func (conf *SystemdService) Explain() subexec.Explanation {
+	state := "disable and stop"
+	if conf.Enabled {
+		state = "enable"
+		if conf.Start {
+			state = "enable and start"
+		}
+	}
+
+	exp := subexec.ExplainOperation(util.DotJoin("systemd", conf.Name, "setup"), "", fmt.Sprintf("%s the unit %s", state, conf.Unit))
+	for _, args := range conf.setupArgs() {
+		line := strings.Join(args, " ")
+		if conf.System {
+			line = "sudo " + line
+		}
+		exp.Lines = append(exp.Lines, line)
+	}
+	return exp
+}
+
+// Explain describes what creating the link does, given the current
+// state of the filesystem, without creating it.
+func (lnd *LinkDefinition) Explain() subexec.Explanation {
+	exp := subexec.ExplainOperation(util.DotJoin("links", lnd.Name), "", "")
+
+	if _, err := os.Stat(lnd.Target); os.IsNotExist(err) {
+		exp.Operation = fmt.Sprintf("skip %s: the target %s does not exist", lnd.Path, lnd.Target)
+		return exp
+	}
+
+	sudo := ""
+	if lnd.RequireSudo {
+		sudo = "sudo "
+	}
+
+	if _, err := os.Stat(lnd.Path); !os.IsNotExist(err) {
+		target, err := filepath.EvalSymlinks(lnd.Path)
+		switch {
+		case !lnd.Update:
+			exp.Operation = fmt.Sprintf("skip %s: the path exists", lnd.Path)
+			return exp
+		case err != nil:
+			exp.Operation = fmt.Sprintf("fail: cannot resolve %s: %v", lnd.Path, err)
+			return exp
+		case target == lnd.Target:
+			exp.Operation = fmt.Sprintf("skip %s: already links to %s", lnd.Path, lnd.Target)
+			return exp
+		}
+		exp.Lines = append(exp.Lines, fmt.Sprintf("%srm %s", sudo, filepath.Join(lnd.Path, lnd.Name)))
+	}
+
+	if linkDir := filepath.Dir(lnd.Target); !util.FileExists(linkDir) {
+		exp.Lines = append(exp.Lines, fmt.Sprintf("%smkdir -p %s", sudo, linkDir))
+	}
+	exp.Lines = append(exp.Lines, fmt.Sprintf("%sln -s %s %s", sudo, lnd.Target, lnd.Path))
+	exp.Operation = fmt.Sprintf("link %s to %s", lnd.Path, lnd.Target)
+
+	return exp
+}
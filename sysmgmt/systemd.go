@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/tychoish/grip/level"
 	"github.com/tychoish/grip/message"
 	"github.com/tychoish/jasper"
+	"github.com/tychoish/sardis/history"
 	"github.com/tychoish/sardis/subexec"
 	"github.com/tychoish/sardis/util"
 )
@@ -55,6 +57,33 @@ func (c *SystemdService) Validate() error {
 	return catcher.Resolve()
 }
 
+// setupArgs returns the systemctl commands that enable (and start) or
+// disable and stop the unit.
+func (conf *SystemdService) setupArgs() [][]string {
+	var base []string
+	switch {
+	case conf.User:
+		base = []string{"systemctl", "--user"}
+	case conf.System:
+		base = []string{"systemctl"}
+	default:
+		return nil
+	}
+
+	cmd := func(op string) []string { return append(slices.Clone(base), op, conf.Unit) }
+
+	switch {
+	case conf.Enabled && conf.Start:
+		return [][]string{cmd("enable"), cmd("start")}
+	case conf.Enabled:
+		return [][]string{cmd("enable")}
+	case conf.Disabled:
+		return [][]string{cmd("disable"), cmd("stop")}
+	default:
+		return nil
+	}
+}
+
 func (conf *SystemdService) Worker() fnx.Worker {
 	const opName = "sytemd-service-setup"
 
@@ -74,28 +103,15 @@ func (conf *SystemdService) Worker() fnx.Worker {
 			SetErrorSender(level.Error, buf).
 			Sudo(conf.System)
 
-		switch {
-		case conf.User && conf.Enabled:
-			cmd.AppendArgs("systemctl", "--user", "enable", conf.Unit)
-			if conf.Start {
-				cmd.AppendArgs("systemctl", "--user", "start", conf.Unit)
-			}
-		case conf.User && conf.Disabled:
-			cmd.AppendArgs("systemctl", "--user", "disable", conf.Unit)
-			cmd.AppendArgs("systemctl", "--user", "stop", conf.Unit)
-		case conf.System && conf.Enabled:
-			cmd.AppendArgs("systemctl", "enable", conf.Unit)
-			if conf.Start {
-				cmd.AppendArgs("systemctl", "start", conf.Unit)
-			}
-		case conf.System && conf.Disabled:
-			cmd.AppendArgs("systemctl", "disable", conf.Unit)
-			cmd.AppendArgs("systemctl", "stop", conf.Unit)
-		default:
+		args := conf.setupArgs()
+		if len(args) == 0 {
 			if err := conf.Validate(); err != nil {
 				return err
 			}
 		}
+		for _, arg := range args {
+			cmd.AppendArgs(arg...)
+		}
 
 		msg := message.NewKV().
 			KV("op", opName).
@@ -106,7 +122,9 @@ func (conf *SystemdService) Worker() fnx.Worker {
 			KV("host", hn)
 
 		proclog.Info(grip.MPrintln("----------------", nonce, "---", jobID, "--->"))
-		if err := cmd.Run(ctx); err != nil {
+		err := cmd.Run(ctx)
+		history.Add(ctx, history.NewRecord(opName, conf.Name, nonce, startAt, err, buf.String()))
+		if err != nil {
 			proclog.Info(grip.MPrintln("<---------------", nonce, "---", jobID, "----"))
 			grip.Critical(err)
 
@@ -149,9 +167,10 @@ func (conf *SystemdConfiguration) TaskGroups() stw.Slice[subexec.Group] {
 				{Name: "enable", SortHint: 4},
 				{Name: "disable", SortHint: -2},
 				{
-					Name:             "setup",
-					WorkerDefinition: conf.Services[idx].Worker(),
-					SortHint:         -4,
+					Name:              "setup",
+					WorkerDefinition:  conf.Services[idx].Worker(),
+					WorkerDescription: conf.Services[idx].Explain().Operation,
+					SortHint:          -4,
 				},
 				{
 					Name:            "logs",
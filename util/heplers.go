@@ -1,5 +1,7 @@
 package util
 
+import "io"
+
 func DropErrorOnDefer(ff func() error) { _ = ff() }
 
 func Default[T comparable](value, defaultValue T) (zero T) {
@@ -8,3 +10,11 @@ func Default[T comparable](value, defaultValue T) (zero T) {
 	}
 	return value
 }
+
+// NopWriteCloser adds a no-op Close method to the writer, for jasper
+// commands, which take (and close) io.WriteClosers for their output.
+func NopWriteCloser(wr io.Writer) io.WriteCloser { return nopWriteCloser{Writer: wr} }
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,35 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseInterval converts schedule strings into durations. It accepts
+// the names "hourly", "daily", and "weekly", as well as any
+// time.ParseDuration string, optionally prefixed with "every" (e.g.
+// "every 30m").
+func ParseInterval(in string) (time.Duration, error) {
+	in = strings.TrimSpace(strings.ToLower(in))
+
+	switch in {
+	case "hourly":
+		return time.Hour, nil
+	case "daily", "nightly":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+
+	dur, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(in, "every")))
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval %q: %w", in, err)
+	}
+
+	if dur <= 0 {
+		return 0, fmt.Errorf("interval %q must be positive", in)
+	}
+
+	return dur, nil
+}
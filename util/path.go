@@ -31,6 +31,17 @@ func Apply[T any](fn func(T) T, in []T) []T {
 func TryExpandHomeDirs(in []string) []string { return Apply(TryExpandHomeDir, in) }
 func GetHomeDir() string                     { return jutil.GetHomedir() }
 
+// GetStateDir returns the application's directory inside of the XDG
+// state directory, $XDG_STATE_HOME or ~/.local/state. Callers pass
+// global.ApplicationName, which this package cannot import.
+func GetStateDir(app string) string {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		base = filepath.Join(GetHomeDir(), ".local", "state")
+	}
+	return filepath.Join(base, app)
+}
+
 func TryExpandHomeDir(in string) string {
 	in = strings.TrimSpace(in)
 